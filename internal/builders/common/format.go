@@ -0,0 +1,74 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+	"github.com/slsa-framework/slsa-github-generator/internal/utils"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/bundle"
+)
+
+// ErrUnsupportedFormat indicates an unsupported attestation format.
+type ErrUnsupportedFormat struct {
+	errors.WrappableError
+}
+
+// AttestationFormat is the output format of a signed attestation.
+type AttestationFormat string
+
+const (
+	// FormatDSSE is a DSSE envelope with the signing certificate attached to
+	// the signatures.
+	FormatDSSE AttestationFormat = "dsse"
+
+	// FormatBundle is a Sigstore bundle, which includes the DSSE envelope,
+	// the certificate chain and the transparency log entry.
+	FormatBundle AttestationFormat = "bundle"
+)
+
+// ParseAttestationFormat parses the attestation format. An empty string is
+// parsed as FormatDSSE.
+func ParseAttestationFormat(s string) (AttestationFormat, error) {
+	switch f := AttestationFormat(s); f {
+	case "":
+		return FormatDSSE, nil
+	case FormatDSSE, FormatBundle:
+		return f, nil
+	default:
+		return "", errors.Errorf(&ErrUnsupportedFormat{}, "unsupported attestation format %q", s)
+	}
+}
+
+// Extension returns the file extension used for attestations in the format.
+func (f AttestationFormat) Extension() string {
+	if f == FormatBundle {
+		return "sigstore"
+	}
+	return "intoto.jsonl"
+}
+
+// VerifyPath verifies that the attestation path is valid for the format.
+func (f AttestationFormat) VerifyPath(path string) error {
+	if f == FormatBundle {
+		return utils.VerifyBundlePath(path)
+	}
+	return utils.VerifyAttestationPath(path)
+}
+
+// Encode returns the signed attestation and its transparency log entry
+// encoded in the format.
+func (f AttestationFormat) Encode(att signing.Attestation, entry signing.LogEntry) ([]byte, error) {
+	switch f {
+	case "", FormatDSSE:
+		return att.Bytes(), nil
+	case FormatBundle:
+		b, err := bundle.New(att, entry)
+		if err != nil {
+			return nil, fmt.Errorf("creating bundle: %w", err)
+		}
+		return b.Bytes()
+	default:
+		return nil, errors.Errorf(&ErrUnsupportedFormat{}, "unsupported attestation format %q", f)
+	}
+}
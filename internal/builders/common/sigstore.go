@@ -0,0 +1,31 @@
+package common
+
+import (
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/sigstore"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+	"github.com/slsa-framework/slsa-github-generator/signing/tsa"
+)
+
+// NewSigstoreClients returns the Fulcio signer and the Rekor transparency log
+// used to sign and upload attestations. They use the Sigstore deployment of
+// the trust root file at trustRootPath, or the public instance and the Rekor
+// server at rekorAddr if trustRootPath is empty.
+//
+// NOTE: The trust root is only loaded by the commands that sign, so that an
+// invalid trust root does not break the other commands.
+func NewSigstoreClients(trustRootPath, rekorAddr string) (signing.Signer, signing.TransparencyLog, error) {
+	var tr *trustroot.TrustRoot
+	if trustRootPath != "" {
+		var err error
+		if tr, err = trustroot.Load(trustRootPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	r, err := sigstore.NewRekor(rekorAddr).WithTrustRoot(tr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tsa.WrapSigner(sigstore.NewDefaultFulcio().WithTrustRoot(tr), tr), r, nil
+}
@@ -18,6 +18,7 @@ package main
 // `slsa-docker-based-generator` command.
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -25,12 +26,19 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-cmp/cmp/cmpopts"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/spf13/cobra"
 
+	"github.com/slsa-framework/slsa-github-generator/github"
+	"github.com/slsa-framework/slsa-github-generator/internal/builders/common"
 	"github.com/slsa-framework/slsa-github-generator/internal/builders/docker/pkg"
 	"github.com/slsa-framework/slsa-github-generator/internal/utils"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+	"github.com/slsa-framework/slsa-github-generator/signing/sigstore"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+	"github.com/slsa-framework/slsa-github-generator/signing/tsa"
+	"github.com/slsa-framework/slsa-github-generator/slsa"
 )
 
 // DryRunCmd returns a new *cobra.Command that validates the input flags, and
@@ -69,11 +77,17 @@ func DryRunCmd(check func(error)) *cobra.Command {
 }
 
 // BuildCmd returns a new *cobra.Command that builds the artifacts using the
-// input flags, and prints out their digests, or terminates with an error.
-func BuildCmd(check func(error)) *cobra.Command {
+// input flags, and prints out their digests, or terminates with an error. If
+// a provenance path is given, it also writes the SLSA v1.0 provenance of the
+// artifacts, which is signed with s and uploaded to r if requested, or to the
+// Sigstore deployment of the trust root if they are nil.
+func BuildCmd(check func(error), s signing.Signer, r signing.TransparencyLog) *cobra.Command {
 	inputOptions := &pkg.InputOptions{}
 	var subjectsPath string
 	var outputFolder string
+	var provenancePath string
+	var sign bool
+	var trustRootPath string
 
 	cmd := &cobra.Command{
 		Use:   "build [FLAGS]",
@@ -104,6 +118,19 @@ func BuildCmd(check func(error)) *cobra.Command {
 			artifacts, err := db.BuildArtifacts(absoluteOutputFolder)
 			check(err)
 			check(writeJSONToFile(artifacts, w))
+
+			if provenancePath != "" {
+				var signer signing.Signer
+				tlog := r
+				if sign {
+					signer = s
+					if signer == nil || tlog == nil {
+						signer, tlog, err = common.NewSigstoreClients(trustRootPath, sigstore.DefaultRekorAddr)
+						check(err)
+					}
+				}
+				check(writeProvenance(db, artifacts, provenancePath, signer, tlog))
+			}
 		},
 	}
 
@@ -113,37 +140,149 @@ func BuildCmd(check func(error)) *cobra.Command {
 	cmd.Flags().StringVar(&outputFolder, "output-folder", "",
 		"Required - Path to a folder to store the generated artifacts. MUST be under /tmp.")
 	check(cmd.MarkFlagRequired("output-folder"))
+	cmd.Flags().StringVar(&provenancePath, "provenance-path", "",
+		"Optional - Path to store the SLSA v1.0 provenance of the generated artifacts. "+
+			"Requires the GITHUB_CONTEXT environment variable of a GitHub Actions workflow.")
+	cmd.Flags().BoolVar(&sign, "sign", false,
+		"Optional - Signs the provenance, uploads it to the transparency log, and stores it as a DSSE envelope.")
+	cmd.Flags().StringVar(&trustRootPath, "trust-root", os.Getenv(trustroot.EnvVar),
+		"Optional - Path to a trust root file of a custom Sigstore deployment used to sign the provenance. "+
+			"Defaults to the value of "+trustroot.EnvVar+".")
 
 	return cmd
 }
 
+// writeProvenance writes the SLSA v1.0 provenance of the artifacts built by
+// db to path. If s is not nil, the provenance is signed with s, uploaded to
+// the transparency log r, and written as a DSSE envelope.
+func writeProvenance(db *pkg.DockerBuild, artifacts []intoto.Subject, path string,
+	s signing.Signer, r signing.TransparencyLog,
+) error {
+	ghContext, err := github.GetWorkflowContext()
+	if err != nil {
+		return err
+	}
+	var provider slsa.ClientProvider = &slsa.DefaultClientProvider{}
+	if utils.IsPresubmitTests() {
+		// TODO(github.com/slsa-framework/slsa-github-generator/issues/124): Remove
+		provider = &slsa.NilClientProvider{}
+	}
+
+	ctx := context.Background()
+	p, err := pkg.GenerateProvenance(ctx, db, artifacts, &ghContext, provider)
+	if err != nil {
+		return fmt.Errorf("generating the provenance: %w", err)
+	}
+
+	// Note: the path is validated within CreateNewFileUnderCurrentDirectory().
+	w, err := utils.CreateNewFileUnderCurrentDirectory(path, os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return writeJSONToFile(p, w)
+	}
+
+	att, err := s.Sign(ctx, &intoto.Statement{
+		StatementHeader: p.StatementHeader,
+		Predicate:       p.Predicate,
+	})
+	if err != nil {
+		return fmt.Errorf("signing the provenance: %w", err)
+	}
+	if _, err := r.Upload(ctx, att); err != nil {
+		return fmt.Errorf("uploading the provenance to the transparency log: %w", err)
+	}
+	if _, err := w.Write(att.Bytes()); err != nil {
+		return fmt.Errorf("writing to file failed: %w", err)
+	}
+	return nil
+}
+
 // VerifyCmd returns a new *cobra.Command that takes a provenance file, and
 // verifies it by running the build steps and comparing the generated artifacts
-// to the subject of the provenance file.
+// to the subject of the provenance file. The result of the comparison is
+// written as a JSON report, and the command fails if any subject does not
+// match. The provenance file must be a signed DSSE envelope whose signature
+// is verified first with the trust root, unless the `--unsigned` flag is set.
 func VerifyCmd(check func(error)) *cobra.Command {
 	var provenancePath string
+	var reportPath string
+	var trustRootPath string
+	var unsigned bool
+	var legacyBasenames bool
+	var containerRuntime string
+	var requireHermetic bool
 
 	cmd := &cobra.Command{
 		Use:   "verify [FLAGS]",
 		Short: "Verifies as SLSLv1.0 provenance.",
 		Run: func(cmd *cobra.Command, args []string) {
-			err := verifyProvenance(provenancePath)
+			err := verifyProvenance(provenancePath, reportPath, trustRootPath, unsigned, legacyBasenames, containerRuntime,
+				requireHermetic)
 			check(err)
 		},
 	}
 
 	cmd.Flags().StringVarP(&provenancePath, "provenance-path", "o", "",
 		"Required - Path to the input provenance file.")
+	cmd.Flags().StringVar(&reportPath, "report-path", "",
+		"Optional - Path to write the JSON verification report to. Defaults to stdout.")
+	cmd.Flags().StringVar(&trustRootPath, "trust-root", os.Getenv(trustroot.EnvVar),
+		"Path to a trust root file used to verify the signature of the provenance file. "+
+			"Defaults to the value of "+trustroot.EnvVar+". Required unless --unsigned is set.")
+	cmd.Flags().BoolVar(&unsigned, "unsigned", false,
+		"Optional - Does not verify the signature of the provenance file, which must be trusted.")
+	cmd.Flags().BoolVar(&legacyBasenames, "legacy-basenames", false,
+		"Optional - Matches the subjects named after a basename, as in older provenances, to the only artifact "+
+			"with that basename. The report records that the option is set.")
+	cmd.Flags().StringVar(&containerRuntime, "container-runtime", "",
+		"Optional - Container runtime running the builder image: docker, podman or nerdctl. "+
+			"Defaults to the runtime recorded in the provenance.")
+	cmd.Flags().BoolVar(&requireHermetic, "require-hermetic", false,
+		"Optional - Fails the verification if the provenance does not record a hermetic build.")
 
 	return cmd
 }
 
-func verifyProvenance(provenancePath string) error {
+func verifyProvenance(provenancePath, reportPath, trustRootPath string, unsigned, legacyBasenames bool,
+	containerRuntime string, requireHermetic bool,
+) error {
+	// NOTE: The provenance names the builder image and the source that are
+	// run, so it must be authenticated unless the caller trusts it.
+	if trustRootPath == "" && !unsigned {
+		return fmt.Errorf("no trust root given, use --trust-root or %s, or --unsigned", trustroot.EnvVar)
+	}
+
 	bytes, err := os.ReadFile(provenancePath)
 	if err != nil {
 		return fmt.Errorf("reading provenance file: %w", err)
 	}
 
+	if !unsigned {
+		tr, err := trustroot.Load(trustRootPath)
+		if err != nil {
+			return fmt.Errorf("loading trust root: %w", err)
+		}
+		// NOTE: The certificates attached to the signatures are only trusted
+		// if they chain up to the Fulcio certificates of the trust root.
+		roots := tr.Certificates()
+		if len(roots) == 0 {
+			return fmt.Errorf("no Fulcio certificate found in the trust root %q", trustRootPath)
+		}
+		opts := &envelope.VerifyOptions{Roots: roots}
+		if len(tr.TSACertificates) > 0 {
+			if opts.Timestamps, err = tsa.NewVerifier(tr.TSACertificates); err != nil {
+				return fmt.Errorf("loading timestamp authority: %w", err)
+			}
+		}
+		v, err := envelope.Verify(bytes, opts)
+		if err != nil {
+			return fmt.Errorf("verifying provenance signature: %w", err)
+		}
+		bytes = v.Payload
+	}
+
 	provenance, err := pkg.ParseProvenance(bytes)
 	if err != nil {
 		return fmt.Errorf("parsing provenance file: %w", err)
@@ -153,6 +292,12 @@ func verifyProvenance(provenancePath string) error {
 	if err != nil {
 		return fmt.Errorf("creating DockerBuildConfig from provenance: %w", err)
 	}
+	if requireHermetic && !config.Hermetic {
+		return fmt.Errorf("the provenance does not record a hermetic build")
+	}
+	if containerRuntime != "" {
+		config.ContainerRuntime = containerRuntime
+	}
 
 	builder, err := pkg.NewBuilderWithGitFetcher(config)
 	if err != nil {
@@ -166,18 +311,29 @@ func verifyProvenance(provenancePath string) error {
 	// Remove any temporary files that were fetched during the setup.
 	defer db.RepoInfo.Cleanup()
 
-	// Build artifacts and get their digests.
-	artifacts, err := db.BuildArtifacts("")
+	// Rebuild the artifacts and compare them with the subjects.
+	report, err := db.Verify(provenance, legacyBasenames)
 	if err != nil {
-		return fmt.Errorf("building the artifacts: %w", err)
+		return err
 	}
 
-	less := func(a, b string) bool { return a < b }
-	diff := cmp.Diff(artifacts, provenance.Subject, cmpopts.SortSlices(less))
-	if diff != "" {
-		return fmt.Errorf("comparing the subjects artifacts: %w", err)
+	if reportPath == "" {
+		if err := writeJSONToFile(report, os.Stdout); err != nil {
+			return fmt.Errorf("writing the verification report: %w", err)
+		}
+	} else {
+		w, err := utils.CreateNewFileUnderCurrentDirectory(reportPath, os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		if err := writeJSONToFile(report, w); err != nil {
+			return fmt.Errorf("writing the verification report: %w", err)
+		}
 	}
 
+	if !report.OK() {
+		return fmt.Errorf("the subjects do not match the rebuilt artifacts: %s", report)
+	}
 	return nil
 }
 
@@ -0,0 +1,42 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_verifyProvenance_noFulcioCertificates(t *testing.T) {
+	dir := t.TempDir()
+	trustRootPath := filepath.Join(dir, "trust-root.json")
+	if err := os.WriteFile(trustRootPath, []byte(`{"rekor": {"url": "https://rekor.example.com"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := verifyProvenance("testdata/slsa1-provenance.json", "", trustRootPath, false, false, "", false)
+	if err == nil || !strings.Contains(err.Error(), "no Fulcio certificate") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func Test_verifyProvenance_noTrustRoot(t *testing.T) {
+	err := verifyProvenance("testdata/slsa1-provenance.json", "", "", false, false, "", false)
+	if err == nil || !strings.Contains(err.Error(), "no trust root given") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
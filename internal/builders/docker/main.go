@@ -40,7 +40,7 @@ For more information on SLSA, visit https://slsa.dev`,
 		},
 	}
 	cmd.AddCommand(DryRunCmd(checkExit))
-	cmd.AddCommand(BuildCmd(checkExit))
+	cmd.AddCommand(BuildCmd(checkExit, nil, nil))
 	cmd.AddCommand(VerifyCmd(checkExit))
 	return cmd
 }
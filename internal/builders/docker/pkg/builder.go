@@ -28,6 +28,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/url"
 	"os"
@@ -35,7 +36,10 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1.0"
 
@@ -58,6 +62,12 @@ type errGitCheckout struct {
 	errors.WrappableError
 }
 
+// errImageDigestMismatch indicates that the builder image run by the
+// container runtime does not have the expected digest.
+type errImageDigestMismatch struct {
+	errors.WrappableError
+}
+
 // DockerBuild represents a state in the process of building the artifacts
 // where the source repository is checked out and the config file is loaded and
 // parsed, and we are ready for running the `docker run` command.
@@ -65,6 +75,17 @@ type DockerBuild struct {
 	config      *DockerBuildConfig
 	buildConfig *BuildConfig
 	RepoInfo    *RepoCheckoutInfo
+	// runtime runs the builder image, and runtimeInfo identifies it in the
+	// provenance.
+	runtime     ContainerRuntime
+	runtimeInfo *ContainerRuntimeInfo
+	// The details of the run of the builder image, set by BuildArtifacts:
+	// the digest of the image that ran, the time the steps started and
+	// finished, and the paths of the stdout and stderr logs of the steps.
+	imageDigest *Digest
+	startedOn   time.Time
+	finishedOn  time.Time
+	logs        []string
 }
 
 // RepoCheckoutInfo contains info about the location of a locally checked out
@@ -85,19 +106,31 @@ type Fetcher interface {
 type Builder struct {
 	repoFetcher Fetcher
 	config      DockerBuildConfig
+	runtime     ContainerRuntime
 }
 
 // NewBuilderWithGitFetcher creates a new Builder that fetches the sources
-// from a Git repository.
+// from a Git repository, and runs the builder image with the container
+// runtime of the config.
 func NewBuilderWithGitFetcher(config *DockerBuildConfig) (*Builder, error) {
 	gc, err := newGitClient(config, 0 /* depth */)
 	if err != nil {
 		return nil, fmt.Errorf("could not create builder: %v", err)
 	}
 
+	name := config.ContainerRuntime
+	if name == "" {
+		name = DockerRuntime
+	}
+	runtime, err := NewContainerRuntime(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not create builder: %w", err)
+	}
+
 	return &Builder{
 		repoFetcher: gc,
 		config:      *config,
+		runtime:     runtime,
 	}, nil
 }
 
@@ -109,14 +142,22 @@ func (db *DockerBuild) CreateBuildDefinition() *slsa1.ProvenanceBuildDefinition
 		BuilderImage: builderImage(db.config),
 		ConfigPath:   db.config.BuildConfigPath,
 		Config:       *db.buildConfig,
+		Hermetic:     db.config.Hermetic,
 	}
 
-	// Currently we don't have any SystemParameters or ResolvedDependencies.
-	// So these fields are left empty.
-	return &slsa1.ProvenanceBuildDefinition{
+	bd := &slsa1.ProvenanceBuildDefinition{
 		BuildType:          DockerBasedBuildType,
 		ExternalParameters: ep,
 	}
+
+	// Currently we don't have any ResolvedDependencies. So this field is
+	// left empty.
+	if db.runtimeInfo != nil {
+		bd.SystemParameters = DockerBasedInternalParameters{
+			ContainerRuntime: *db.runtimeInfo,
+		}
+	}
+	return bd
 }
 
 // sourceArtifact returns the source repo and its digest as an instance of ArtifactReference.
@@ -151,81 +192,136 @@ func (b *Builder) SetUpBuildState() (*DockerBuild, error) {
 		return nil, fmt.Errorf("couldn't load config file from %q: %v", b.config.BuildConfigPath, err)
 	}
 
-	// 3. Check that the ArtifactPath pattern does not match any existing files,
+	// 3. Check that the artifact patterns do not match any existing files,
 	// so that we don't accidentally generate provenances for the wrong files.
-	if err := CheckExistingFiles(bc.ArtifactPath); err != nil {
-		return nil, err
+	for _, pattern := range bc.ArtifactPatterns() {
+		if err := CheckExistingFiles(pattern); err != nil {
+			return nil, err
+		}
 	}
 
 	db := &DockerBuild{
 		config:      &b.config,
 		buildConfig: bc,
 		RepoInfo:    repoInfo,
+		runtime:     b.runtime,
+	}
+
+	// 4. Identify the container runtime for the provenance.
+	if b.runtime != nil {
+		if db.runtimeInfo, err = runtimeInfo(b.runtime); err != nil {
+			return nil, fmt.Errorf("couldn't get the version of the container runtime: %w", err)
+		}
 	}
 	return db, nil
 }
 
 // BuildArtifacts builds the artifacts based on the user-provided inputs, and
-// returns the names and SHA256 digests of the generated artifacts.
+// returns the names and SHA256 digests of the generated artifacts. In
+// hermetic builds, the artifact path is relative to the output directory of
+// the build, i.e. `/output` in the container.
 func (db *DockerBuild) BuildArtifacts(outputFolder string) ([]intoto.Subject, error) {
-	if err := runDockerRun(db); err != nil {
-		return nil, fmt.Errorf("running `docker run` failed: %v", err)
+	if db.runtime == nil {
+		return nil, fmt.Errorf("no container runtime")
 	}
-	return inspectAndWriteArtifacts(db.buildConfig.ArtifactPath, outputFolder, db.RepoInfo.RepoRoot)
-}
 
-func runDockerRun(db *DockerBuild) error {
-	// Get the current working directory. We will mount it as a Docker volume.
+	// Get the current working directory. We will mount it as a volume.
 	cwd, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("couldn't get the current working directory: %v", err)
+		return nil, fmt.Errorf("couldn't get the current working directory: %v", err)
+	}
+	opts := &RunOptions{
+		SourceDir: cwd,
+		Hermetic:  db.config.Hermetic,
 	}
+	patterns, root := db.buildConfig.ArtifactPatterns(), db.RepoInfo.RepoRoot
+
+	if opts.Hermetic {
+		if opts.OutputDir, err = os.MkdirTemp("", "output-*"); err != nil {
+			return nil, fmt.Errorf("couldn't create the output directory: %v", err)
+		}
+		// The capabilities are dropped, so the command runs as the owner of
+		// the output directory to be able to write to it.
+		opts.User = hostUser()
+		defer os.RemoveAll(opts.OutputDir)
+		if opts.SeccompProfile, err = writeSeccompProfile(); err != nil {
+			return nil, err
+		}
+		defer os.Remove(opts.SeccompProfile)
+		var outputPatterns []string
+		for _, pattern := range patterns {
+			outputPatterns = append(outputPatterns, filepath.Join(opts.OutputDir, pattern))
+		}
+		patterns, root = outputPatterns, opts.OutputDir
+	}
+
+	if err := runBuilderImage(db, opts); err != nil {
+		return nil, fmt.Errorf("running `%s run` failed: %v", db.runtime.Name(), err)
+	}
+	return inspectAndWriteArtifacts(patterns, outputFolder, root)
+}
 
-	defaultDockerRunFlags := []string{
-		// Mount the current working directory to workspace.
-		fmt.Sprintf("--volume=%s:/workspace", cwd),
-		"--workdir=/workspace",
-		// Remove the container file system after the container exits.
-		"--rm",
+// hostUser returns the UID and GID of the current user in the form UID:GID,
+// or an empty string if they are unknown, e.g. on Windows.
+func hostUser() string {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid < 0 || gid < 0 {
+		return ""
 	}
+	return fmt.Sprintf("%d:%d", uid, gid)
+}
 
+// runBuilderImage runs the steps of the build config in order in the builder
+// image with the container runtime, each in a new container. The logs of the
+// steps are streamed to stderr and saved to temp files.
+func runBuilderImage(db *DockerBuild, opts *RunOptions) error {
 	buildDef := db.CreateBuildDefinition()
 	dockerEp, ok := buildDef.ExternalParameters.(DockerBasedExternalParameters)
 	if !ok {
 		return fmt.Errorf("expected docker-based external parameters")
 	}
 
-	var args []string
-	args = append(args, "run")
-	args = append(args, defaultDockerRunFlags...)
-	args = append(args, dockerEp.BuilderImage.URI)
-	args = append(args, db.buildConfig.Command...)
-	cmd := exec.Command("docker", args...)
-
-	log.Printf("Running command: %q.", cmd.String())
-
-	stdout, err := cmd.StdoutPipe()
+	logFile, err := os.CreateTemp("", "log-*.txt")
 	if err != nil {
-		return fmt.Errorf("couldn't get the command's stdout: %v", err)
+		return fmt.Errorf("couldn't create tempfile: %v", err)
 	}
-	stderr, err := cmd.StderrPipe()
+	defer logFile.Close()
+	errFile, err := os.CreateTemp("", "log-*.txt")
 	if err != nil {
-		return fmt.Errorf("couldn't get the command's stderr: %v", err)
+		return fmt.Errorf("couldn't create tempfile: %v", err)
 	}
+	defer errFile.Close()
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("couldn't start the 'git checkout' command: %v", err)
+	db.logs = []string{logFile.Name(), errFile.Name()}
+
+	image := dockerEp.BuilderImage.URI
+	steps := db.buildConfig.BuildSteps()
+	db.startedOn = time.Now().UTC()
+	for i, step := range steps {
+		stepOpts := *opts
+		stepOpts.Env = step.Env
+		stepOpts.WorkingDir = step.WorkingDir
+
+		log.Printf("Running step %d/%d.", i+1, len(steps))
+		if err := db.runtime.Run(image, step.Command, &stepOpts,
+			io.MultiWriter(os.Stderr, logFile), io.MultiWriter(os.Stderr, errFile)); err != nil {
+			return fmt.Errorf("failed to complete step %d: %v; see %s for logs, and %s for errors",
+				i+1, err, logFile.Name(), errFile.Name())
+		}
 	}
+	db.finishedOn = time.Now().UTC()
 
-	files, err := saveToTempFile(stdout, stderr)
+	// The image was pulled by digest, so this only fails if the runtime
+	// resolved it to another image.
+	digest, err := db.runtime.ImageDigest(image)
 	if err != nil {
-		return fmt.Errorf("cannot save logs and errs to file: %v", err)
+		return fmt.Errorf("couldn't inspect the builder image: %v", err)
 	}
-
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("failed to complete the command: %v; see %s for logs, and %s for errors",
-			err, files[0], files[1])
+	if *digest != db.config.BuilderImage.Digest {
+		return errors.Errorf(&errImageDigestMismatch{}, "the builder image %q has digest %s:%s",
+			image, digest.Alg, digest.Value)
 	}
+	db.imageDigest = digest
 
 	return nil
 }
@@ -503,10 +599,9 @@ func saveToTempFile(readers ...io.Reader) ([]string, error) {
 
 // CheckExistingFiles checks if any files match the given pattern, and returns an error if so.
 func CheckExistingFiles(pattern string) error {
-	matches, err := filepath.Glob(pattern)
-	// The only possible error is ErrBadPattern.
+	matches, err := globArtifacts(pattern)
 	if err != nil {
-		return fmt.Errorf("the pattern (%q) is malformed: %v", pattern, err)
+		return err
 	}
 
 	if len(matches) == 0 {
@@ -515,19 +610,110 @@ func CheckExistingFiles(pattern string) error {
 	return fmt.Errorf("the specified pattern (%q) matches %d existing files; expected no matches", pattern, len(matches))
 }
 
-// Finds all files matching the given pattern, measures the SHA256 digest of
-// each file, and returns filenames and digests as an array of intoto.Subject.
-// This also writes the output to a configured output folder, if provided.
-// Precondition: The pattern is a relative file path pattern.
-func inspectAndWriteArtifacts(pattern, outputFolder, root string) ([]intoto.Subject, error) {
-	matches, err := filepath.Glob(pattern)
-	// The only possible error is ErrBadPattern.
+// globArtifacts returns the files matching the pattern. A `**` element of
+// the pattern matches any number of directories, and then only regular
+// files match. Other patterns have the syntax of filepath.Glob.
+func globArtifacts(pattern string) ([]string, error) {
+	elems := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	doubleStar := false
+	for _, e := range elems {
+		doubleStar = doubleStar || e == "**"
+	}
+	if !doubleStar {
+		matches, err := filepath.Glob(pattern)
+		// The only possible error is ErrBadPattern.
+		if err != nil {
+			return nil, fmt.Errorf("the pattern (%q) is malformed: %v", pattern, err)
+		}
+		return matches, nil
+	}
+
+	// Walk the files under the longest prefix of the pattern without
+	// wildcards.
+	i := 0
+	for i < len(elems) && !strings.ContainsAny(elems[i], `*?[\`) {
+		i++
+	}
+	root := filepath.FromSlash(strings.Join(elems[:i], "/"))
+	if root == "" && i > 0 {
+		root = string(filepath.Separator)
+	} else if root == "" {
+		root = "."
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		// Note: the paths are joined to the clean root, so the elements of
+		// the path and of the pattern line up.
+		ok, err := matchElems(elems, strings.Split(filepath.ToSlash(path), "/"))
+		if err != nil {
+			return fmt.Errorf("the pattern (%q) is malformed: %v", pattern, err)
+		}
+		if ok {
+			matches = append(matches, path)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("the pattern (%q) is malformed: %v", pattern, err)
+		return nil, err
 	}
+	return matches, nil
+}
 
-	if len(matches) == 0 {
-		return nil, fmt.Errorf("no files matching the pattern %q: %v", pattern, err)
+// matchElems returns true if the elements of a path match the elements of a
+// pattern, where a `**` element matches any number of path elements.
+func matchElems(pattern, elems []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if ok, err := matchElems(pattern[1:], elems[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(elems) == 0 {
+			return false, nil
+		}
+		if ok, err := path.Match(pattern[0], elems[0]); !ok || err != nil {
+			return false, err
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0, nil
+}
+
+// Finds all files matching the given patterns, measures the SHA256 digest of
+// each file, and returns the paths of the files relative to the root and
+// their digests as an array of intoto.Subject.
+// This also writes the output to a configured output folder, if provided.
+// Precondition: The patterns are relative file path patterns.
+func inspectAndWriteArtifacts(patterns []string, outputFolder, root string) ([]intoto.Subject, error) {
+	var matches []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		m, err := globArtifacts(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(m) == 0 {
+			return nil, fmt.Errorf("no files matching the pattern %q", pattern)
+		}
+		for _, path := range m {
+			if !seen[path] {
+				seen[path] = true
+				matches = append(matches, path)
+			}
+		}
 	}
 
 	var subjects []intoto.Subject
@@ -537,26 +723,25 @@ func inspectAndWriteArtifacts(pattern, outputFolder, root string) ([]intoto.Subj
 			return nil, fmt.Errorf("couldn't read file %q: %v", path, err)
 		}
 
-		// Write intoto subjects to output
-		subject, err := toIntotoSubject(data, path)
+		// The subjects are named after the path relative to the root of the
+		// source repository.
+		if root != "" {
+			path, err = filepath.Abs(path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		relPath, err := filepath.Rel(root, path)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Root %s Path %s: %w", root, path, err)
 		}
-		subjects = append(subjects, *subject)
+
+		// Write intoto subjects to output
+		subjects = append(subjects, toIntotoSubject(data, filepath.ToSlash(relPath)))
 
 		if outputFolder != "" {
 			// Write output file to output folder using the path relative to the root
 			// of the source repository.
-			if root != "" {
-				path, err = filepath.Abs(path)
-				if err != nil {
-					return nil, err
-				}
-			}
-			relPath, err := filepath.Rel(root, path)
-			if err != nil {
-				return nil, fmt.Errorf("Root %s Path %s: %w", root, path, err)
-			}
 			w, err := utils.CreateNewFileUnderDirectory(relPath, outputFolder, os.O_WRONLY)
 			if err != nil {
 				return nil, fmt.Errorf("creating new output file: %v", err)
@@ -570,17 +755,14 @@ func inspectAndWriteArtifacts(pattern, outputFolder, root string) ([]intoto.Subj
 	return subjects, nil
 }
 
-// Reads the file in the given path and returns its name and digest wrapped in
+// toIntotoSubject returns the given name and the digest of the data wrapped in
 // an intoto.Subject.
-func toIntotoSubject(data []byte, filePath string) (*intoto.Subject, error) {
+func toIntotoSubject(data []byte, name string) intoto.Subject {
 	sum256 := sha256.Sum256(data)
-	digest := hex.EncodeToString(sum256[:])
-	name := filepath.Base(filePath)
-	subject := &intoto.Subject{
+	return intoto.Subject{
 		Name:   name,
-		Digest: map[string]string{"sha256": digest},
+		Digest: map[string]string{"sha256": hex.EncodeToString(sum256[:])},
 	}
-	return subject, nil
 }
 
 // Cleanup removes the generated temp files. But it might not be able to remove
@@ -626,11 +808,26 @@ func ParseProvenance(bytes []byte) (*ProvenanceStatementSLSA1, error) {
 
 	statement.Predicate.BuildDefinition.ExternalParameters = ep
 
+	// Likewise for the SystemParameters, which are only recorded by recent
+	// versions of the builder.
+	if sp := statement.Predicate.BuildDefinition.SystemParameters; sp != nil {
+		var ip DockerBasedInternalParameters
+		b, err := json.Marshal(sp)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal map into JSON bytes: %v", err)
+		}
+		if err = json.Unmarshal(b, &ip); err != nil {
+			return nil, fmt.Errorf("could not unmarshal JSON bytes into internal parameters: %v", err)
+		}
+		statement.Predicate.BuildDefinition.SystemParameters = ip
+	}
+
 	return &statement, nil
 }
 
 // ToDockerBuildConfig creates an instance of DockerBuildConfig using the
-// external parameters in this provenance.
+// external parameters in this provenance. The container runtime is the one
+// recorded in the provenance, or Docker if there is none.
 func (p *ProvenanceStatementSLSA1) ToDockerBuildConfig(forceCheckout bool) (*DockerBuildConfig, error) {
 	ep, ok := p.Predicate.BuildDefinition.ExternalParameters.(DockerBasedExternalParameters)
 	if !ok {
@@ -654,11 +851,32 @@ func (p *ProvenanceStatementSLSA1) ToDockerBuildConfig(forceCheckout bool) (*Doc
 		Value: val,
 	}
 
+	containerRuntime := DockerRuntime
+	if ip, ok := p.Predicate.BuildDefinition.SystemParameters.(DockerBasedInternalParameters); ok {
+		containerRuntime = ip.ContainerRuntime.Name
+	}
+
 	return &DockerBuildConfig{
-		SourceRepo:      ep.Source.URI,
-		SourceDigest:    sd,
-		BuilderImage:    *di,
-		BuildConfigPath: ep.ConfigPath,
-		ForceCheckout:   forceCheckout,
+		SourceRepo:       ep.Source.URI,
+		SourceDigest:     sd,
+		BuilderImage:     *di,
+		BuildConfigPath:  ep.ConfigPath,
+		ForceCheckout:    forceCheckout,
+		ContainerRuntime: containerRuntime,
+		Hermetic:         ep.Hermetic,
 	}, nil
 }
+
+// VerifyBuildConfig checks that the build config of this DockerBuild, loaded
+// from the source repository, is the one recorded in the provenance, so that
+// the build replays the recorded steps.
+func (db *DockerBuild) VerifyBuildConfig(p *ProvenanceStatementSLSA1) error {
+	ep, ok := p.Predicate.BuildDefinition.ExternalParameters.(DockerBasedExternalParameters)
+	if !ok {
+		return fmt.Errorf("expected docker-based external parameters")
+	}
+	if diff := cmp.Diff(ep.Config, *db.buildConfig, cmpopts.EquateEmpty()); diff != "" {
+		return fmt.Errorf("the build config differs from the provenance (-provenance +config):\n%s", diff)
+	}
+	return nil
+}
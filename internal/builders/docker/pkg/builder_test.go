@@ -15,6 +15,7 @@
 package pkg
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -58,6 +59,59 @@ func Test_CreateBuildDefinition(t *testing.T) {
 	}
 }
 
+func Test_CreateBuildDefinition_roundTrip(t *testing.T) {
+	db := &DockerBuild{
+		config: &DockerBuildConfig{
+			SourceRepo:   "git+https://github.com/slsa-framework/slsa-github-generator@refs/heads/main",
+			SourceDigest: Digest{Alg: "sha1", Value: "cf5804b5c6f1a4b2a0b03401a487dfdfbe3a5f00"},
+			BuilderImage: DockerImage{
+				Name:   "bash",
+				Digest: Digest{Alg: "sha256", Value: "9e2ba52487d945504d250de186cb4fe2e3ba023ed2921dd6ac8b97ed43e76af9"},
+			},
+			Hermetic: true,
+		},
+		buildConfig: &BuildConfig{ArtifactPath: "config.toml"},
+		runtimeInfo: &ContainerRuntimeInfo{Name: PodmanRuntime, Version: "4.4.1"},
+	}
+
+	// The runtime and the hermeticity in the provenance are used for the
+	// verification.
+	provenance := loadProvenance(t)
+	provenance.Predicate.BuildDefinition = *db.CreateBuildDefinition()
+	bytes, err := json.Marshal(provenance)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	parsed, err := ParseProvenance(bytes)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	want := DockerBasedInternalParameters{ContainerRuntime: *db.runtimeInfo}
+	if diff := cmp.Diff(want, parsed.Predicate.BuildDefinition.SystemParameters); diff != "" {
+		t.Errorf(diff)
+	}
+
+	config, err := parsed.ToDockerBuildConfig(false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if config.ContainerRuntime != PodmanRuntime {
+		t.Errorf("unexpected container runtime, got: %q, want: %q", config.ContainerRuntime, PodmanRuntime)
+	}
+	if !config.Hermetic {
+		t.Errorf("expected a hermetic build")
+	}
+
+	// The build config of the provenance is replayed.
+	if err := db.VerifyBuildConfig(parsed); err != nil {
+		t.Errorf("VerifyBuildConfig: %v", err)
+	}
+	db.buildConfig = &BuildConfig{ArtifactPath: "other.toml"}
+	if err := db.VerifyBuildConfig(parsed); err == nil {
+		t.Errorf("expected an error for a different build config")
+	}
+}
+
 func Test_GitClient_verifyOrFetchRepo(t *testing.T) {
 	config := &DockerBuildConfig{
 		// Use a small repo for test
@@ -160,6 +214,124 @@ func Test_GitClient_invalidSourceRef(t *testing.T) {
 	}
 }
 
+// hermeticRuntimeScript is a fake container runtime CLI writing an artifact
+// named after the NAME env variable to the working directory of the step
+// under the output volume. It fails if the seccomp profile does not exist, or
+// if the step does not run as the owner of the output volume.
+const hermeticRuntimeScript = `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+	--user=*) user="${arg#--user=}" ;;
+	--volume=*:/output) out="${arg#--volume=}"; out="${out%:/output}" ;;
+	--workdir=*) dir="${arg#--workdir=/workspace}" ;;
+	--env=NAME=*) name="${arg#--env=NAME=}" ;;
+	--security-opt=seccomp=*) test -f "${arg#--security-opt=seccomp=}" || exit 1 ;;
+	esac
+done
+case "$1" in
+run) test "$user" = "$(id -u):$(id -g)" && mkdir -p "$out$dir" && echo "artifact" > "$out$dir/$name.txt" ;;
+image) echo '["bash@sha256:` + testImageDigest + `"]' ;;
+esac
+`
+
+// newHermeticBuild returns a hermetic build with two steps run by a fake
+// container runtime.
+func newHermeticBuild(t *testing.T) *DockerBuild {
+	cli := filepath.Join(t.TempDir(), "runtime")
+	if err := os.WriteFile(cli, []byte(hermeticRuntimeScript), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return &DockerBuild{
+		config: &DockerBuildConfig{
+			BuilderImage: DockerImage{
+				Name:   "bash",
+				Digest: Digest{Alg: "sha256", Value: testImageDigest},
+			},
+			Hermetic: true,
+		},
+		buildConfig: &BuildConfig{
+			Version: BuildConfigV2,
+			Steps: []BuildStep{
+				{Command: []string{"make"}, Env: []string{"NAME=lib"}, WorkingDir: "lib/sub"},
+				{Command: []string{"make"}, Env: []string{"NAME=app"}},
+			},
+			ArtifactPaths: []string{"lib/**/*.txt", "*.txt"},
+		},
+		RepoInfo: &RepoCheckoutInfo{},
+		runtime:  &dockerRuntime{cliRuntime{binary: cli}},
+	}
+}
+
+func Test_DockerBuild_BuildArtifacts_hermetic(t *testing.T) {
+	db := newHermeticBuild(t)
+	out := t.TempDir()
+	got, err := db.BuildArtifacts(out)
+	if err != nil {
+		t.Fatalf("BuildArtifacts: %v", err)
+	}
+
+	// sha256 of "artifact\n".
+	digest := map[string]string{"sha256": "5b3513f580c8397212ff2c8f459c199efc0c90e4354a5f3533adf0a3fff3a530"}
+	want := []intoto.Subject{
+		{Name: "lib/sub/lib.txt", Digest: digest},
+		{Name: "app.txt", Digest: digest},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(diff)
+	}
+	for _, name := range []string{"lib/sub/lib.txt", "app.txt"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("the artifact was not written to the output folder: %v", err)
+		}
+	}
+}
+
+func Test_globArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "dist/b.txt", "dist/linux/c.txt", "dist/linux/amd64/d.bin"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "*.txt", expected: []string{"a.txt"}},
+		{pattern: "dist/*", expected: []string{"dist/b.txt", "dist/linux"}},
+		{pattern: "dist/**", expected: []string{"dist/b.txt", "dist/linux/amd64/d.bin", "dist/linux/c.txt"}},
+		{pattern: "**/*.txt", expected: []string{"a.txt", "dist/b.txt", "dist/linux/c.txt"}},
+		{pattern: "dist/**/amd64/*", expected: []string{"dist/linux/amd64/d.bin"}},
+		{pattern: "./dist/**/c.txt", expected: []string{"dist/linux/c.txt"}},
+		{pattern: "out/**"},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.pattern, func(t *testing.T) {
+			matches, err := globArtifacts(filepath.Join(dir, tt.pattern))
+			if err != nil {
+				t.Fatalf("globArtifacts: %v", err)
+			}
+			var got []string
+			for _, m := range matches {
+				rel, err := filepath.Rel(dir, m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("unexpected matches (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func Test_inspectArtifacts(t *testing.T) {
 	// Note: If the files in ../testdata/ change, this test must be updated.
 	pattern := "../testdata/*"
@@ -169,27 +341,27 @@ func Test_inspectArtifacts(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	got, err := inspectAndWriteArtifacts(pattern, out, filepath.Dir(wd))
+	got, err := inspectAndWriteArtifacts([]string{pattern}, out, filepath.Dir(wd))
 	if err != nil {
 		t.Fatalf("failed to inspect artifacts: %v", err)
 	}
 
 	s1 := intoto.Subject{
-		Name:   "build-definition.json",
+		Name:   "testdata/build-definition.json",
 		Digest: map[string]string{"sha256": "b1c74863007166aadca8ff54a0e647047696bee38e8e8a25a1290f494e3abc46"},
 	}
 	s2 := intoto.Subject{
-		Name:   "config.toml",
+		Name:   "testdata/config.toml",
 		Digest: map[string]string{"sha256": "975a0582b8c9607f3f20a6b8cfef01b25823e68c5c3658e6e1ccaaced2a3255d"},
 	}
 
 	s3 := intoto.Subject{
-		Name:   "slsa1-provenance.json",
+		Name:   "testdata/slsa1-provenance.json",
 		Digest: map[string]string{"sha256": "f472aaf04468ae881ab502f1f02f23476fe0d4dbb7a8a4b5d3eae9b2843e2ecd"},
 	}
 
 	s4 := intoto.Subject{
-		Name:   "wildcard-config.toml",
+		Name:   "testdata/wildcard-config.toml",
 		Digest: map[string]string{"sha256": "d9b8670f1b9616db95b0dc84cbc68062c691ef31bb9240d82753de0739c59194"},
 	}
 
@@ -219,27 +391,27 @@ func Test_inspectArtifactsNoRoot(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	got, err := inspectAndWriteArtifacts(pattern, out, "")
+	got, err := inspectAndWriteArtifacts([]string{pattern}, out, "")
 	if err != nil {
 		t.Fatalf("failed to inspect artifacts: %v", err)
 	}
 
 	s1 := intoto.Subject{
-		Name:   "build-definition.json",
+		Name:   "testdata/build-definition.json",
 		Digest: map[string]string{"sha256": "b1c74863007166aadca8ff54a0e647047696bee38e8e8a25a1290f494e3abc46"},
 	}
 	s2 := intoto.Subject{
-		Name:   "config.toml",
+		Name:   "testdata/config.toml",
 		Digest: map[string]string{"sha256": "975a0582b8c9607f3f20a6b8cfef01b25823e68c5c3658e6e1ccaaced2a3255d"},
 	}
 
 	s3 := intoto.Subject{
-		Name:   "slsa1-provenance.json",
+		Name:   "testdata/slsa1-provenance.json",
 		Digest: map[string]string{"sha256": "f472aaf04468ae881ab502f1f02f23476fe0d4dbb7a8a4b5d3eae9b2843e2ecd"},
 	}
 
 	s4 := intoto.Subject{
-		Name:   "wildcard-config.toml",
+		Name:   "testdata/wildcard-config.toml",
 		Digest: map[string]string{"sha256": "d9b8670f1b9616db95b0dc84cbc68062c691ef31bb9240d82753de0739c59194"},
 	}
 
@@ -316,8 +488,9 @@ func Test_ProvenanceStatementSLSA1_ToDockerBuildConfig(t *testing.T) {
 				Value: "9e2ba52487d945504d250de186cb4fe2e3ba023ed2921dd6ac8b97ed43e76af9",
 			},
 		},
-		BuildConfigPath: "internal/builders/docker/testdata/config.toml",
-		ForceCheckout:   true,
+		BuildConfigPath:  "internal/builders/docker/testdata/config.toml",
+		ForceCheckout:    true,
+		ContainerRuntime: DockerRuntime,
 	}
 	if diff := cmp.Diff(got, want); diff != "" {
 		t.Errorf(diff)
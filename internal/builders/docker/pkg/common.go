@@ -51,4 +51,16 @@ type DockerBasedExternalParameters struct {
 
 	// Unpacked build config parameters
 	Config BuildConfig `json:"buildConfig"`
+
+	// Whether the build ran without network access, with a read-only source
+	// directory, no capabilities and a restrictive seccomp profile.
+	Hermetic bool `json:"hermetic,omitempty"`
+}
+
+// DockerBasedInternalParameters are the parameters of the build under the
+// control of the builder. They are recorded in the `systemParameters` of the
+// build definition, which are called `internalParameters` in SLSA v1.0.
+type DockerBasedInternalParameters struct {
+	// The container runtime that ran the builder image.
+	ContainerRuntime ContainerRuntimeInfo `json:"containerRuntime"`
 }
@@ -20,24 +20,121 @@ package pkg
 import (
 	"fmt"
 	"net/url"
+	"path"
 	"strings"
 
 	toml "github.com/pelletier/go-toml"
 	"github.com/slsa-framework/slsa-github-generator/internal/utils"
 )
 
+const (
+	// BuildConfigV1 is the version of build configs with a single command
+	// and artifact path. Configs without a version are version 1.
+	BuildConfigV1 = 1
+	// BuildConfigV2 is the version of build configs with a list of steps and
+	// artifact paths.
+	BuildConfigV2 = 2
+)
+
 // BuildConfig is a collection of parameters to use for building the artifact.
 type BuildConfig struct {
+	// Version is the version of the schema of the config file.
+	Version int `toml:"version" json:"Version,omitempty"`
+
 	// The path, relative to the root of the git repository, where the artifact
-	// built by the `docker run` command is expected to be found.
-	ArtifactPath string `toml:"artifact_path"`
+	// built by the `docker run` command is expected to be found. Only used in
+	// version 1.
+	ArtifactPath string `toml:"artifact_path" json:"ArtifactPath,omitempty"`
 
-	// TODO(#1191): Add env and options if needed.
 	// Command to pass to `docker run`. The command is taken as an array
 	// instead of a single string to avoid unnecessary parsing. See
 	// https://docs.docker.com/engine/reference/builder/#cmd and
 	// https://man7.org/linux/man-pages/man3/exec.3.html for more details.
-	Command []string `toml:"command"`
+	// Only used in version 1.
+	Command []string `toml:"command" json:"Command,omitempty"`
+
+	// Steps are run in order in the builder image, each in a new container.
+	// Only used in version 2.
+	Steps []BuildStep `toml:"steps" json:"Steps,omitempty"`
+
+	// The paths, relative to the root of the git repository, where the
+	// artifacts are expected to be found. A `**` path element matches any
+	// number of directories. Only used in version 2.
+	ArtifactPaths []string `toml:"artifact_paths" json:"ArtifactPaths,omitempty"`
+}
+
+// BuildStep is a step of a version 2 build config.
+type BuildStep struct {
+	// Command to pass to `docker run`, see BuildConfig.Command.
+	Command []string `toml:"command" json:"Command"`
+
+	// Env are the env variables of the command, in the form NAME=VALUE.
+	Env []string `toml:"env" json:"Env,omitempty"`
+
+	// WorkingDir is the working directory of the command, relative to the
+	// root of the git repository.
+	WorkingDir string `toml:"workdir" json:"WorkingDir,omitempty"`
+}
+
+// BuildSteps returns the steps of the build. A version 1 build has a single
+// step running its command.
+func (bc *BuildConfig) BuildSteps() []BuildStep {
+	if bc.Version == BuildConfigV2 {
+		return bc.Steps
+	}
+	return []BuildStep{{Command: bc.Command}}
+}
+
+// ArtifactPatterns returns the paths of the artifacts of the build.
+func (bc *BuildConfig) ArtifactPatterns() []string {
+	if bc.Version == BuildConfigV2 {
+		return bc.ArtifactPaths
+	}
+	return []string{bc.ArtifactPath}
+}
+
+// validate checks that the fields of the version of the config are set, and
+// that the fields of the other version are not.
+func (bc *BuildConfig) validate() error {
+	switch bc.Version {
+	case 0, BuildConfigV1:
+		if len(bc.Steps) != 0 || len(bc.ArtifactPaths) != 0 {
+			return fmt.Errorf("steps and artifact_paths require version = %d", BuildConfigV2)
+		}
+		return nil
+	case BuildConfigV2:
+		if len(bc.Command) != 0 || bc.ArtifactPath != "" {
+			return fmt.Errorf("command and artifact_path are not supported in version %d, use steps and artifact_paths", BuildConfigV2)
+		}
+	default:
+		return fmt.Errorf("unsupported version %d", bc.Version)
+	}
+
+	if len(bc.Steps) == 0 {
+		return fmt.Errorf("no steps")
+	}
+	for i, step := range bc.Steps {
+		if len(step.Command) == 0 {
+			return fmt.Errorf("step %d: no command", i)
+		}
+		for _, e := range step.Env {
+			if name, _, ok := strings.Cut(e, "="); !ok || name == "" {
+				return fmt.Errorf("step %d: env variable %q is not in the form NAME=VALUE", i, e)
+			}
+		}
+		if err := validateWorkingDir(step.WorkingDir); err != nil {
+			return fmt.Errorf("step %d: %v", i, err)
+		}
+	}
+	if len(bc.ArtifactPaths) == 0 {
+		return fmt.Errorf("no artifact_paths")
+	}
+	for _, p := range bc.ArtifactPaths {
+		if p == "" {
+			return fmt.Errorf("empty artifact path")
+		}
+	}
+	return nil
 }
 
 // Digest specifies a digest values, including the name of the hash function
@@ -66,6 +163,11 @@ type DockerBuildConfig struct {
 	BuilderImage    DockerImage
 	BuildConfigPath string
 	ForceCheckout   bool
+	// ContainerRuntime is the name of the container runtime running the
+	// builder image. Docker is used if empty.
+	ContainerRuntime string
+	// Hermetic runs the build isolated from the network and the host.
+	Hermetic bool
 }
 
 // NewDockerBuildConfig validates the inputs and generates an instance of
@@ -89,12 +191,22 @@ func NewDockerBuildConfig(io *InputOptions) (*DockerBuildConfig, error) {
 		return nil, fmt.Errorf("invalid build config path: %v", err)
 	}
 
+	containerRuntime := io.ContainerRuntime
+	if containerRuntime == "" {
+		containerRuntime = DockerRuntime
+	}
+	if _, err := NewContainerRuntime(containerRuntime); err != nil {
+		return nil, err
+	}
+
 	return &DockerBuildConfig{
-		SourceRepo:      io.SourceRepo,
-		SourceDigest:    *sourceRepoDigest,
-		BuilderImage:    *dockerImage,
-		BuildConfigPath: io.BuildConfigPath,
-		ForceCheckout:   io.ForceCheckout,
+		SourceRepo:       io.SourceRepo,
+		SourceDigest:     *sourceRepoDigest,
+		BuilderImage:     *dockerImage,
+		BuildConfigPath:  io.BuildConfigPath,
+		ForceCheckout:    io.ForceCheckout,
+		ContainerRuntime: containerRuntime,
+		Hermetic:         io.Hermetic,
 	}, nil
 }
 
@@ -150,6 +262,18 @@ func validatePath(path string) error {
 	return nil
 }
 
+// validateWorkingDir checks that the working directory of a step is a
+// relative path under the root of the repository, i.e. `/workspace`.
+func validateWorkingDir(dir string) error {
+	if path.IsAbs(dir) {
+		return fmt.Errorf("workdir (%q) is not a relative path", dir)
+	}
+	if err := utils.PathIsUnderDirectory(dir, "/workspace"); err != nil {
+		return fmt.Errorf("workdir (%q) is not under the root of the repository", dir)
+	}
+	return nil
+}
+
 // ToMap returns this instance as a mapping between the algorithm and value.
 func (d *Digest) ToMap() map[string]string {
 	return map[string]string{d.Alg: d.Value}
@@ -175,6 +299,9 @@ func loadBuildConfigFromFile(path string) (*BuildConfig, error) {
 	if err := tomlTree.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("couldn't ubmarshal toml file: %v", err)
 	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid build config: %v", err)
+	}
 
 	return &config, nil
 }
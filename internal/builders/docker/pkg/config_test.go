@@ -15,6 +15,8 @@
 package pkg
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -64,10 +66,139 @@ func Test_NewDockerBuildConfig(t *testing.T) {
 				Value: "9e2ba52487d945504d250de186cb4fe2e3ba023ed2921dd6ac8b97ed43e76af9",
 			},
 		},
-		BuildConfigPath: io.BuildConfigPath,
+		BuildConfigPath:  io.BuildConfigPath,
+		ContainerRuntime: DockerRuntime,
 	}
 
 	if diff := cmp.Diff(got, want); diff != "" {
 		t.Errorf(diff)
 	}
+
+	io.ContainerRuntime = "lxc"
+	_, err = NewDockerBuildConfig(io)
+	checkError(t, err, &errUnsupportedRuntime{})
+}
+
+func Test_loadBuildConfigFromFile_v2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	config := `version = 2
+artifact_paths = ["dist/**", "*.txt"]
+
+[[steps]]
+command = ["npm", "ci"]
+
+[[steps]]
+command = ["npm", "run", "package"]
+env = ["NODE_ENV=production", "CI=true"]
+workdir = "web"
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadBuildConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("couldn't load config file: %v", err)
+	}
+
+	want := &BuildConfig{
+		Version: BuildConfigV2,
+		Steps: []BuildStep{
+			{Command: []string{"npm", "ci"}},
+			{
+				Command:    []string{"npm", "run", "package"},
+				Env:        []string{"NODE_ENV=production", "CI=true"},
+				WorkingDir: "web",
+			},
+		},
+		ArtifactPaths: []string{"dist/**", "*.txt"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(diff)
+	}
+	if diff := cmp.Diff(want.Steps, got.BuildSteps()); diff != "" {
+		t.Errorf(diff)
+	}
+	if diff := cmp.Diff(want.ArtifactPaths, got.ArtifactPatterns()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func Test_BuildConfig_validate(t *testing.T) {
+	step := BuildStep{Command: []string{"make"}}
+	tests := []struct {
+		name    string
+		config  BuildConfig
+		wantErr bool
+	}{
+		{
+			name:   "version 1",
+			config: BuildConfig{Command: []string{"make"}, ArtifactPath: "bin/*"},
+		},
+		{
+			name:    "version 1 with steps",
+			config:  BuildConfig{Steps: []BuildStep{step}, ArtifactPath: "bin/*"},
+			wantErr: true,
+		},
+		{
+			name:    "version 2 with command",
+			config:  BuildConfig{Version: 2, Command: []string{"make"}, Steps: []BuildStep{step}, ArtifactPaths: []string{"bin/*"}},
+			wantErr: true,
+		},
+		{
+			name:    "no steps",
+			config:  BuildConfig{Version: 2, ArtifactPaths: []string{"bin/*"}},
+			wantErr: true,
+		},
+		{
+			name:    "no artifact paths",
+			config:  BuildConfig{Version: 2, Steps: []BuildStep{step}},
+			wantErr: true,
+		},
+		{
+			name:    "step without command",
+			config:  BuildConfig{Version: 2, Steps: []BuildStep{{WorkingDir: "web"}}, ArtifactPaths: []string{"bin/*"}},
+			wantErr: true,
+		},
+		{
+			name: "invalid env",
+			config: BuildConfig{
+				Version:       2,
+				Steps:         []BuildStep{{Command: []string{"make"}, Env: []string{"=production"}}},
+				ArtifactPaths: []string{"bin/*"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "absolute workdir",
+			config: BuildConfig{
+				Version:       2,
+				Steps:         []BuildStep{{Command: []string{"make"}, WorkingDir: "/etc"}},
+				ArtifactPaths: []string{"bin/*"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "workdir outside the repository",
+			config: BuildConfig{
+				Version:       2,
+				Steps:         []BuildStep{{Command: []string{"make"}, WorkingDir: "web/../.."}},
+				ArtifactPaths: []string{"bin/*"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported version",
+			config:  BuildConfig{Version: 3, Steps: []BuildStep{step}, ArtifactPaths: []string{"bin/*"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
 }
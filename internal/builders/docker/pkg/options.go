@@ -23,6 +23,12 @@ type InputOptions struct {
 	GitCommitHash   string
 	BuilderImage    string
 	ForceCheckout   bool
+	// ContainerRuntime is the name of the container runtime running the
+	// builder image, e.g. `podman`.
+	ContainerRuntime string
+	// Hermetic runs the build without network access and with a read-only
+	// source directory.
+	Hermetic bool
 }
 
 // AddFlags adds input flags to the given command.
@@ -41,4 +47,11 @@ func (io *InputOptions) AddFlags(cmd *cobra.Command) {
 
 	cmd.Flags().BoolVarP(&io.ForceCheckout, "force-checkout", "f", false,
 		"Optional - Forces checking out the source code from the given Git repo.")
+
+	cmd.Flags().StringVar(&io.ContainerRuntime, "container-runtime", DockerRuntime,
+		"Optional - Container runtime running the builder image: docker, podman or nerdctl.")
+
+	cmd.Flags().BoolVar(&io.Hermetic, "hermetic", false,
+		"Optional - Runs the build without network access and with a read-only source directory. "+
+			"The artifacts must be written to /output.")
 }
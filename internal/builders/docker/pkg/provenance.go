@@ -0,0 +1,137 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+// This file contains the generation of the SLSA v1.0 provenance of the
+// artifacts of a docker-based build.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1.0"
+
+	"github.com/slsa-framework/slsa-github-generator/github"
+	"github.com/slsa-framework/slsa-github-generator/slsa"
+)
+
+// logNames are the local names of the stdout and stderr logs of the build in
+// the byproducts of the provenance.
+var logNames = []string{"stdout.log", "stderr.log"}
+
+// DockerBuildType implements slsa.BuildTypeV1 for a docker-based build whose
+// artifacts were built by DockerBuild.BuildArtifacts. The build runs in a
+// GitHub Actions workflow, which is recorded as the invocation of the build.
+type DockerBuildType struct {
+	*slsa.GithubActionsBuild
+	db *DockerBuild
+}
+
+// NewDockerBuildType returns the build type of the docker-based build db,
+// which built the subjects in the workflow run of the context c.
+func NewDockerBuildType(db *DockerBuild, subjects []intoto.Subject, c *github.WorkflowContext) *DockerBuildType {
+	return &DockerBuildType{
+		GithubActionsBuild: slsa.NewGithubActionsBuild(subjects, c),
+		db:                 db,
+	}
+}
+
+// URI implements BuildTypeV1.URI.
+func (b *DockerBuildType) URI() string {
+	return DockerBasedBuildType
+}
+
+// ExternalParameters implements BuildTypeV1.ExternalParameters. They are
+// the external parameters of the build definition.
+func (b *DockerBuildType) ExternalParameters(context.Context) (interface{}, error) {
+	return b.db.CreateBuildDefinition().ExternalParameters, nil
+}
+
+// InternalParameters implements BuildTypeV1.InternalParameters. They are
+// the system parameters of the build definition.
+func (b *DockerBuildType) InternalParameters(context.Context) (interface{}, error) {
+	return b.db.CreateBuildDefinition().SystemParameters, nil
+}
+
+// ResolvedDependencies implements BuildTypeV1.ResolvedDependencies. They are
+// the source commit and the builder image that ran the build, with the
+// digest resolved by the container runtime.
+func (b *DockerBuildType) ResolvedDependencies(context.Context) ([]slsa1.ArtifactReference, error) {
+	if b.db.imageDigest == nil {
+		return nil, fmt.Errorf("the artifacts were not built")
+	}
+	return []slsa1.ArtifactReference{
+		sourceArtifact(b.db.config),
+		{
+			URI:    b.db.config.BuilderImage.ToString(),
+			Digest: b.db.imageDigest.ToMap(),
+		},
+	}, nil
+}
+
+// RunDetails implements BuildTypeV1.RunDetails. It records the workflow run
+// as the invocation ID, the time the steps of the build started and
+// finished, and the logs of the steps as byproducts.
+func (b *DockerBuildType) RunDetails(ctx context.Context) (*slsa1.ProvenanaceRunDetails, error) {
+	rd, err := b.GithubActionsBuild.RunDetails(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.db.imageDigest == nil {
+		return nil, fmt.Errorf("the artifacts were not built")
+	}
+
+	startedOn, finishedOn := b.db.startedOn, b.db.finishedOn
+	rd.BuildMetadata.StartedOn = &startedOn
+	rd.BuildMetadata.FinishedOn = &finishedOn
+
+	for i, path := range b.db.logs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read the log %q: %v", path, err)
+		}
+		sum256 := sha256.Sum256(data)
+		rd.Byproducts = append(rd.Byproducts, slsa1.ArtifactReference{
+			LocalName: logNames[i],
+			Digest:    slsacommon.DigestSet{"sha256": hex.EncodeToString(sum256[:])},
+			MediaType: "text/plain",
+		})
+	}
+	return rd, nil
+}
+
+// GenerateProvenance generates the SLSA v1.0 provenance statement of the
+// subjects built by db in the workflow run of the context c. The builder ID
+// is obtained from the OIDC token of the workflow with the clients of the
+// provider p, or is the default builder ID if p is a slsa.NilClientProvider.
+func GenerateProvenance(ctx context.Context, db *DockerBuild, subjects []intoto.Subject,
+	c *github.WorkflowContext, p slsa.ClientProvider,
+) (*ProvenanceStatementSLSA1, error) {
+	bt := NewDockerBuildType(db, subjects, c)
+	bt.WithClients(p)
+	statement, err := slsa.NewHostedActionsGeneratorV1(bt).WithClients(p).Generate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ProvenanceStatementSLSA1{
+		StatementHeader: statement.StatementHeader,
+		Predicate:       statement.Predicate,
+	}, nil
+}
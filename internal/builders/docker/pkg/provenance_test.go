@@ -0,0 +1,109 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1.0"
+
+	"github.com/slsa-framework/slsa-github-generator/github"
+	"github.com/slsa-framework/slsa-github-generator/slsa"
+)
+
+func Test_GenerateProvenance(t *testing.T) {
+	ctx := context.Background()
+	gh := &github.WorkflowContext{
+		Repository: "slsa-framework/example-package",
+		ServerURL:  "https://github.com",
+		RunID:      "4310284899",
+		RunAttempt: "1",
+	}
+	db := newHermeticBuild(t)
+	db.config.SourceRepo = "git+https://github.com/slsa-framework/example-package"
+	db.config.SourceDigest = Digest{Alg: "sha1", Value: "ca220e54c07b6fcdd758184a12c132ee3ae531f1"}
+
+	// The provenance needs the details of the run.
+	if _, err := GenerateProvenance(ctx, db, nil, gh, &slsa.NilClientProvider{}); err == nil {
+		t.Fatalf("expected an error before the build")
+	}
+
+	subjects, err := db.BuildArtifacts(t.TempDir())
+	if err != nil {
+		t.Fatalf("BuildArtifacts: %v", err)
+	}
+	p, err := GenerateProvenance(ctx, db, subjects, gh, &slsa.NilClientProvider{})
+	if err != nil {
+		t.Fatalf("GenerateProvenance: %v", err)
+	}
+
+	if diff := cmp.Diff(subjects, p.Subject); diff != "" {
+		t.Errorf("unexpected subjects (-want +got):\n%s", diff)
+	}
+	bd := p.Predicate.BuildDefinition
+	if bd.BuildType != DockerBasedBuildType {
+		t.Errorf("unexpected build type: %q", bd.BuildType)
+	}
+	if diff := cmp.Diff(db.CreateBuildDefinition().ExternalParameters, bd.ExternalParameters); diff != "" {
+		t.Errorf("unexpected external parameters (-want +got):\n%s", diff)
+	}
+	wantDeps := []slsa1.ArtifactReference{
+		{
+			URI:    "git+https://github.com/slsa-framework/example-package",
+			Digest: map[string]string{"sha1": "ca220e54c07b6fcdd758184a12c132ee3ae531f1"},
+		},
+		{
+			URI:    "bash@sha256:" + testImageDigest,
+			Digest: map[string]string{"sha256": testImageDigest},
+		},
+	}
+	if diff := cmp.Diff(wantDeps, bd.ResolvedDependencies); diff != "" {
+		t.Errorf("unexpected resolved dependencies (-want +got):\n%s", diff)
+	}
+
+	rd := p.Predicate.RunDetails
+	if rd.Builder.ID != slsa.GithubHostedActionsBuilderID {
+		t.Errorf("unexpected builder ID: %q", rd.Builder.ID)
+	}
+	md := rd.BuildMetadata
+	if md.InvocationID != "4310284899-1" {
+		t.Errorf("unexpected invocation ID: %q", md.InvocationID)
+	}
+	if md.StartedOn == nil || md.FinishedOn == nil || md.FinishedOn.Before(*md.StartedOn) {
+		t.Errorf("unexpected timestamps: %v, %v", md.StartedOn, md.FinishedOn)
+	}
+	var logs []string
+	for _, b := range rd.Byproducts {
+		if b.Digest["sha256"] == "" {
+			t.Errorf("no digest for byproduct %q", b.LocalName)
+		}
+		logs = append(logs, b.LocalName)
+	}
+	if diff := cmp.Diff([]string{"stdout.log", "stderr.log"}, logs); diff != "" {
+		t.Errorf("unexpected byproducts (-want +got):\n%s", diff)
+	}
+
+	// The provenance can be verified.
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseProvenance(bytes); err != nil {
+		t.Errorf("ParseProvenance: %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+// This file contains the container runtimes used for running the builder
+// image: Docker, Podman and nerdctl. They are used through their command
+// line interfaces, which are mostly compatible with the one of Docker.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+const (
+	// DockerRuntime is the name of the Docker container runtime.
+	DockerRuntime = "docker"
+	// PodmanRuntime is the name of the Podman container runtime.
+	PodmanRuntime = "podman"
+	// NerdctlRuntime is the name of the nerdctl container runtime, i.e. the
+	// containerd CLI.
+	NerdctlRuntime = "nerdctl"
+)
+
+// errUnsupportedRuntime indicates an unknown container runtime.
+type errUnsupportedRuntime struct {
+	errors.WrappableError
+}
+
+// errRuntimeCommand indicates a failed command of the container runtime.
+type errRuntimeCommand struct {
+	errors.WrappableError
+}
+
+// ContainerRuntime runs the builder image with a container engine.
+type ContainerRuntime interface {
+	// Name returns the name of the runtime, e.g. `docker`.
+	Name() string
+
+	// Version returns the version of the runtime.
+	Version() (string, error)
+
+	// RunFlags returns the flags of the `run` command for the options.
+	RunFlags(opts *RunOptions) []string
+
+	// ImageDigest returns the digest of the local image.
+	ImageDigest(image string) (*Digest, error)
+
+	// Run runs the command in the image with the options, and streams the
+	// output of the command to stdout and stderr.
+	Run(image string, command []string, opts *RunOptions, stdout, stderr io.Writer) error
+}
+
+// RunOptions are the options of running the builder image.
+type RunOptions struct {
+	// SourceDir is the directory mounted as the working directory of the
+	// container, i.e. `/workspace`.
+	SourceDir string
+
+	// Hermetic runs the command without network access and with the source
+	// directory mounted read-only. The command can only write its outputs
+	// to OutputDir, which is mounted as `/output`. The capabilities of the
+	// container are dropped, and SeccompProfile is applied.
+	Hermetic bool
+
+	// OutputDir is the directory mounted as `/output` in hermetic runs.
+	OutputDir string
+
+	// SeccompProfile is the path of the seccomp profile of hermetic runs.
+	SeccompProfile string
+
+	// User is the user the command runs as in hermetic runs, in the form
+	// UID:GID. It is the owner of the mounted directories on the host,
+	// whose permissions cannot be bypassed without capabilities. Podman
+	// maps the host user instead.
+	User string
+
+	// WorkingDir is the working directory of the command, relative to
+	// `/workspace`.
+	WorkingDir string
+
+	// Env are the env variables of the command, in the form NAME=VALUE.
+	Env []string
+}
+
+// ContainerRuntimeInfo identifies the container runtime of a build.
+type ContainerRuntimeInfo struct {
+	// Name is the name of the runtime, e.g. `podman`.
+	Name string `json:"name"`
+
+	// Version is the version of the runtime, e.g. `4.4.1`.
+	Version string `json:"version"`
+}
+
+// NewContainerRuntime returns the container runtime with the given name. The
+// runtime binary is looked up in the PATH when it is used.
+func NewContainerRuntime(name string) (ContainerRuntime, error) {
+	switch name {
+	case DockerRuntime:
+		return &dockerRuntime{cliRuntime{binary: DockerRuntime}}, nil
+	case PodmanRuntime:
+		return &podmanRuntime{cliRuntime{binary: PodmanRuntime}}, nil
+	case NerdctlRuntime:
+		return &nerdctlRuntime{cliRuntime{binary: NerdctlRuntime}}, nil
+	default:
+		return nil, errors.Errorf(&errUnsupportedRuntime{},
+			"unsupported container runtime %q: must be %q, %q or %q", name, DockerRuntime, PodmanRuntime, NerdctlRuntime)
+	}
+}
+
+// runtimeInfo returns the name and version of the runtime.
+func runtimeInfo(r ContainerRuntime) (*ContainerRuntimeInfo, error) {
+	v, err := r.Version()
+	if err != nil {
+		return nil, err
+	}
+	return &ContainerRuntimeInfo{
+		Name:    r.Name(),
+		Version: v,
+	}, nil
+}
+
+// cliRuntime runs the commands of the CLI of a container runtime.
+type cliRuntime struct {
+	// binary is the name or path of the CLI.
+	binary string
+}
+
+// output runs the CLI with args and returns its trimmed output.
+func (c *cliRuntime) output(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	//#nosec G204 -- The binary is one of the supported runtimes.
+	cmd := exec.Command(c.binary, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Errorf(&errRuntimeCommand{}, "%s %s: %v: %s",
+			c.binary, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// stream runs the CLI with args and copies its output to stdout and stderr
+// while it runs.
+func (c *cliRuntime) stream(args []string, stdout, stderr io.Writer) error {
+	//#nosec G204 -- The arguments are generated by the runtime.
+	cmd := exec.Command(c.binary, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	log.Printf("Running command: %q.", cmd.String())
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf(&errRuntimeCommand{}, "%s run: %v", c.binary, err)
+	}
+	return nil
+}
+
+// hermeticFlags returns the flags of the `run` command isolating hermetic
+// runs, which are supported by all the runtimes.
+func hermeticFlags(opts *RunOptions) []string {
+	return []string{
+		"--network=none",
+		"--cap-drop=ALL",
+		"--security-opt=no-new-privileges",
+		fmt.Sprintf("--security-opt=seccomp=%s", opts.SeccompProfile),
+	}
+}
+
+// userFlags returns the flags of the `run` command running hermetic runs
+// as the host user, for the runtimes that run the container as root.
+func userFlags(opts *RunOptions) []string {
+	if opts.User == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("--user=%s", opts.User)}
+}
+
+// workdirFlag returns the flag of the `run` command setting the working
+// directory of the command.
+func workdirFlag(opts *RunOptions) string {
+	return fmt.Sprintf("--workdir=%s", path.Join("/workspace", opts.WorkingDir))
+}
+
+// envFlags returns the flags of the `run` command setting the env variables
+// of the command, which are supported by all the runtimes.
+func envFlags(opts *RunOptions) []string {
+	var flags []string
+	for _, e := range opts.Env {
+		flags = append(flags, fmt.Sprintf("--env=%s", e))
+	}
+	return flags
+}
+
+// runArgs returns the arguments of the `run` command of the runtime r.
+func runArgs(r ContainerRuntime, image string, command []string, opts *RunOptions) []string {
+	args := append([]string{"run"}, r.RunFlags(opts)...)
+	args = append(args, image)
+	return append(args, command...)
+}
+
+// repoDigest returns the digest of the image in the JSON list of repo
+// digests of `image inspect`, e.g. `["bash@sha256:abc"]`.
+func repoDigest(image, repoDigests string) (*Digest, error) {
+	var digests []string
+	if err := json.Unmarshal([]byte(repoDigests), &digests); err != nil {
+		return nil, errors.Errorf(&errRuntimeCommand{}, "parsing repo digests %q: %v", repoDigests, err)
+	}
+
+	name, _, _ := strings.Cut(image, "@")
+	for _, d := range digests {
+		n, digest, ok := strings.Cut(d, "@")
+		if !ok || !sameRepository(n, name) {
+			continue
+		}
+		return validateDigest(digest)
+	}
+	return nil, errors.Errorf(&errRuntimeCommand{}, "no repo digest for %q in %q", image, repoDigests)
+}
+
+// sameRepository returns true if the repository names a and b are equal,
+// ignoring the default registry and namespace of Docker Hub.
+func sameRepository(a, b string) bool {
+	normalize := func(n string) string {
+		n = strings.TrimPrefix(n, "docker.io/")
+		return strings.TrimPrefix(n, "library/")
+	}
+	return normalize(a) == normalize(b)
+}
+
+// dockerRuntime runs the builder image with Docker.
+type dockerRuntime struct {
+	cliRuntime
+}
+
+// Name implements ContainerRuntime.Name.
+func (r *dockerRuntime) Name() string {
+	return DockerRuntime
+}
+
+// Version implements ContainerRuntime.Version. It is the version of the
+// Docker engine.
+func (r *dockerRuntime) Version() (string, error) {
+	return r.output("version", "--format", "{{.Server.Version}}")
+}
+
+// RunFlags implements ContainerRuntime.RunFlags.
+func (r *dockerRuntime) RunFlags(opts *RunOptions) []string {
+	if opts.Hermetic {
+		flags := []string{
+			fmt.Sprintf("--volume=%s:/workspace:ro", opts.SourceDir),
+			fmt.Sprintf("--volume=%s:/output", opts.OutputDir),
+			workdirFlag(opts),
+			"--rm",
+		}
+		flags = append(append(flags, userFlags(opts)...), hermeticFlags(opts)...)
+		return append(flags, envFlags(opts)...)
+	}
+	flags := []string{
+		// Mount the directory to workspace.
+		fmt.Sprintf("--volume=%s:/workspace", opts.SourceDir),
+		workdirFlag(opts),
+		// Remove the container file system after the container exits.
+		"--rm",
+	}
+	return append(flags, envFlags(opts)...)
+}
+
+// ImageDigest implements ContainerRuntime.ImageDigest.
+func (r *dockerRuntime) ImageDigest(image string) (*Digest, error) {
+	out, err := r.output("image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	if err != nil {
+		return nil, err
+	}
+	return repoDigest(image, out)
+}
+
+// Run implements ContainerRuntime.Run. The output of the container is
+// attached to the output of `docker run`.
+func (r *dockerRuntime) Run(image string, command []string, opts *RunOptions, stdout, stderr io.Writer) error {
+	return r.stream(runArgs(r, image, command, opts), stdout, stderr)
+}
+
+// podmanRuntime runs the builder image with Podman, which is usually
+// rootless.
+type podmanRuntime struct {
+	cliRuntime
+}
+
+// Name implements ContainerRuntime.Name.
+func (r *podmanRuntime) Name() string {
+	return PodmanRuntime
+}
+
+// Version implements ContainerRuntime.Version. Podman has no daemon, so it
+// is the version of the client.
+func (r *podmanRuntime) Version() (string, error) {
+	return r.output("version", "--format", "{{.Client.Version}}")
+}
+
+// RunFlags implements ContainerRuntime.RunFlags.
+func (r *podmanRuntime) RunFlags(opts *RunOptions) []string {
+	if opts.Hermetic {
+		flags := []string{
+			fmt.Sprintf("--volume=%s:/workspace:ro,Z", opts.SourceDir),
+			fmt.Sprintf("--volume=%s:/output:Z", opts.OutputDir),
+			workdirFlag(opts),
+			"--userns=keep-id",
+			"--rm",
+		}
+		return append(append(flags, hermeticFlags(opts)...), envFlags(opts)...)
+	}
+	flags := []string{
+		// Mount the directory to workspace, and relabel it for SELinux
+		// hosts.
+		fmt.Sprintf("--volume=%s:/workspace:Z", opts.SourceDir),
+		workdirFlag(opts),
+		// Map the user of the rootless host to the same user in the
+		// container, so that the artifacts are owned by the host user.
+		"--userns=keep-id",
+		// Remove the container file system after the container exits.
+		"--rm",
+	}
+	return append(flags, envFlags(opts)...)
+}
+
+// ImageDigest implements ContainerRuntime.ImageDigest. It is the digest of
+// the manifest the image was pulled by.
+func (r *podmanRuntime) ImageDigest(image string) (*Digest, error) {
+	out, err := r.output("image", "inspect", "--format", "{{.Digest}}", image)
+	if err != nil {
+		return nil, err
+	}
+	return validateDigest(out)
+}
+
+// Run implements ContainerRuntime.Run. The output of the container is
+// attached to the output of `podman run` by conmon.
+func (r *podmanRuntime) Run(image string, command []string, opts *RunOptions, stdout, stderr io.Writer) error {
+	return r.stream(runArgs(r, image, command, opts), stdout, stderr)
+}
+
+// nerdctlRuntime runs the builder image with containerd through nerdctl.
+type nerdctlRuntime struct {
+	cliRuntime
+}
+
+// Name implements ContainerRuntime.Name.
+func (r *nerdctlRuntime) Name() string {
+	return NerdctlRuntime
+}
+
+// Version implements ContainerRuntime.Version. It is the version of the
+// nerdctl client, as the version of containerd depends on the host.
+func (r *nerdctlRuntime) Version() (string, error) {
+	return r.output("version", "--format", "{{.Client.Version}}")
+}
+
+// RunFlags implements ContainerRuntime.RunFlags.
+func (r *nerdctlRuntime) RunFlags(opts *RunOptions) []string {
+	if opts.Hermetic {
+		flags := []string{
+			fmt.Sprintf("--volume=%s:/workspace:ro", opts.SourceDir),
+			fmt.Sprintf("--volume=%s:/output", opts.OutputDir),
+			workdirFlag(opts),
+			"--rm",
+		}
+		flags = append(append(flags, userFlags(opts)...), hermeticFlags(opts)...)
+		return append(flags, envFlags(opts)...)
+	}
+	flags := []string{
+		// Mount the directory to workspace.
+		fmt.Sprintf("--volume=%s:/workspace", opts.SourceDir),
+		workdirFlag(opts),
+		// Remove the container after it exits.
+		"--rm",
+	}
+	return append(flags, envFlags(opts)...)
+}
+
+// ImageDigest implements ContainerRuntime.ImageDigest.
+func (r *nerdctlRuntime) ImageDigest(image string) (*Digest, error) {
+	out, err := r.output("image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	if err != nil {
+		return nil, err
+	}
+	return repoDigest(image, out)
+}
+
+// Run implements ContainerRuntime.Run. The output of the container is
+// attached to the output of `nerdctl run`.
+func (r *nerdctlRuntime) Run(image string, command []string, opts *RunOptions, stdout, stderr io.Writer) error {
+	return r.stream(runArgs(r, image, command, opts), stdout, stderr)
+}
@@ -0,0 +1,276 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testImageDigest = "9e2ba52487d945504d250de186cb4fe2e3ba023ed2921dd6ac8b97ed43e76af9"
+
+// fakeRuntimeScript is a fake container runtime CLI. It records its
+// arguments in the file `args` next to it and prints canned outputs.
+const fakeRuntimeScript = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args"
+case "$1 $2" in
+"version --format") echo " 4.4.1 " ;;
+"image inspect")
+	case "$4" in
+	*RepoDigests*) echo '["docker.io/library/bash@sha256:` + testImageDigest + `"]' ;;
+	*) echo "sha256:` + testImageDigest + `" ;;
+	esac ;;
+"run "*) echo "container output"; echo "container error" >&2 ;;
+*) echo "unexpected command" >&2; exit 1 ;;
+esac
+`
+
+// newFakeCLI writes the fake runtime CLI and returns its path.
+func newFakeCLI(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "runtime")
+	if err := os.WriteFile(path, []byte(fakeRuntimeScript), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fakeCLIArgs returns the recorded arguments of the calls to the fake CLI.
+func fakeCLIArgs(t *testing.T, path string) []string {
+	b, err := os.ReadFile(filepath.Join(filepath.Dir(path), "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+// newFakeRuntime returns the runtime with the given name using the fake CLI
+// at path.
+func newFakeRuntime(t *testing.T, name, path string) ContainerRuntime {
+	switch name {
+	case DockerRuntime:
+		return &dockerRuntime{cliRuntime{binary: path}}
+	case PodmanRuntime:
+		return &podmanRuntime{cliRuntime{binary: path}}
+	case NerdctlRuntime:
+		return &nerdctlRuntime{cliRuntime{binary: path}}
+	}
+	t.Fatalf("unknown runtime %q", name)
+	return nil
+}
+
+func Test_NewContainerRuntime(t *testing.T) {
+	for _, name := range []string{DockerRuntime, PodmanRuntime, NerdctlRuntime} {
+		r, err := NewContainerRuntime(name)
+		if err != nil {
+			t.Fatalf("NewContainerRuntime(%q): %v", name, err)
+		}
+		if r.Name() != name {
+			t.Errorf("unexpected name, got: %q, want: %q", r.Name(), name)
+		}
+	}
+
+	_, err := NewContainerRuntime("lxc")
+	checkError(t, err, &errUnsupportedRuntime{})
+}
+
+func Test_ContainerRuntime(t *testing.T) {
+	tests := []struct {
+		name     string
+		runtime  string
+		wantArgs []string
+	}{
+		{
+			name:    "docker",
+			runtime: DockerRuntime,
+			wantArgs: []string{
+				"version --format {{.Server.Version}}",
+				"run --volume=/src:/workspace --workdir=/workspace --rm bash@sha256:" + testImageDigest + " make all",
+				"image inspect --format {{json .RepoDigests}} bash@sha256:" + testImageDigest,
+			},
+		},
+		{
+			name:    "podman",
+			runtime: PodmanRuntime,
+			wantArgs: []string{
+				"version --format {{.Client.Version}}",
+				"run --volume=/src:/workspace:Z --workdir=/workspace --userns=keep-id --rm bash@sha256:" + testImageDigest + " make all",
+				"image inspect --format {{.Digest}} bash@sha256:" + testImageDigest,
+			},
+		},
+		{
+			name:    "nerdctl",
+			runtime: NerdctlRuntime,
+			wantArgs: []string{
+				"version --format {{.Client.Version}}",
+				"run --volume=/src:/workspace --workdir=/workspace --rm bash@sha256:" + testImageDigest + " make all",
+				"image inspect --format {{json .RepoDigests}} bash@sha256:" + testImageDigest,
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			cli := newFakeCLI(t)
+			r := newFakeRuntime(t, tt.runtime, cli)
+			image := "bash@sha256:" + testImageDigest
+
+			info, err := runtimeInfo(r)
+			if err != nil {
+				t.Fatalf("runtimeInfo: %v", err)
+			}
+			if diff := cmp.Diff(&ContainerRuntimeInfo{Name: tt.runtime, Version: "4.4.1"}, info); diff != "" {
+				t.Errorf("unexpected runtime info (-want +got):\n%s", diff)
+			}
+
+			var stdout, stderr bytes.Buffer
+			if err := r.Run(image, []string{"make", "all"}, &RunOptions{SourceDir: "/src"}, &stdout, &stderr); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if stdout.String() != "container output\n" || stderr.String() != "container error\n" {
+				t.Errorf("unexpected output: %q, %q", stdout.String(), stderr.String())
+			}
+
+			digest, err := r.ImageDigest(image)
+			if err != nil {
+				t.Fatalf("ImageDigest: %v", err)
+			}
+			if diff := cmp.Diff(&Digest{Alg: "sha256", Value: testImageDigest}, digest); diff != "" {
+				t.Errorf("unexpected digest (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.wantArgs, fakeCLIArgs(t, cli)); diff != "" {
+				t.Errorf("unexpected commands (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_ContainerRuntime_RunFlags_hermetic(t *testing.T) {
+	opts := &RunOptions{
+		SourceDir:      "/src",
+		Hermetic:       true,
+		OutputDir:      "/out",
+		SeccompProfile: "/seccomp.json",
+		User:           "1001:121",
+	}
+	isolation := []string{
+		"--network=none",
+		"--cap-drop=ALL",
+		"--security-opt=no-new-privileges",
+		"--security-opt=seccomp=/seccomp.json",
+	}
+
+	tests := []struct {
+		runtime  string
+		expected []string
+	}{
+		{
+			runtime: DockerRuntime,
+			expected: append([]string{
+				"--volume=/src:/workspace:ro", "--volume=/out:/output", "--workdir=/workspace", "--rm",
+				"--user=1001:121",
+			}, isolation...),
+		},
+		{
+			runtime: PodmanRuntime,
+			expected: append([]string{
+				"--volume=/src:/workspace:ro,Z", "--volume=/out:/output:Z", "--workdir=/workspace",
+				"--userns=keep-id", "--rm",
+			}, isolation...),
+		},
+		{
+			runtime: NerdctlRuntime,
+			expected: append([]string{
+				"--volume=/src:/workspace:ro", "--volume=/out:/output", "--workdir=/workspace", "--rm",
+				"--user=1001:121",
+			}, isolation...),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.runtime, func(t *testing.T) {
+			r, err := NewContainerRuntime(tt.runtime)
+			if err != nil {
+				t.Fatalf("NewContainerRuntime: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, r.RunFlags(opts)); diff != "" {
+				t.Errorf("unexpected flags (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_ContainerRuntime_commandError(t *testing.T) {
+	r := &dockerRuntime{cliRuntime{binary: filepath.Join(t.TempDir(), "missing")}}
+
+	_, err := r.Version()
+	checkError(t, err, &errRuntimeCommand{})
+
+	err = r.Run("bash", []string{"true"}, &RunOptions{SourceDir: "/src"}, &bytes.Buffer{}, &bytes.Buffer{})
+	checkError(t, err, &errRuntimeCommand{})
+}
+
+func Test_repoDigest(t *testing.T) {
+	tests := []struct {
+		name        string
+		image       string
+		repoDigests string
+		expected    *Digest
+	}{
+		{
+			name:        "docker hub image",
+			image:       "bash@sha256:abc",
+			repoDigests: `["docker.io/library/bash@sha256:abc"]`,
+			expected:    &Digest{Alg: "sha256", Value: "abc"},
+		},
+		{
+			name:        "several repositories",
+			image:       "ghcr.io/org/builder@sha256:def",
+			repoDigests: `["bash@sha256:abc", "ghcr.io/org/builder@sha256:def"]`,
+			expected:    &Digest{Alg: "sha256", Value: "def"},
+		},
+		{
+			name:        "other repository",
+			image:       "ghcr.io/org/builder@sha256:def",
+			repoDigests: `["bash@sha256:abc"]`,
+		},
+		{
+			name:        "invalid JSON",
+			image:       "bash@sha256:abc",
+			repoDigests: `<no value>`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repoDigest(tt.image, tt.repoDigests)
+			if tt.expected == nil {
+				checkError(t, err, &errRuntimeCommand{})
+				return
+			}
+			if err != nil {
+				t.Fatalf("repoDigest: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("unexpected digest (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
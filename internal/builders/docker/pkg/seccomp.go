@@ -0,0 +1,121 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// defaultSeccompProfile is the default seccomp profile of Docker v20.10.20,
+// copied from github.com/docker/docker/profiles/seccomp/default.json.
+//
+//go:embed seccomp_default.json
+var defaultSeccompProfile []byte
+
+// hermeticDeniedSyscalls are the syscalls allowed by the default profile of
+// Docker that are denied in hermetic builds: the syscalls of io_uring and of
+// the new mount API.
+var hermeticDeniedSyscalls = map[string]bool{
+	"fsconfig":          true,
+	"fsmount":           true,
+	"fsopen":            true,
+	"fspick":            true,
+	"io_uring_enter":    true,
+	"io_uring_register": true,
+	"io_uring_setup":    true,
+	"mount_setattr":     true,
+	"move_mount":        true,
+	"open_tree":         true,
+}
+
+// seccompProfile is a seccomp profile in the format of the container
+// runtimes, see https://docs.docker.com/engine/security/seccomp/. The
+// conditions of the rules are kept as is.
+type seccompProfile struct {
+	DefaultAction   string          `json:"defaultAction"`
+	DefaultErrnoRet *uint           `json:"defaultErrnoRet,omitempty"`
+	ArchMap         json.RawMessage `json:"archMap,omitempty"`
+	Syscalls        []seccompRule   `json:"syscalls"`
+}
+
+// seccompRule is the action of a seccomp profile for a set of syscalls,
+// possibly restricted by the values of their arguments, the architecture,
+// the capabilities of the container or the version of the kernel.
+type seccompRule struct {
+	Names    []string        `json:"names"`
+	Action   string          `json:"action"`
+	ErrnoRet *uint           `json:"errnoRet,omitempty"`
+	Args     json.RawMessage `json:"args,omitempty"`
+	Includes json.RawMessage `json:"includes,omitempty"`
+	Excludes json.RawMessage `json:"excludes,omitempty"`
+}
+
+// hermeticSeccompProfile returns the seccomp profile of hermetic builds. It
+// is the default profile of Docker, which it replaces, without the rules
+// allowing hermeticDeniedSyscalls. Like all the syscalls not allowed by the
+// default profile, they fail with EPERM.
+func hermeticSeccompProfile() (*seccompProfile, error) {
+	var p seccompProfile
+	if err := json.Unmarshal(defaultSeccompProfile, &p); err != nil {
+		return nil, fmt.Errorf("couldn't parse the default seccomp profile: %v", err)
+	}
+	if p.DefaultAction != "SCMP_ACT_ERRNO" {
+		return nil, fmt.Errorf("unexpected default action of the default seccomp profile: %q", p.DefaultAction)
+	}
+
+	var syscalls []seccompRule
+	for _, rule := range p.Syscalls {
+		if rule.Action == "SCMP_ACT_ALLOW" {
+			var names []string
+			for _, name := range rule.Names {
+				if !hermeticDeniedSyscalls[name] {
+					names = append(names, name)
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			rule.Names = names
+		}
+		syscalls = append(syscalls, rule)
+	}
+	p.Syscalls = syscalls
+	return &p, nil
+}
+
+// writeSeccompProfile writes the seccomp profile of hermetic builds to a
+// temp file and returns its path. The caller must remove the file.
+func writeSeccompProfile() (string, error) {
+	p, err := hermeticSeccompProfile()
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("couldn't marshal the seccomp profile: %v", err)
+	}
+	f, err := os.CreateTemp("", "seccomp-*.json")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create tempfile: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return "", fmt.Errorf("couldn't write the seccomp profile: %v", err)
+	}
+	return f.Name(), nil
+}
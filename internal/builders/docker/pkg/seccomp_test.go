@@ -0,0 +1,82 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func Test_hermeticSeccompProfile(t *testing.T) {
+	path, err := writeSeccompProfile()
+	if err != nil {
+		t.Fatalf("writeSeccompProfile: %v", err)
+	}
+	defer os.Remove(path)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p struct {
+		DefaultAction string `json:"defaultAction"`
+		Syscalls      []struct {
+			Names  []string `json:"names"`
+			Action string   `json:"action"`
+			Args   []struct {
+				Index uint   `json:"index"`
+				Value uint64 `json:"value"`
+				Op    string `json:"op"`
+			} `json:"args"`
+		} `json:"syscalls"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		t.Fatalf("invalid seccomp profile: %v", err)
+	}
+	if p.DefaultAction != "SCMP_ACT_ERRNO" {
+		t.Errorf("unexpected default action: %q", p.DefaultAction)
+	}
+
+	allowed := make(map[string]bool)
+	filtered := make(map[string]bool)
+	for _, rule := range p.Syscalls {
+		if rule.Action != "SCMP_ACT_ALLOW" {
+			continue
+		}
+		for _, name := range rule.Names {
+			allowed[name] = true
+			if len(rule.Args) > 0 {
+				filtered[name] = true
+			}
+		}
+	}
+	for name := range hermeticDeniedSyscalls {
+		if allowed[name] {
+			t.Errorf("syscall %q is allowed", name)
+		}
+	}
+	for _, name := range []string{"read", "write", "execve"} {
+		if !allowed[name] {
+			t.Errorf("syscall %q is not allowed", name)
+		}
+	}
+	// The argument filters of the default profile are kept.
+	for _, name := range []string{"clone", "personality"} {
+		if !filtered[name] {
+			t.Errorf("syscall %q is not filtered by its arguments", name)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+// This file contains the verification of the subjects of a provenance against
+// the artifacts of a rebuild.
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"path/filepath"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+)
+
+// subjectHashes are the digest algorithms of the subjects that can be
+// verified.
+var subjectHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// SubjectResult is the result of the verification of a subject, or of a
+// rebuilt artifact that is not a subject.
+type SubjectResult struct {
+	// Name is the name of the subject in the provenance, or the path of the
+	// rebuilt artifact relative to the root of the source repository.
+	Name string `json:"name"`
+	// Artifact is the path of the rebuilt artifact matching the subject if it
+	// differs from the name of the subject.
+	Artifact string `json:"artifact,omitempty"`
+	// Expected is the digest of the subject in the provenance.
+	Expected slsacommon.DigestSet `json:"expected,omitempty"`
+	// Actual is the digest of the rebuilt artifact, using the algorithms of
+	// the expected digest.
+	Actual slsacommon.DigestSet `json:"actual,omitempty"`
+}
+
+// VerificationReport is the machine-readable result of the comparison of the
+// subjects of a provenance with the rebuilt artifacts.
+type VerificationReport struct {
+	// LegacyBasenames is set if subjects named after a basename were matched
+	// to the artifacts with that basename.
+	LegacyBasenames bool `json:"legacyBasenames"`
+	// Matched are the subjects whose digests match the rebuilt artifacts.
+	Matched []SubjectResult `json:"matched"`
+	// Missing are the subjects that were not rebuilt.
+	Missing []SubjectResult `json:"missing"`
+	// Unexpected are the rebuilt artifacts that are not subjects.
+	Unexpected []SubjectResult `json:"unexpected"`
+	// DigestMismatched are the subjects whose digests do not match the
+	// rebuilt artifacts.
+	DigestMismatched []SubjectResult `json:"digestMismatched"`
+}
+
+// OK returns true if all the subjects match the rebuilt artifacts, and all
+// the rebuilt artifacts are subjects.
+func (r *VerificationReport) OK() bool {
+	return len(r.Matched) > 0 && len(r.Missing) == 0 && len(r.Unexpected) == 0 &&
+		len(r.DigestMismatched) == 0
+}
+
+// String returns a summary of the report.
+func (r *VerificationReport) String() string {
+	return fmt.Sprintf("%d matched, %d missing, %d unexpected, %d digest-mismatched subjects",
+		len(r.Matched), len(r.Missing), len(r.Unexpected), len(r.DigestMismatched))
+}
+
+// CompareSubjects compares the subjects of a provenance with the artifacts
+// rebuilt in the folder dir, as returned by BuildArtifacts. Subjects are
+// matched to the artifacts by their path relative to the root of the source
+// repository. If legacyBasenames is set, the subjects named after a basename,
+// as in older provenances, are also matched to the only remaining artifact
+// with that basename. The digests of the artifacts are computed with each
+// supported algorithm of the digests of the subjects, which must include at
+// least one.
+func CompareSubjects(subjects, artifacts []intoto.Subject, dir string, legacyBasenames bool) (*VerificationReport, error) {
+	byName := make(map[string]intoto.Subject)
+	byBase := make(map[string][]string)
+	for _, a := range artifacts {
+		byName[a.Name] = a
+		base := path.Base(a.Name)
+		byBase[base] = append(byBase[base], a.Name)
+	}
+
+	// Match the subjects by name first, so that the basenames only match the
+	// remaining artifacts.
+	names := make([]string, len(subjects))
+	used := make(map[string]bool)
+	for i, s := range subjects {
+		if _, ok := byName[s.Name]; ok && !used[s.Name] {
+			names[i] = s.Name
+			used[s.Name] = true
+		}
+	}
+	for i, s := range subjects {
+		if !legacyBasenames || names[i] != "" || path.Base(s.Name) != s.Name {
+			continue
+		}
+		var candidates []string
+		for _, name := range byBase[s.Name] {
+			if !used[name] {
+				candidates = append(candidates, name)
+			}
+		}
+		if len(candidates) == 1 {
+			names[i] = candidates[0]
+			used[candidates[0]] = true
+		}
+	}
+
+	report := &VerificationReport{
+		LegacyBasenames:  legacyBasenames,
+		Matched:          []SubjectResult{},
+		Missing:          []SubjectResult{},
+		Unexpected:       []SubjectResult{},
+		DigestMismatched: []SubjectResult{},
+	}
+	for i, s := range subjects {
+		result := SubjectResult{Name: s.Name, Expected: s.Digest}
+		if names[i] == "" {
+			report.Missing = append(report.Missing, result)
+			continue
+		}
+		if names[i] != s.Name {
+			result.Artifact = names[i]
+		}
+
+		actual, err := digestArtifact(filepath.Join(dir, filepath.FromSlash(names[i])), s.Digest)
+		if err != nil {
+			return nil, err
+		}
+		result.Actual = actual
+		if len(actual) == 0 {
+			return nil, fmt.Errorf("no supported digest algorithm for subject %q", s.Name)
+		}
+		if digestsMatch(s.Digest, actual) {
+			report.Matched = append(report.Matched, result)
+		} else {
+			report.DigestMismatched = append(report.DigestMismatched, result)
+		}
+	}
+	for _, a := range artifacts {
+		if !used[a.Name] {
+			report.Unexpected = append(report.Unexpected, SubjectResult{Name: a.Name, Actual: a.Digest})
+			// Only the first of duplicate artifacts is reported.
+			used[a.Name] = true
+		}
+	}
+	return report, nil
+}
+
+// digestArtifact returns the digest of the file with the supported algorithms
+// of the expected digest.
+func digestArtifact(file string, expected slsacommon.DigestSet) (slsacommon.DigestSet, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read file %q: %v", file, err)
+	}
+	actual := make(slsacommon.DigestSet)
+	for alg := range expected {
+		newHash, ok := subjectHashes[alg]
+		if !ok {
+			continue
+		}
+		h := newHash()
+		h.Write(data)
+		actual[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+	return actual, nil
+}
+
+// digestsMatch returns true if the expected digest has the same value as
+// the actual digest for each algorithm of the actual digest.
+func digestsMatch(expected, actual slsacommon.DigestSet) bool {
+	for alg, value := range actual {
+		if expected[alg] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify rebuilds the artifacts of the provenance p and compares them with
+// its subjects, matching basenames if legacyBasenames is set. The build
+// configuration of the source repository must be the one recorded in the
+// provenance.
+func (db *DockerBuild) Verify(p *ProvenanceStatementSLSA1, legacyBasenames bool) (*VerificationReport, error) {
+	if err := db.VerifyBuildConfig(p); err != nil {
+		return nil, err
+	}
+
+	outputFolder, err := os.MkdirTemp("", "artifacts")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(outputFolder)
+
+	artifacts, err := db.BuildArtifacts(outputFolder)
+	if err != nil {
+		return nil, fmt.Errorf("building the artifacts: %w", err)
+	}
+	return CompareSubjects(p.Subject, artifacts, outputFolder, legacyBasenames)
+}
@@ -0,0 +1,278 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1.0"
+)
+
+// testDigests returns the sha256 and sha512 digests of data.
+func testDigests(data string) slsacommon.DigestSet {
+	sum256 := sha256.Sum256([]byte(data))
+	sum512 := sha512.Sum512([]byte(data))
+	return slsacommon.DigestSet{
+		"sha256": hex.EncodeToString(sum256[:]),
+		"sha512": hex.EncodeToString(sum512[:]),
+	}
+}
+
+func Test_CompareSubjects(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"dist/a.txt": "a\n", "b.txt": "b\n"}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := testDigests("a\n"), testDigests("b\n")
+	sha256Only := slsacommon.DigestSet{"sha256": b["sha256"]}
+	artifacts := []intoto.Subject{
+		{Name: "dist/a.txt", Digest: slsacommon.DigestSet{"sha256": a["sha256"]}},
+		{Name: "b.txt", Digest: slsacommon.DigestSet{"sha256": b["sha256"]}},
+	}
+
+	tests := []struct {
+		name     string
+		subjects []intoto.Subject
+		legacy   bool
+		expected *VerificationReport
+		ok       bool
+		err      bool
+	}{
+		{
+			name: "matched",
+			subjects: []intoto.Subject{
+				{Name: "dist/a.txt", Digest: a},
+				{Name: "b.txt", Digest: sha256Only},
+			},
+			expected: &VerificationReport{
+				Matched: []SubjectResult{
+					{Name: "dist/a.txt", Expected: a, Actual: a},
+					{Name: "b.txt", Expected: sha256Only, Actual: sha256Only},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "unsupported algorithms are ignored",
+			subjects: []intoto.Subject{
+				{Name: "dist/a.txt", Digest: slsacommon.DigestSet{"sha256": a["sha256"], "md5": "0"}},
+				{Name: "b.txt", Digest: b},
+			},
+			expected: &VerificationReport{
+				Matched: []SubjectResult{
+					{
+						Name:     "dist/a.txt",
+						Expected: slsacommon.DigestSet{"sha256": a["sha256"], "md5": "0"},
+						Actual:   slsacommon.DigestSet{"sha256": a["sha256"]},
+					},
+					{Name: "b.txt", Expected: b, Actual: b},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "basename not matched by default",
+			subjects: []intoto.Subject{
+				{Name: "a.txt", Digest: a},
+				{Name: "b.txt", Digest: b},
+			},
+			expected: &VerificationReport{
+				Matched: []SubjectResult{
+					{Name: "b.txt", Expected: b, Actual: b},
+				},
+				Missing: []SubjectResult{
+					{Name: "a.txt", Expected: a},
+				},
+				Unexpected: []SubjectResult{
+					{Name: "dist/a.txt", Actual: slsacommon.DigestSet{"sha256": a["sha256"]}},
+				},
+			},
+		},
+		{
+			name: "legacy basename",
+			subjects: []intoto.Subject{
+				{Name: "a.txt", Digest: a},
+				{Name: "b.txt", Digest: b},
+			},
+			legacy: true,
+			expected: &VerificationReport{
+				LegacyBasenames: true,
+				Matched: []SubjectResult{
+					{Name: "a.txt", Artifact: "dist/a.txt", Expected: a, Actual: a},
+					{Name: "b.txt", Expected: b, Actual: b},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "missing and unexpected",
+			subjects: []intoto.Subject{
+				{Name: "a.txt", Digest: a},
+				{Name: "dist/b.txt", Digest: b},
+			},
+			legacy: true,
+			expected: &VerificationReport{
+				LegacyBasenames: true,
+				Matched: []SubjectResult{
+					{Name: "a.txt", Artifact: "dist/a.txt", Expected: a, Actual: a},
+				},
+				Missing: []SubjectResult{
+					{Name: "dist/b.txt", Expected: b},
+				},
+				Unexpected: []SubjectResult{
+					{Name: "b.txt", Actual: slsacommon.DigestSet{"sha256": b["sha256"]}},
+				},
+			},
+		},
+		{
+			name: "digest mismatched",
+			subjects: []intoto.Subject{
+				{Name: "dist/a.txt", Digest: slsacommon.DigestSet{"sha256": a["sha256"], "sha512": b["sha512"]}},
+				{Name: "b.txt", Digest: b},
+			},
+			expected: &VerificationReport{
+				Matched: []SubjectResult{
+					{Name: "b.txt", Expected: b, Actual: b},
+				},
+				DigestMismatched: []SubjectResult{
+					{
+						Name:     "dist/a.txt",
+						Expected: slsacommon.DigestSet{"sha256": a["sha256"], "sha512": b["sha512"]},
+						Actual:   a,
+					},
+				},
+			},
+		},
+		{
+			name: "no supported algorithm",
+			subjects: []intoto.Subject{
+				{Name: "dist/a.txt", Digest: slsacommon.DigestSet{"md5": "0"}},
+			},
+			err: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CompareSubjects(tt.subjects, artifacts, dir, tt.legacy)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got report: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompareSubjects: %v", err)
+			}
+			// Fill in the empty lists of the expected report.
+			for _, l := range []*[]SubjectResult{
+				&tt.expected.Matched, &tt.expected.Missing, &tt.expected.Unexpected, &tt.expected.DigestMismatched,
+			} {
+				if *l == nil {
+					*l = []SubjectResult{}
+				}
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("unexpected report (-want +got):\n%s", diff)
+			}
+			if got.OK() != tt.ok {
+				t.Errorf("unexpected result, got: %v, want: %v", got.OK(), tt.ok)
+			}
+		})
+	}
+}
+
+func Test_DockerBuild_Verify(t *testing.T) {
+	// sha256 of "artifact\n".
+	digest := slsacommon.DigestSet{"sha256": "5b3513f580c8397212ff2c8f459c199efc0c90e4354a5f3533adf0a3fff3a530"}
+	other := slsacommon.DigestSet{"sha256": testImageDigest}
+
+	tests := []struct {
+		name     string
+		subjects []intoto.Subject
+		expected *VerificationReport
+	}{
+		{
+			name: "matched",
+			subjects: []intoto.Subject{
+				{Name: "lib/sub/lib.txt", Digest: digest},
+				{Name: "app.txt", Digest: digest},
+			},
+			expected: &VerificationReport{
+				Matched: []SubjectResult{
+					{Name: "lib/sub/lib.txt", Expected: digest, Actual: digest},
+					{Name: "app.txt", Expected: digest, Actual: digest},
+				},
+				Missing:          []SubjectResult{},
+				Unexpected:       []SubjectResult{},
+				DigestMismatched: []SubjectResult{},
+			},
+		},
+		{
+			name: "mismatched",
+			subjects: []intoto.Subject{
+				{Name: "app.txt", Digest: other},
+				{Name: "lib/lib.txt", Digest: digest},
+			},
+			expected: &VerificationReport{
+				Matched: []SubjectResult{},
+				Missing: []SubjectResult{
+					{Name: "lib/lib.txt", Expected: digest},
+				},
+				Unexpected: []SubjectResult{
+					{Name: "lib/sub/lib.txt", Actual: digest},
+				},
+				DigestMismatched: []SubjectResult{
+					{Name: "app.txt", Expected: other, Actual: digest},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			db := newHermeticBuild(t)
+			p := &ProvenanceStatementSLSA1{
+				StatementHeader: intoto.StatementHeader{Subject: tt.subjects},
+				Predicate: slsa1.ProvenancePredicate{
+					BuildDefinition: *db.CreateBuildDefinition(),
+				},
+			}
+
+			got, err := db.Verify(p, false)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("unexpected report (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
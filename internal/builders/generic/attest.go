@@ -30,15 +30,21 @@ import (
 	"github.com/slsa-framework/slsa-github-generator/internal/errors"
 	"github.com/slsa-framework/slsa-github-generator/internal/utils"
 	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/sigstore"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
 	"github.com/slsa-framework/slsa-github-generator/slsa"
 )
 
-// attestCmd returns the 'attest' command.
+// attestCmd returns the 'attest' command. The attestation is signed with
+// signer and uploaded to tlog, or to the Sigstore deployment of the trust root
+// if they are nil.
 func attestCmd(provider slsa.ClientProvider, check func(error),
 	signer signing.Signer, tlog signing.TransparencyLog,
 ) *cobra.Command {
 	var attPath string
 	var subjects string
+	var formatStr string
+	var trustRootPath string
 
 	c := &cobra.Command{
 		Use:   "attest",
@@ -58,20 +64,23 @@ run in the context of a Github Actions workflow.`,
 				check(errors.New("expected at least one subject"))
 			}
 
+			format, err := common.ParseAttestationFormat(formatStr)
+			check(err)
+
 			// NOTE: The provenance file path is untrusted and should be
 			// validated. This is done by CreateNewFileUnderCurrentDirectory.
 			if attPath == "" {
 				if len(parsedSubjects) == 1 {
 					filename := path.Base(parsedSubjects[0].Name)
-					attPath = fmt.Sprintf("%s.intoto.jsonl", filename)
+					attPath = fmt.Sprintf("%s.%s", filename, format.Extension())
 				} else {
 					// len(parsedSubjects) > 1
-					attPath = "multiple.intoto.jsonl"
+					attPath = fmt.Sprintf("multiple.%s", format.Extension())
 				}
 			}
 
 			// Verify the extension path and extension.
-			err = utils.VerifyAttestationPath(attPath)
+			err = format.VerifyPath(attPath)
 			check(err)
 
 			ctx := context.Background()
@@ -104,16 +113,23 @@ run in the context of a Github Actions workflow.`,
 				attBytes, err = json.Marshal(p)
 				check(err)
 			} else {
-				att, err := signer.Sign(ctx, &intoto.Statement{
+				s, r := signer, tlog
+				if s == nil || r == nil {
+					s, r, err = common.NewSigstoreClients(trustRootPath, sigstore.DefaultRekorAddr)
+					check(err)
+				}
+
+				att, err := s.Sign(ctx, &intoto.Statement{
 					StatementHeader: p.StatementHeader,
 					Predicate:       p.Predicate,
 				})
 				check(err)
 
-				_, err = tlog.Upload(ctx, att)
+				logEntry, err := r.Upload(ctx, att)
 				check(err)
 
-				attBytes = att.Bytes()
+				attBytes, err = format.Encode(att, logEntry)
+				check(err)
 			}
 
 			f, err := utils.CreateNewFileUnderCurrentDirectory(attPath, os.O_WRONLY)
@@ -136,6 +152,14 @@ run in the context of a Github Actions workflow.`,
 		&subjects, "subjects", "s", "",
 		"Formatted list of subjects in the same format as sha256sum (base64 encoded).",
 	)
+	c.Flags().StringVar(
+		&formatStr, "format", string(common.FormatDSSE),
+		"Output format of the signed provenance: 'dsse' for a DSSE envelope or 'bundle' for a Sigstore bundle.",
+	)
+	c.Flags().StringVar(
+		&trustRootPath, "trust-root", os.Getenv(trustroot.EnvVar),
+		"Path to a trust root file of a custom Sigstore deployment. Defaults to the value of "+trustroot.EnvVar+".",
+	)
 
 	return c
 }
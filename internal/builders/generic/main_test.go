@@ -0,0 +1,20 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+)
+
+// The trust root is only loaded when signing, so an invalid trust root does
+// not break the other commands.
+func Test_rootCmd_invalidTrustRoot(t *testing.T) {
+	t.Setenv(trustroot.EnvVar, filepath.Join(t.TempDir(), "missing.json"))
+
+	c := rootCmd()
+	c.SetArgs([]string{"version"})
+	if err := c.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
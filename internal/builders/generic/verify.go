@@ -0,0 +1,398 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/spf13/cobra"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+	"github.com/slsa-framework/slsa-github-generator/signing/tsa"
+)
+
+type errInvalidTrustRoot struct {
+	errors.WrappableError
+}
+
+type errInvalidPredicate struct {
+	errors.WrappableError
+}
+
+type errSubjectMismatch struct {
+	errors.WrappableError
+}
+
+type errBuilderIDMismatch struct {
+	errors.WrappableError
+}
+
+type errSourceMismatch struct {
+	errors.WrappableError
+}
+
+type errInvalidSignerIdentity struct {
+	errors.WrappableError
+}
+
+// Fulcio certificate extensions of GitHub Actions workflows, see
+// https://github.com/sigstore/fulcio/blob/main/docs/oid-info.md.
+var (
+	// Deprecated extensions whose values are raw strings.
+	oidGitHubWorkflowRepository = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 5}
+	oidGitHubWorkflowRef        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 6}
+
+	// Extensions whose values are DER-encoded strings.
+	oidSourceRepositoryURI = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 12}
+	oidSourceRepositoryRef = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 14}
+)
+
+// signerIdentity is the identity of the workflow that signed the provenance,
+// as recorded by Fulcio in its signing certificate.
+type signerIdentity struct {
+	// BuilderID is the URI of the signing workflow, e.g.
+	// https://github.com/org/builder/.github/workflows/builder.yml@refs/tags/v1.0.0.
+	BuilderID string
+
+	// SourceURI is the repository the workflow ran in, e.g.
+	// https://github.com/org/repo.
+	SourceURI string
+
+	// SourceRef is the ref the workflow ran on, e.g. refs/tags/v1.2.3.
+	SourceRef string
+}
+
+// verifyOptions are the expected values that the provenance is verified
+// against.
+type verifyOptions struct {
+	// BuilderID is the expected builder ID. If it does not contain a ref
+	// (i.e. '@'), any ref of the builder is accepted.
+	BuilderID string
+
+	// SourceURI is the expected source repository, e.g.
+	// github.com/org/repo.
+	SourceURI string
+
+	// SourceRef is the expected source ref, e.g. refs/tags/v1.2.3. Any ref
+	// is accepted if empty.
+	SourceRef string
+}
+
+// verifyCmd returns the 'verify' command.
+func verifyCmd(check func(error)) *cobra.Command {
+	var attPath string
+	var trustRootPath string
+	var opts verifyOptions
+
+	c := &cobra.Command{
+		Use:   "verify [FLAGS] ARTIFACT...",
+		Short: "Verify a signed SLSA provenance attestation offline",
+		Long: `Verify a signed SLSA provenance attestation generated by the 'attest' command
+against the given artifacts. The signature is verified using the certificate
+in the attestation, which must chain up to the given trust root. The builder ID
+and source repository are checked against the workflow identity in the
+certificate. The trust root
+is either a PEM file with the certificates of the certificate authority or a
+trust root file of a Sigstore deployment. This command does not require
+network access.`,
+		Args: cobra.MinimumNArgs(1),
+
+		Run: func(cmd *cobra.Command, args []string) {
+			attBytes, err := os.ReadFile(filepath.Clean(attPath))
+			check(err)
+
+			if trustRootPath == "" {
+				check(errors.Errorf(&errInvalidTrustRoot{}, "no trust root given, use --trust-root or %s", trustroot.EnvVar))
+			}
+			tr, err := trustroot.Load(trustRootPath)
+			check(err)
+
+			// Timestamps prove the signing time if the trust root includes
+			// a timestamp authority.
+			var ts envelope.TimestampVerifier
+			if len(tr.TSACertificates) > 0 {
+				ts, err = tsa.NewVerifier(tr.TSACertificates)
+				check(err)
+			}
+
+			check(verifyAttestation(attBytes, tr.Certificates(), ts, args, opts))
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Verified signed provenance %q for %d artifact(s).\n", attPath, len(args))
+		},
+	}
+
+	c.Flags().StringVarP(
+		&attPath, "signature", "g", "",
+		"Path to the signed provenance (.intoto.jsonl).",
+	)
+	c.Flags().StringVar(
+		&trustRootPath, "trust-root", os.Getenv(trustroot.EnvVar),
+		"Path to a trust root file or a PEM file with the root and intermediate certificates of the certificate authority. "+
+			"Defaults to the value of "+trustroot.EnvVar+".",
+	)
+	c.Flags().StringVar(
+		&opts.BuilderID, "builder-id", "",
+		"Expected builder ID. The ref is optional.",
+	)
+	c.Flags().StringVar(
+		&opts.SourceURI, "source-uri", "",
+		"Expected source repository, e.g. github.com/org/repo.",
+	)
+	c.Flags().StringVar(
+		&opts.SourceRef, "source-ref", "",
+		"Expected source ref, e.g. refs/tags/v1.2.3. Optional.",
+	)
+	check(c.MarkFlagRequired("signature"))
+	check(c.MarkFlagRequired("builder-id"))
+	check(c.MarkFlagRequired("source-uri"))
+
+	return c
+}
+
+// verifyAttestation verifies the signed attestation in attBytes and checks
+// that its subjects match the given artifacts and its predicate matches the
+// expected values in opts. Signature timestamps are verified with ts if it is
+// not nil.
+func verifyAttestation(attBytes []byte, roots []*x509.Certificate, ts envelope.TimestampVerifier,
+	artifacts []string, opts verifyOptions,
+) error {
+	if len(roots) == 0 {
+		return errors.Errorf(&errInvalidTrustRoot{}, "no certificate found in the trust root")
+	}
+
+	v, err := envelope.Verify(attBytes, &envelope.VerifyOptions{Roots: roots, Timestamps: ts})
+	if err != nil {
+		return err
+	}
+
+	var p intoto.ProvenanceStatement
+	if err := json.Unmarshal(v.Payload, &p); err != nil {
+		return errors.Errorf(&errInvalidPredicate{}, "decoding provenance: %w", err)
+	}
+	if p.PredicateType != slsa02.PredicateSLSAProvenance {
+		return errors.Errorf(&errInvalidPredicate{}, "unexpected predicate type %q", p.PredicateType)
+	}
+
+	for _, a := range artifacts {
+		if err := verifySubject(p.Subject, a); err != nil {
+			return err
+		}
+	}
+
+	// NOTE: The predicate is written by the signer, so the builder ID and
+	// source are checked against the identity in the signing certificate,
+	// which is attested by the certificate authority.
+	err = errors.Errorf(&errInvalidSignerIdentity{}, "no verified signing certificate")
+	for i := range v.Signatures {
+		sig := &v.Signatures[i]
+		if !sig.Verified() || sig.Cert == nil {
+			continue
+		}
+		if err = verifySigner(sig.Cert, &p, opts); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifySigner checks that the builder ID and source of the predicate are the
+// identity of the signer in cert, and that it matches the expected values in
+// opts.
+func verifySigner(cert *x509.Certificate, p *intoto.ProvenanceStatement, opts verifyOptions) error {
+	id, err := parseSignerIdentity(cert)
+	if err != nil {
+		return err
+	}
+
+	if p.Predicate.Builder.ID != id.BuilderID {
+		return errors.Errorf(&errBuilderIDMismatch{}, "builder ID %q does not match the signing certificate %q",
+			p.Predicate.Builder.ID, id.BuilderID)
+	}
+	if err := verifyBuilderID(id.BuilderID, opts.BuilderID); err != nil {
+		return err
+	}
+
+	source := id.SourceURI + "@" + id.SourceRef
+	uri, ref, _ := strings.Cut(p.Predicate.Invocation.ConfigSource.URI, "@")
+	if normalizeRepoURI(uri) != normalizeRepoURI(id.SourceURI) || ref != id.SourceRef {
+		return errors.Errorf(&errSourceMismatch{}, "source %q does not match the signing certificate %q",
+			p.Predicate.Invocation.ConfigSource.URI, source)
+	}
+	return verifySource(source, opts.SourceURI, opts.SourceRef)
+}
+
+// parseSignerIdentity returns the identity of the workflow in the Fulcio
+// signing certificate cert. The workflow is the URI SAN of the certificate,
+// and the source is read from the Fulcio extensions, or from the deprecated
+// ones for older certificates.
+func parseSignerIdentity(cert *x509.Certificate) (*signerIdentity, error) {
+	if len(cert.URIs) != 1 {
+		return nil, errors.Errorf(&errInvalidSignerIdentity{}, "expected one URI SAN in the signing certificate, got %d",
+			len(cert.URIs))
+	}
+	san := cert.URIs[0]
+	id := &signerIdentity{BuilderID: san.String()}
+
+	var legacyRepo, legacyRef string
+	for _, ext := range cert.Extensions {
+		var err error
+		switch {
+		case ext.Id.Equal(oidSourceRepositoryURI):
+			id.SourceURI, err = parseDERString(ext.Value)
+		case ext.Id.Equal(oidSourceRepositoryRef):
+			id.SourceRef, err = parseDERString(ext.Value)
+		case ext.Id.Equal(oidGitHubWorkflowRepository):
+			legacyRepo = string(ext.Value)
+		case ext.Id.Equal(oidGitHubWorkflowRef):
+			legacyRef = string(ext.Value)
+		}
+		if err != nil {
+			return nil, errors.Errorf(&errInvalidSignerIdentity{}, "decoding extension %v: %w", ext.Id, err)
+		}
+	}
+	// The deprecated repository extension is the name of the repository on
+	// the server of the workflow.
+	if id.SourceURI == "" && legacyRepo != "" {
+		id.SourceURI = san.Scheme + "://" + san.Host + "/" + legacyRepo
+	}
+	if id.SourceRef == "" {
+		id.SourceRef = legacyRef
+	}
+	if id.SourceURI == "" || id.SourceRef == "" {
+		return nil, errors.Errorf(&errInvalidSignerIdentity{}, "no source repository and ref in the signing certificate")
+	}
+	return id, nil
+}
+
+func parseDERString(value []byte) (string, error) {
+	var s string
+	rest, err := asn1.Unmarshal(value, &s)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) != 0 {
+		return "", fmt.Errorf("trailing data after the string")
+	}
+	return s, nil
+}
+
+// verifySubject checks that the artifact at path is one of the subjects. The
+// subject name is either the path as given or, if no subject has that name,
+// its base name. A base name must not be ambiguous, i.e. only one subject may
+// have that base name.
+func verifySubject(subjects []intoto.Subject, path string) error {
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+
+	s, err := findSubject(subjects, path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(s.Digest["sha256"], digest) {
+		return errors.Errorf(&errSubjectMismatch{}, "subject %q: expected sha256 %q, got %q",
+			s.Name, s.Digest["sha256"], digest)
+	}
+	return nil
+}
+
+// findSubject returns the subject named after the artifact at path, or after
+// its base name if no subject is named after path.
+func findSubject(subjects []intoto.Subject, path string) (*intoto.Subject, error) {
+	for i := range subjects {
+		if subjects[i].Name == path {
+			return &subjects[i], nil
+		}
+	}
+
+	base := filepath.Base(path)
+	var candidates []*intoto.Subject
+	for i := range subjects {
+		if filepath.Base(subjects[i].Name) == base {
+			candidates = append(candidates, &subjects[i])
+		}
+	}
+	if len(candidates) > 1 {
+		return nil, errors.Errorf(&errSubjectMismatch{}, "%d subjects have the base name of artifact %q",
+			len(candidates), path)
+	}
+	if len(candidates) == 0 || candidates[0].Name != base {
+		return nil, errors.Errorf(&errSubjectMismatch{}, "no subject found for artifact %q", path)
+	}
+	return candidates[0], nil
+}
+
+// verifyBuilderID checks the builder ID against the expected value. If
+// expected does not contain a ref, only the builder path is compared.
+func verifyBuilderID(builderID, expected string) error {
+	id := builderID
+	if !strings.Contains(expected, "@") {
+		id, _, _ = strings.Cut(builderID, "@")
+	}
+	if id != expected {
+		return errors.Errorf(&errBuilderIDMismatch{}, "expected builder ID %q, got %q", expected, builderID)
+	}
+	return nil
+}
+
+// verifySource checks the provenance source URI, which is of the form
+// git+https://github.com/org/repo@ref, against the expected repository and
+// ref.
+func verifySource(sourceURI, expectedURI, expectedRef string) error {
+	uri, ref, _ := strings.Cut(sourceURI, "@")
+	if normalizeRepoURI(uri) != normalizeRepoURI(expectedURI) {
+		return errors.Errorf(&errSourceMismatch{}, "expected source repository %q, got %q", expectedURI, uri)
+	}
+	if expectedRef != "" && ref != expectedRef {
+		return errors.Errorf(&errSourceMismatch{}, "expected source ref %q, got %q", expectedRef, ref)
+	}
+	return nil
+}
+
+// normalizeRepoURI removes the scheme from a repository URI.
+func normalizeRepoURI(uri string) string {
+	uri = strings.TrimPrefix(uri, "git+")
+	uri = strings.TrimPrefix(uri, "https://")
+	uri = strings.TrimPrefix(uri, "http://")
+	return strings.TrimSuffix(uri, "/")
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
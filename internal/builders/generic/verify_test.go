@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/sigstore/sigstore/pkg/signature"
+	sdsse "github.com/sigstore/sigstore/pkg/signature/dsse"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+)
+
+const (
+	testBuilderID = "https://github.com/slsa-framework/slsa-github-generator/" +
+		".github/workflows/generator_generic_slsa3.yml@refs/tags/v1.5.0"
+	testSourceURI = "git+https://github.com/slsa-framework/example@refs/tags/v1.2.3"
+	testRepoURI   = "https://github.com/slsa-framework/example"
+	testRef       = "refs/tags/v1.2.3"
+)
+
+// testCA is a certificate authority used to issue signing certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a new signing key and a PEM-encoded certificate for it with
+// the identity in id.
+func (ca *testCA) issue(t *testing.T, id *x509.Certificate) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       time.Now().Add(-1 * time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            id.URIs,
+		ExtraExtensions: id.ExtraExtensions,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// workflowIdentity returns a certificate with the identity of the workflow
+// builderID running in the repository repo at ref, as issued by Fulcio.
+func workflowIdentity(t *testing.T, builderID, repo, ref string) *x509.Certificate {
+	return &x509.Certificate{
+		URIs: []*url.URL{mustParseURL(t, builderID)},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidSourceRepositoryURI, Value: mustMarshalDER(t, repo)},
+			{Id: oidSourceRepositoryRef, Value: mustMarshalDER(t, ref)},
+		},
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func mustMarshalDER(t *testing.T, s string) []byte {
+	b, err := asn1.MarshalWithParams(s, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// signProvenance returns a signed attestation for the provenance in the same
+// format as the 'attest' command, signed by the test builder.
+func signProvenance(t *testing.T, ca *testCA, p *intoto.ProvenanceStatement) []byte {
+	return signProvenanceAs(t, ca, workflowIdentity(t, testBuilderID, testRepoURI, testRef), p)
+}
+
+// signProvenanceAs returns a signed attestation for the provenance signed
+// with a certificate for the identity id.
+func signProvenanceAs(t *testing.T, ca *testCA, id *x509.Certificate, p *intoto.ProvenanceStatement) []byte {
+	key, certPEM := ca.issue(t, id)
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := signature.LoadECDSASigner(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := sdsse.WrapSigner(s, intoto.PayloadType).SignMessage(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	att, err := envelope.AddCertToEnvelope(signed, certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return att
+}
+
+// errorAs reports whether err wraps an error of type T.
+func errorAs[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
+
+func testProvenance(subjects ...intoto.Subject) *intoto.ProvenanceStatement {
+	return &intoto.ProvenanceStatement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: slsa02.PredicateSLSAProvenance,
+			Subject:       subjects,
+		},
+		Predicate: slsa02.ProvenancePredicate{
+			BuildType: provenanceOnlyBuildType,
+			Builder: slsacommon.ProvenanceBuilder{
+				ID: testBuilderID,
+			},
+			Invocation: slsa02.ProvenanceInvocation{
+				ConfigSource: slsa02.ConfigSource{
+					URI: testSourceURI,
+				},
+			},
+		},
+	}
+}
+
+func Test_verifyAttestation(t *testing.T) {
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "artifact1")
+	if err := os.WriteFile(artifact, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// echo "hello" | sha256sum
+	digest := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	validOpts := verifyOptions{
+		BuilderID: testBuilderID,
+		SourceURI: "github.com/slsa-framework/example",
+		SourceRef: "refs/tags/v1.2.3",
+	}
+	subject := intoto.Subject{
+		Name:   "artifact1",
+		Digest: slsacommon.DigestSet{"sha256": digest},
+	}
+	otherBuilderID := "https://github.com/attacker/repo/.github/workflows/build.yml@refs/heads/main"
+
+	testCases := []struct {
+		name  string
+		att   []byte
+		roots []*x509.Certificate
+		opts  verifyOptions
+		err   func(error) bool
+	}{
+		{
+			name: "valid",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact1",
+				Digest: slsacommon.DigestSet{"sha256": digest},
+			})),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+		},
+		{
+			name: "builder ID without ref",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact1",
+				Digest: slsacommon.DigestSet{"sha256": digest},
+			})),
+			roots: []*x509.Certificate{ca.cert},
+			opts: verifyOptions{
+				BuilderID: "https://github.com/slsa-framework/slsa-github-generator/" +
+					".github/workflows/generator_generic_slsa3.yml",
+				SourceURI: "https://github.com/slsa-framework/example",
+			},
+		},
+		{
+			name: "deprecated certificate extensions",
+			att: signProvenanceAs(t, ca, &x509.Certificate{
+				URIs: []*url.URL{mustParseURL(t, testBuilderID)},
+				ExtraExtensions: []pkix.Extension{
+					{Id: oidGitHubWorkflowRepository, Value: []byte("slsa-framework/example")},
+					{Id: oidGitHubWorkflowRef, Value: []byte(testRef)},
+				},
+			}, testProvenance(subject)),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+		},
+		{
+			name: "builder ID not in certificate",
+			att: signProvenanceAs(t, ca, workflowIdentity(t, otherBuilderID, testRepoURI, testRef),
+				testProvenance(subject)),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*errBuilderIDMismatch],
+		},
+		{
+			name: "certificate of other builder",
+			att: func() []byte {
+				p := testProvenance(subject)
+				p.Predicate.Builder.ID = otherBuilderID
+				return signProvenanceAs(t, ca, workflowIdentity(t, otherBuilderID, testRepoURI, testRef), p)
+			}(),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*errBuilderIDMismatch],
+		},
+		{
+			name: "source not in certificate",
+			att: signProvenanceAs(t, ca, workflowIdentity(t, testBuilderID, "https://github.com/other/repo", testRef),
+				testProvenance(subject)),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*errSourceMismatch],
+		},
+		{
+			name: "ref not in certificate",
+			att: signProvenanceAs(t, ca, workflowIdentity(t, testBuilderID, testRepoURI, "refs/heads/main"),
+				testProvenance(subject)),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*errSourceMismatch],
+		},
+		{
+			name: "certificate without identity",
+			att: signProvenanceAs(t, ca, &x509.Certificate{
+				URIs: []*url.URL{mustParseURL(t, testBuilderID)},
+			}, testProvenance(subject)),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*errInvalidSignerIdentity],
+		},
+		{
+			name:  "invalid envelope",
+			att:   []byte("not json"),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*envelope.ErrInvalidEnvelope],
+		},
+		{
+			name: "untrusted certificate",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact1",
+				Digest: slsacommon.DigestSet{"sha256": digest},
+			})),
+			roots: []*x509.Certificate{otherCA.cert},
+			opts:  validOpts,
+			err:   errorAs[*envelope.ErrInvalidCertificate],
+		},
+		{
+			name: "digest mismatch",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact1",
+				Digest: slsacommon.DigestSet{"sha256": "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"},
+			})),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*errSubjectMismatch],
+		},
+		{
+			name: "missing subject",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact2",
+				Digest: slsacommon.DigestSet{"sha256": digest},
+			})),
+			roots: []*x509.Certificate{ca.cert},
+			opts:  validOpts,
+			err:   errorAs[*errSubjectMismatch],
+		},
+		{
+			name: "builder ID mismatch",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact1",
+				Digest: slsacommon.DigestSet{"sha256": digest},
+			})),
+			roots: []*x509.Certificate{ca.cert},
+			opts: verifyOptions{
+				BuilderID: "https://github.com/other/builder",
+				SourceURI: "github.com/slsa-framework/example",
+			},
+			err: errorAs[*errBuilderIDMismatch],
+		},
+		{
+			name: "source mismatch",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact1",
+				Digest: slsacommon.DigestSet{"sha256": digest},
+			})),
+			roots: []*x509.Certificate{ca.cert},
+			opts: verifyOptions{
+				BuilderID: testBuilderID,
+				SourceURI: "github.com/other/repo",
+			},
+			err: errorAs[*errSourceMismatch],
+		},
+		{
+			name: "ref mismatch",
+			att: signProvenance(t, ca, testProvenance(intoto.Subject{
+				Name:   "artifact1",
+				Digest: slsacommon.DigestSet{"sha256": digest},
+			})),
+			roots: []*x509.Certificate{ca.cert},
+			opts: verifyOptions{
+				BuilderID: testBuilderID,
+				SourceURI: "github.com/slsa-framework/example",
+				SourceRef: "refs/heads/main",
+			},
+			err: errorAs[*errSourceMismatch],
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyAttestation(tc.att, tc.roots, nil, []string{artifact}, tc.opts)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !tc.err(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func Test_verifyAttestation_tamperedPayload(t *testing.T) {
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "artifact1")
+	if err := os.WriteFile(artifact, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ca := newTestCA(t)
+	att := signProvenance(t, ca, testProvenance(intoto.Subject{
+		Name:   "artifact1",
+		Digest: slsacommon.DigestSet{"sha256": "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+	}))
+
+	// Replace the payload with a different, unsigned, provenance.
+	env := &envelope.Envelope{}
+	if err := json.Unmarshal(att, env); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(testProvenance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Payload = base64.StdEncoding.EncodeToString(payload)
+	tampered, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = verifyAttestation(tampered, []*x509.Certificate{ca.cert}, nil, []string{artifact}, verifyOptions{})
+	want := &envelope.ErrInvalidSignature{}
+	if !errors.As(err, &want) {
+		t.Fatalf("unexpected error: %v", cmp.Diff(err, want, cmpopts.EquateErrors()))
+	}
+}
+
+func Test_verifySubject(t *testing.T) {
+	// NOTE: the subjects are named after paths relative to the current
+	// directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join("dir", "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"foo":                              "foo\n",
+		filepath.Join("dir", "foo"):        "dir/foo\n",
+		filepath.Join("dir", "sub", "bar"): "bar\n",
+		filepath.Join("dir", "sub", "foo"): "dir/sub/foo\n",
+	}
+	digests := make(map[string]slsacommon.DigestSet)
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := fileSHA256(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests[name] = slsacommon.DigestSet{"sha256": digest}
+	}
+	// Both foo and dir/foo are subjects.
+	subjects := []intoto.Subject{
+		{Name: "foo", Digest: digests["foo"]},
+		{Name: "dir/foo", Digest: digests[filepath.Join("dir", "foo")]},
+		{Name: "bar", Digest: digests[filepath.Join("dir", "sub", "bar")]},
+	}
+
+	testCases := []struct {
+		name     string
+		subjects []intoto.Subject
+		path     string
+		err      func(error) bool
+	}{
+		{
+			name:     "path",
+			subjects: subjects,
+			path:     filepath.Join("dir", "foo"),
+		},
+		{
+			name: "path before base name",
+			// The order of the subjects does not matter.
+			subjects: []intoto.Subject{subjects[1], subjects[0]},
+			path:     "foo",
+		},
+		{
+			name:     "base name",
+			subjects: subjects,
+			path:     filepath.Join("dir", "sub", "bar"),
+		},
+		{
+			name:     "ambiguous base name",
+			subjects: subjects,
+			path:     filepath.Join("dir", "sub", "foo"),
+			err:      errorAs[*errSubjectMismatch],
+		},
+		{
+			name:     "base name of another subject",
+			subjects: subjects[1:],
+			path:     filepath.Join("dir", "sub", "foo"),
+			err:      errorAs[*errSubjectMismatch],
+		},
+		{
+			name:     "digest mismatch",
+			subjects: []intoto.Subject{{Name: "foo", Digest: digests[filepath.Join("dir", "foo")]}},
+			path:     "foo",
+			err:      errorAs[*errSubjectMismatch],
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifySubject(tc.subjects, tc.path)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !tc.err(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -15,29 +15,44 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 
 	"github.com/slsa-framework/slsa-github-generator/github"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
 	"github.com/slsa-framework/slsa-github-generator/signing/sigstore"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+	"github.com/slsa-framework/slsa-github-generator/signing/tsa"
 
 	// Enable the GitHub OIDC auth provider.
 	_ "github.com/sigstore/cosign/pkg/providers/github"
 
+	"github.com/slsa-framework/slsa-github-generator/internal/builders/common"
 	"github.com/slsa-framework/slsa-github-generator/internal/builders/go/pkg"
 	"github.com/slsa-framework/slsa-github-generator/internal/utils"
 )
 
 func usage(p string) {
 	panic(fmt.Sprintf(`Usage:
-	 %s build [--dry] slsa-releaser.yml
-	 %s provenance --binary-name $NAME --digest $DIGEST --command $COMMAND --env $ENV`, p, p))
+	 %s build [--dry] [--date $DATE] [--policy $FILE] slsa-releaser.yml
+	 %s provenance --binary-name $NAME --digest $DIGEST --command $COMMAND --env $ENV [--variables $VARIABLES] [--artifacts $ARTIFACTS] [--materials $MATERIALS] [--workspace $WORKSPACE] [--sbom spdx,cyclonedx] [--format dsse|bundle] [--trust-root $FILE]
+	 %s provenance --binary-name $NAME --targets $TARGETS [--artifacts $ARTIFACTS] [--materials $MATERIALS] [--workspace $WORKSPACE] [--sbom spdx,cyclonedx] [--format dsse|bundle] [--trust-root $FILE]
+	 %s provenance --module $MODULE [--format dsse|bundle] [--trust-root $FILE]
+	 %s module [--dir $DIR] [--version $VERSION]
+	 %s verify-build --provenance $FILE [--trust-root $FILE | --unsigned] [--dir $DIR] [--repository $REPOSITORY] [--policy $FILE]`, p, p, p, p, p, p))
 }
 
 func check(e error) {
@@ -47,19 +62,32 @@ func check(e error) {
 	}
 }
 
-func runBuild(dry bool, configFile, evalEnvs string) error {
+func runBuild(dry bool, configFile, evalEnvs, date, policyFile string) error {
 	goc, err := exec.LookPath("go")
 	if err != nil {
 		return err
 	}
 
-	cfg, err := pkg.ConfigFromFile(configFile)
+	policy, err := loadPolicy(policyFile)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := pkg.ConfigFromFile(configFile, policy)
 	if err != nil {
 		return err
 	}
 	fmt.Println(cfg)
 
 	gobuild := pkg.GoBuildNew(goc, cfg)
+	if date != "" {
+		// The date of the dry run.
+		t, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			return fmt.Errorf("invalid date %q: %w", date, err)
+		}
+		gobuild.SetDate(t)
+	}
 
 	// Set env variables encoded as arguments.
 	err = gobuild.SetArgEnvVariables(evalEnvs)
@@ -67,24 +95,116 @@ func runBuild(dry bool, configFile, evalEnvs string) error {
 		return err
 	}
 
+	if !dry {
+		// Share the toolchain and module dependencies, which are added to
+		// the provenance materials. They are read after the dependencies
+		// are vendored, and before the compiler is invoked.
+		materials, err := gobuild.Materials()
+		if err != nil {
+			return err
+		}
+		m, err := utils.MarshalToString(materials)
+		if err != nil {
+			return err
+		}
+		if err := github.SetOutput("go-materials", m); err != nil {
+			return err
+		}
+	}
+
 	err = gobuild.Run(dry)
 	if err != nil {
 		return err
 	}
 
+	if dry {
+		// Share the date of the build, which the build must be given to
+		// resolve {{ .Date }} to the same value.
+		if err := github.SetOutput("go-date", gobuild.Date().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func runProvenanceGeneration(subject, digest, commands, envs, workingDir, rekor string) error {
-	r := sigstore.NewRekor(rekor)
-	s := sigstore.NewDefaultFulcio()
-	attBytes, err := pkg.GenerateProvenance(subject, digest,
-		commands, envs, workingDir, s, r, nil)
+// loadPolicy loads the policy file, or returns the default policy if
+// policyFile is empty.
+func loadPolicy(policyFile string) (*pkg.Policy, error) {
+	if policyFile == "" {
+		return pkg.DefaultPolicy(), nil
+	}
+	return pkg.PolicyFromFile(policyFile)
+}
+
+func runProvenanceGeneration(subject, digest, commands, envs, variables, targets, artifacts, module, materials, workingDir,
+	workspace, sbom, rekor, formatStr, trustRootPath string,
+) error {
+	format, err := common.ParseAttestationFormat(formatStr)
+	if err != nil {
+		return err
+	}
+
+	var sbomFormats []string
+	if sbom != "" {
+		if module != "" {
+			return fmt.Errorf("SBOMs are not supported for modules")
+		}
+		sbomFormats, err = pkg.ParseSBOMFormats(sbom)
+		if err != nil {
+			return err
+		}
+	}
+
+	var ms []slsacommon.ProvenanceMaterial
+	if materials != "" {
+		if err := utils.UnmarshalBase64(materials, &ms); err != nil {
+			return err
+		}
+	}
+
+	var ws *pkg.Workspace
+	if workspace != "" {
+		if module != "" {
+			return fmt.Errorf("workspaces are not supported for modules")
+		}
+		if err := utils.UnmarshalBase64(workspace, &ws); err != nil {
+			return err
+		}
+	}
+
+	var m *pkg.Module
+	if module != "" {
+		// The provenance of a module zip is named after the zip.
+		if err := utils.UnmarshalBase64(module, &m); err != nil {
+			return err
+		}
+		if subject == "" {
+			subject = m.Zip
+		}
+	}
+
+	filename := fmt.Sprintf("%s.%s", subject, format.Extension())
+	if err := format.VerifyPath(filename); err != nil {
+		return err
+	}
+
+	s, r, err := common.NewSigstoreClients(trustRootPath, rekor)
+	if err != nil {
+		return err
+	}
+
+	var attBytes []byte
+	if m != nil {
+		attBytes, err = pkg.GenerateModuleProvenance(m, workingDir, ms, s, r, nil, format)
+	} else {
+		attBytes, err = generateBinaryProvenance(subject, digest, commands, envs, variables, targets, artifacts,
+			workingDir, ws, ms, sbomFormats, s, r, format)
+	}
 	if err != nil {
 		return err
 	}
 
-	filename := fmt.Sprintf("%s.intoto.jsonl", subject)
 	f, err := utils.CreateNewFileUnderCurrentDirectory(filename, os.O_WRONLY)
 	if err != nil {
 		return err
@@ -110,19 +230,271 @@ func runProvenanceGeneration(subject, digest, commands, envs, workingDir, rekor
 	return nil
 }
 
+// generateBinaryProvenance generates the provenance of the binaries of a
+// single-target or multi-target build and of their archives. If SBOM formats
+// are given, the SBOMs of the binaries in the current directory are written
+// next to the provenance and are subjects of the provenance too.
+func generateBinaryProvenance(subject, digest, commands, envs, variables, targets, artifacts, workingDir string,
+	ws *pkg.Workspace, ms []slsacommon.ProvenanceMaterial, sbomFormats []string, s signing.Signer, r signing.TransparencyLog,
+	format common.AttestationFormat,
+) ([]byte, error) {
+	var ts []pkg.Target
+	if targets != "" {
+		// The provenance covers the binaries of all targets.
+		if err := utils.UnmarshalBase64(targets, &ts); err != nil {
+			return nil, err
+		}
+	} else {
+		t, err := singleTarget(subject, digest, commands, envs, variables)
+		if err != nil {
+			return nil, err
+		}
+		ts = []pkg.Target{t}
+	}
+	if err := digestTargets(ts); err != nil {
+		return nil, err
+	}
+
+	var as []pkg.Artifact
+	if artifacts != "" {
+		// The archives and checksums file created by the build.
+		if err := utils.UnmarshalBase64(artifacts, &as); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sbomFormats) > 0 {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		sboms, err := pkg.GenerateSBOMs(ts, wd, ms, sbomFormats, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		// Share the names and digests of the SBOMs.
+		msboms, err := utils.MarshalToString(sboms)
+		if err != nil {
+			return nil, err
+		}
+		if err := github.SetOutput("go-sboms", msboms); err != nil {
+			return nil, err
+		}
+		as = append(as, sboms...)
+	}
+
+	return pkg.GenerateMultiProvenance(ts, as, workingDir, ws, ms, s, r, nil, format)
+}
+
+// digestTargets sets the digests of the targets that have none to the
+// digests of their binaries in the current directory.
+func digestTargets(ts []pkg.Target) error {
+	for i := range ts {
+		if ts[i].Digest != "" {
+			continue
+		}
+		if err := utils.PathIsUnderCurrentDirectory(ts[i].Binary); err != nil {
+			return err
+		}
+		digest, err := computeSHA256(ts[i].Binary)
+		if err != nil {
+			return err
+		}
+		ts[i].Digest = digest
+	}
+	return nil
+}
+
+// runModuleBuild creates the zip of the module in dir at version in the
+// current directory and shares it as the `go-module` output.
+func runModuleBuild(dir, version string) error {
+	if err := utils.PathIsUnderCurrentDirectory(dir); err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	m, err := pkg.BuildModule(dir, version, wd)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("module %s (%s): %s %s\n", m.URI(), m.Zip, m.SHA256, m.DirHash)
+
+	mm, err := utils.MarshalToString(m)
+	if err != nil {
+		return err
+	}
+	if err := github.SetOutput("go-module", mm); err != nil {
+		return err
+	}
+	return github.SetOutput("go-module-zip", m.Zip)
+}
+
+// runVerifyBuild verifies the signature of the provenance with the trust
+// root, rebuilds its binaries and compares them to its subjects. The
+// signature is not verified if unsigned is set. A JSON diff is printed if they
+// differ.
+func runVerifyBuild(provenancePath, trustRootPath string, unsigned bool, dir, repository, policyFile string) error {
+	goc, err := exec.LookPath("go")
+	if err != nil {
+		return err
+	}
+
+	policy, err := loadPolicy(policyFile)
+	if err != nil {
+		return err
+	}
+
+	attBytes, err := os.ReadFile(filepath.Clean(provenancePath))
+	if err != nil {
+		return err
+	}
+	var p *intoto.ProvenanceStatement
+	if unsigned {
+		// NOTE: The provenance is trusted by the caller.
+		p, err = pkg.ParseProvenance(attBytes)
+	} else {
+		p, err = verifyProvenance(attBytes, trustRootPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if dir == "" {
+		dir, err = os.MkdirTemp("", "verify-build")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	// NOTE: the output of the build commands is written to stderr so that
+	// stdout only contains the result.
+	report, err := pkg.Rebuild(context.Background(), p, &pkg.RebuildOptions{
+		Goc:        goc,
+		Dir:        dir,
+		Repository: repository,
+		Policy:     policy,
+		Stdout:     os.Stderr,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !report.Reproduced() {
+		diff, err := json.MarshalIndent(report.Diff(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(diff))
+		return fmt.Errorf("binaries of %q not reproduced", provenancePath)
+	}
+	fmt.Printf("Reproduced %d binaries of %q.\n", len(report.Subjects), provenancePath)
+	return nil
+}
+
+// verifyProvenance verifies the signature of the provenance in attBytes with
+// the Fulcio certificates of the trust root file at trustRootPath, and its
+// timestamps with its timestamp authority if any.
+func verifyProvenance(attBytes []byte, trustRootPath string) (*intoto.ProvenanceStatement, error) {
+	if trustRootPath == "" {
+		return nil, fmt.Errorf("no trust root given, use --trust-root or %s, or --unsigned", trustroot.EnvVar)
+	}
+	tr, err := trustroot.Load(trustRootPath)
+	if err != nil {
+		return nil, err
+	}
+	roots := tr.Certificates()
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no Fulcio certificate found in the trust root %q", trustRootPath)
+	}
+
+	opts := &envelope.VerifyOptions{Roots: roots}
+	if len(tr.TSACertificates) > 0 {
+		if opts.Timestamps, err = tsa.NewVerifier(tr.TSACertificates); err != nil {
+			return nil, err
+		}
+	}
+	return pkg.VerifyProvenance(attBytes, opts)
+}
+
+// singleTarget returns the target of a single-target build from the
+// encoded outputs of the dry run.
+func singleTarget(binary, digest, commands, envs, variables string) (pkg.Target, error) {
+	t := pkg.Target{
+		Binary: binary,
+		Digest: digest,
+	}
+
+	var err error
+	if t.Command, err = utils.UnmarshalList(commands); err != nil {
+		return t, err
+	}
+	if t.Env, err = utils.UnmarshalList(envs); err != nil {
+		return t, err
+	}
+	if variables != "" {
+		if err := utils.UnmarshalBase64(variables, &t.Variables); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
 func main() {
 	// Build command.
 	buildCmd := flag.NewFlagSet("build", flag.ExitOnError)
 	buildDry := buildCmd.Bool("dry", false, "dry run of the build without invoking compiler")
+	buildDate := buildCmd.String("date", "", "RFC 3339 date of the build shared by the dry run (defaults to the current date)")
+	buildPolicy := buildCmd.String("policy", os.Getenv(pkg.PolicyEnvVar),
+		"policy file allowing or denying flags and env variables (defaults to $"+pkg.PolicyEnvVar+")")
 
 	// Provenance command.
 	provenanceCmd := flag.NewFlagSet("provenance", flag.ExitOnError)
 	provenanceName := provenanceCmd.String("binary-name", "", "untrusted binary name of the artifact built")
-	provenanceDigest := provenanceCmd.String("digest", "", "sha256 digest of the untrusted binary")
+	provenanceDigest := provenanceCmd.String("digest", "",
+		"sha256 digest of the untrusted binary (defaults to the digest of the binary in the current directory)")
 	provenanceCommand := provenanceCmd.String("command", "", "command used to compile the binary")
 	provenanceEnv := provenanceCmd.String("env", "", "env variables used to compile the binary")
+	provenanceVariables := provenanceCmd.String("variables", "", "template variables used to compile the binary")
+	provenanceArtifacts := provenanceCmd.String("artifacts", "", "archives and checksums file created by the build with their digests")
+	provenanceMaterials := provenanceCmd.String("materials", "", "toolchain and module dependencies of the build")
+	provenanceSBOM := provenanceCmd.String("sbom", "",
+		"comma-separated formats of the SBOMs of the binaries in the current directory: spdx and/or cyclonedx")
+	provenanceTargets := provenanceCmd.String("targets", "",
+		"targets of a multi-target build, with their digests or their binaries in the current directory; the binary name is used as the name of the provenance")
+	provenanceModule := provenanceCmd.String("module", "",
+		"module zip created by the module command; the zip name is used as the name of the provenance")
 	provenanceWorkingDir := provenanceCmd.String("workingDir", "", "working directory used to issue compilation commands")
+	provenanceWorkspace := provenanceCmd.String("workspace", "", "go.work workspace of the build, which is vendored with go work vendor")
 	provenanceRekor := provenanceCmd.String("rekor", sigstore.DefaultRekorAddr, "rekor server to use for provenance")
+	provenanceFormat := provenanceCmd.String("format", string(common.FormatDSSE), "output format of the signed provenance: dsse or bundle")
+	provenanceTrustRoot := provenanceCmd.String("trust-root", os.Getenv(trustroot.EnvVar),
+		"trust root file of a custom sigstore deployment, overrides the rekor server (defaults to $"+trustroot.EnvVar+")")
+
+	// Module command.
+	moduleCmd := flag.NewFlagSet("module", flag.ExitOnError)
+	moduleDir := moduleCmd.String("dir", ".", "directory of the module")
+	moduleVersion := moduleCmd.String("version", os.Getenv("GITHUB_REF_NAME"),
+		"version of the module (defaults to $GITHUB_REF_NAME)")
+
+	// Verify-build command.
+	verifyBuildCmd := flag.NewFlagSet("verify-build", flag.ExitOnError)
+	verifyBuildProvenance := verifyBuildCmd.String("provenance", "", "path of the provenance of the binaries to rebuild")
+	verifyBuildDir := verifyBuildCmd.String("dir", "",
+		"empty directory the source is checked out in (defaults to a temporary directory)")
+	verifyBuildRepository := verifyBuildCmd.String("repository", "",
+		"repository the source is fetched from (defaults to the repository in the provenance)")
+	verifyBuildTrustRoot := verifyBuildCmd.String("trust-root", os.Getenv(trustroot.EnvVar),
+		"trust root file verifying the signature of the provenance (defaults to $"+trustroot.EnvVar+")")
+	verifyBuildUnsigned := verifyBuildCmd.Bool("unsigned", false,
+		"do not verify the signature of the provenance, which must be trusted")
+	verifyBuildPolicy := verifyBuildCmd.String("policy", os.Getenv(pkg.PolicyEnvVar),
+		"policy file allowing or denying flags and env variables (defaults to $"+pkg.PolicyEnvVar+")")
 
 	// Expect a sub-command.
 	if len(os.Args) < 2 {
@@ -138,22 +510,46 @@ func main() {
 		configFile := buildCmd.Args()[0]
 		evaluatedEnvs := buildCmd.Args()[1]
 
-		check(runBuild(*buildDry, configFile, evaluatedEnvs))
+		check(runBuild(*buildDry, configFile, evaluatedEnvs, *buildDate, *buildPolicy))
 
 	case provenanceCmd.Name():
 		check(provenanceCmd.Parse(os.Args[2:]))
 		// Note: *provenanceEnv may be empty.
-		if *provenanceName == "" || *provenanceDigest == "" ||
-			*provenanceCommand == "" || *provenanceWorkingDir == "" {
+		if *provenanceWorkingDir == "" {
 			usage(os.Args[0])
 		}
+		if *provenanceModule == "" {
+			if *provenanceName == "" {
+				usage(os.Args[0])
+			}
+			if *provenanceTargets == "" && *provenanceCommand == "" {
+				usage(os.Args[0])
+			}
+		}
 
 		err := runProvenanceGeneration(*provenanceName, *provenanceDigest,
-			*provenanceCommand, *provenanceEnv, *provenanceWorkingDir, *provenanceRekor)
+			*provenanceCommand, *provenanceEnv, *provenanceVariables, *provenanceTargets, *provenanceArtifacts, *provenanceModule, *provenanceMaterials, *provenanceWorkingDir,
+			*provenanceWorkspace, *provenanceSBOM, *provenanceRekor, *provenanceFormat, *provenanceTrustRoot)
 		check(err)
 
+	case moduleCmd.Name():
+		check(moduleCmd.Parse(os.Args[2:]))
+		if *moduleVersion == "" {
+			usage(os.Args[0])
+		}
+
+		check(runModuleBuild(*moduleDir, *moduleVersion))
+
+	case verifyBuildCmd.Name():
+		check(verifyBuildCmd.Parse(os.Args[2:]))
+		if *verifyBuildProvenance == "" {
+			usage(os.Args[0])
+		}
+
+		check(runVerifyBuild(*verifyBuildProvenance, *verifyBuildTrustRoot, *verifyBuildUnsigned, *verifyBuildDir, *verifyBuildRepository, *verifyBuildPolicy))
+
 	default:
-		fmt.Println("expected 'build' or 'provenance' subcommands")
+		fmt.Println("expected 'build', 'provenance', 'module' or 'verify-build' subcommands")
 		os.Exit(1)
 	}
 }
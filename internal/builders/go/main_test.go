@@ -300,7 +300,7 @@ func Test_runBuild(t *testing.T) {
 
 			err = runBuild(true,
 				tt.config,
-				tt.evalEnvs)
+				tt.evalEnvs, "", "")
 
 			if tt.err != nil {
 				tt.err(t, err)
@@ -394,3 +394,43 @@ func extract(file *os.File) ([]string, []string, string, string, error) {
 
 	return cmd, env, subject, wd, nil
 }
+
+func Test_digestTargets(t *testing.T) {
+	// NOTE: the binaries must be in the current directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("binary-linux-amd64", []byte("binary\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := []pkg.Target{
+		// sha256 of "binary\n".
+		{Binary: "binary-linux-amd64"},
+		{Binary: "binary-darwin-arm64", Digest: "0a"},
+	}
+	if err := digestTargets(ts); err != nil {
+		t.Fatalf("digestTargets: %v", err)
+	}
+	if want := "58eaf5a78d580f5dbd49d31a5b733094169b31bfdf49055b74bcac2877d8f58c"; ts[0].Digest != want {
+		t.Errorf("unexpected digest, got: %v, want: %v", ts[0].Digest, want)
+	}
+	if ts[1].Digest != "0a" {
+		t.Errorf("digest overwritten, got: %v", ts[1].Digest)
+	}
+
+	for _, binary := range []string{"missing", "../binary-linux-amd64"} {
+		if err := digestTargets([]pkg.Target{{Binary: binary}}); err == nil {
+			t.Errorf("expected an error for %q", binary)
+		}
+	}
+}
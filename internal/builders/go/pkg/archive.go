@@ -0,0 +1,339 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/slsa-framework/slsa-github-generator/github"
+	"github.com/slsa-framework/slsa-github-generator/internal/utils"
+)
+
+const (
+	archiveFormatTarGz = "tar.gz"
+	archiveFormatZip   = "zip"
+
+	defaultChecksumName = "checksums.txt"
+)
+
+var supportedArchiveFormats = map[string]bool{
+	archiveFormatTarGz: true,
+	archiveFormatZip:   true,
+}
+
+// archiveModTime is the modification time of all the files in the archives,
+// so that archives are reproducible. Zip files do not support earlier dates.
+var archiveModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Artifact is a file created by the build in addition to the binaries, i.e.
+// an archive or the checksums file.
+type Artifact struct {
+	// Name is the name of the file.
+	Name string `json:"name"`
+
+	// Digest is the hex-encoded sha256 digest of the file.
+	Digest string `json:"digest"`
+}
+
+// builtBinary is a binary built for a target.
+type builtBinary struct {
+	// build is the build of the target.
+	build *GoBuild
+
+	// name is the resolved name of the binary.
+	name string
+
+	// path is the path the binary was written to.
+	path string
+}
+
+// archiveFile is a file added to an archive.
+type archiveFile struct {
+	// name is the path of the file in the archive.
+	name string
+
+	// content is the content of the file.
+	content []byte
+
+	// mode is the permission bits of the file.
+	mode os.FileMode
+}
+
+// hasArtifacts returns true if the build creates archives or a checksums
+// file.
+func (b *GoBuild) hasArtifacts() bool {
+	if b.cfg.Checksum != "" || b.cfg.Archive != nil {
+		return true
+	}
+	for _, t := range b.cfg.Targets {
+		if t.Archive != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writeArtifacts creates the archives of the binaries and the checksums file
+// in dir and shares their names and digests as the `go-artifacts` output.
+func (b *GoBuild) writeArtifacts(dir string, binaries []builtBinary) error {
+	var artifacts []Artifact
+	// checksums are the digests of the binaries and archives by name.
+	checksums := make(map[string]string)
+	for _, bin := range binaries {
+		digest, err := computeSHA256(bin.path)
+		if err != nil {
+			return err
+		}
+		checksums[bin.name] = digest
+
+		as, err := bin.build.writeArchives(dir, bin)
+		if err != nil {
+			return err
+		}
+		for _, a := range as {
+			if _, exists := checksums[a.Name]; exists {
+				return fmt.Errorf("%w: duplicate archive name %q", &errInvalidFilename{}, a.Name)
+			}
+			checksums[a.Name] = a.Digest
+		}
+		artifacts = append(artifacts, as...)
+	}
+
+	if b.cfg.Checksum != "" {
+		a, err := b.writeChecksums(dir, checksums)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, a)
+	}
+
+	martifacts, err := utils.MarshalToString(artifacts)
+	if err != nil {
+		return err
+	}
+	return github.SetOutput("go-artifacts", martifacts)
+}
+
+// writeArchives creates the archives of the binary in dir.
+func (b *GoBuild) writeArchives(dir string, bin builtBinary) ([]Artifact, error) {
+	if b.cfg.Archive == nil {
+		return nil, nil
+	}
+
+	name, err := b.resolveFilename(valueOrDefault(b.cfg.Archive.Name, b.cfg.Binary))
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := archiveFiles(bin, b.cfg.Archive.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	var artifacts []Artifact
+	for _, format := range b.cfg.Archive.Formats {
+		var buf bytes.Buffer
+		switch format {
+		case archiveFormatTarGz:
+			err = writeTarGz(&buf, files)
+		case archiveFormatZip:
+			err = writeZip(&buf, files)
+		default:
+			err = fmt.Errorf("%w: unsupported archive format %q", &ErrInvalidArchive{}, format)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := writeArtifact(dir, name+"."+format, buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, nil
+}
+
+// writeChecksums creates the checksums file of the binaries and archives in
+// dir, in the format of `sha256sum`.
+func (b *GoBuild) writeChecksums(dir string, checksums map[string]string) (Artifact, error) {
+	name, err := b.resolveFilename(b.cfg.Checksum)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	names := make([]string, 0, len(checksums))
+	for n := range checksums {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, n := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", checksums[n], n)
+	}
+	return writeArtifact(dir, name, buf.Bytes())
+}
+
+// writeArtifact writes the artifact name with content in dir.
+func writeArtifact(dir, name string, content []byte) (Artifact, error) {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return Artifact{}, fmt.Errorf("writing %q: %w", name, err)
+	}
+	digest, err := computeSHA256(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Name: name, Digest: digest}, nil
+}
+
+// archiveFiles returns the files of the archive of the binary, sorted by
+// name. The files are read relative to the current directory.
+func archiveFiles(bin builtBinary, paths []string) ([]archiveFile, error) {
+	content, err := os.ReadFile(filepath.Clean(bin.path))
+	if err != nil {
+		return nil, fmt.Errorf("reading binary: %w", err)
+	}
+	files := []archiveFile{{name: bin.name, content: content, mode: 0o755}}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{bin.name: true}
+	for _, p := range paths {
+		// Note: the paths were validated when the config was loaded, but
+		// they may go through symlinks.
+		name := filepath.ToSlash(filepath.Clean(p))
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate file %q in archive", &ErrInvalidArchive{}, name)
+		}
+		seen[name] = true
+
+		if err := checkNoSymlink(wd, p); err != nil {
+			return nil, err
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", &ErrInvalidArchive{}, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%w: %q is not a regular file", &ErrInvalidArchive{}, p)
+		}
+		content, err := os.ReadFile(filepath.Clean(p))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", &ErrInvalidArchive{}, err)
+		}
+
+		// Only the executable bit of the files is preserved.
+		mode := os.FileMode(0o644)
+		if info.Mode()&0o111 != 0 {
+			mode = 0o755
+		}
+		files = append(files, archiveFile{name: name, content: content, mode: mode})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	return files, nil
+}
+
+// checkNoSymlink returns an error if the file at path, relative to the
+// directory wd, or one of its parent directories under wd is a symlink. The
+// files of the archives must be files of the repository, and symlinks may
+// point outside of it.
+func checkNoSymlink(wd, path string) error {
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(wd, path)
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil {
+		return fmt.Errorf("%w: %v", &ErrInvalidArchive{}, err)
+	}
+	rwd, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return fmt.Errorf("%w: %v", &ErrInvalidArchive{}, err)
+	}
+	if resolved != filepath.Join(rwd, rel) {
+		return fmt.Errorf("%w: %q is a symlink or is under a symlink", &ErrInvalidArchive{}, path)
+	}
+	return nil
+}
+
+// writeTarGz writes a reproducible gzipped tarball of the files to w. The
+// files are owned by root and have a fixed modification time.
+func writeTarGz(w io.Writer, files []archiveFile) error {
+	// Note: the gzip header has no name nor modification time.
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Size:     int64(len(f.content)),
+			Mode:     int64(f.mode),
+			ModTime:  archiveModTime,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing %q header: %w", f.name, err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return fmt.Errorf("writing %q: %w", f.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// writeZip writes a reproducible zip archive of the files to w. The files
+// have a fixed modification time.
+func writeZip(w io.Writer, files []archiveFile) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		hdr := &zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: archiveModTime,
+		}
+		hdr.SetMode(f.mode)
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("writing %q header: %w", f.name, err)
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return fmt.Errorf("writing %q: %w", f.name, err)
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,358 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/utils"
+)
+
+var testArchiveFiles = []archiveFile{
+	{name: "LICENSE", content: []byte("license"), mode: 0o644},
+	{name: "binary", content: []byte("binary"), mode: 0o755},
+	{name: "docs/README.md", content: []byte("readme"), mode: 0o644},
+}
+
+func Test_writeTarGz(t *testing.T) {
+	t.Parallel()
+
+	var a, b bytes.Buffer
+	if err := writeTarGz(&a, testArchiveFiles); err != nil {
+		t.Fatalf("writeTarGz: %v", err)
+	}
+	if err := writeTarGz(&b, testArchiveFiles); err != nil {
+		t.Fatalf("writeTarGz: %v", err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Errorf("archives are not reproducible")
+	}
+
+	gr, err := gzip.NewReader(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gr.ModTime.IsZero() || gr.Name != "" {
+		t.Errorf("unexpected gzip header: %+v", gr.Header)
+	}
+
+	var got []archiveFile
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.ModTime.Equal(archiveModTime) || hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("unexpected header for %q: %+v", hdr.Name, hdr)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, archiveFile{name: hdr.Name, content: content, mode: os.FileMode(hdr.Mode)})
+	}
+	if diff := cmp.Diff(testArchiveFiles, got, cmp.AllowUnexported(archiveFile{})); diff != "" {
+		t.Errorf("unexpected files (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeZip(t *testing.T) {
+	t.Parallel()
+
+	var a, b bytes.Buffer
+	if err := writeZip(&a, testArchiveFiles); err != nil {
+		t.Fatalf("writeZip: %v", err)
+	}
+	if err := writeZip(&b, testArchiveFiles); err != nil {
+		t.Fatalf("writeZip: %v", err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Errorf("archives are not reproducible")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(a.Bytes()), int64(a.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []archiveFile
+	for _, f := range zr.File {
+		if !f.Modified.Equal(archiveModTime) {
+			t.Errorf("unexpected modification time for %q: %v", f.Name, f.Modified)
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, archiveFile{name: f.Name, content: content, mode: f.Mode()})
+	}
+	if diff := cmp.Diff(testArchiveFiles, got, cmp.AllowUnexported(archiveFile{})); diff != "" {
+		t.Errorf("unexpected files (-want +got):\n%s", diff)
+	}
+}
+
+func Test_archiveFiles(t *testing.T) {
+	t.Parallel()
+
+	binary := filepath.Join(t.TempDir(), "generated")
+	if err := os.WriteFile(binary, []byte("binary"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bin := builtBinary{name: "binary-linux-amd64", path: binary}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		names   []string
+		wantErr bool
+	}{
+		{
+			name:  "binary only",
+			names: []string{"binary-linux-amd64"},
+		},
+		{
+			name:  "sorted files",
+			paths: []string{"testdata/go/main.go", "./testdata/go/go.mod"},
+			names: []string{"binary-linux-amd64", "testdata/go/go.mod", "testdata/go/main.go"},
+		},
+		{
+			name:    "duplicate file",
+			paths:   []string{"testdata/go/main.go", "testdata/go/../go/main.go"},
+			wantErr: true,
+		},
+		{
+			name:    "directory",
+			paths:   []string{"testdata/go"},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			paths:   []string{"testdata/missing"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			files, err := archiveFiles(bin, tt.paths)
+			if tt.wantErr {
+				var errArchive *ErrInvalidArchive
+				if !errors.As(err, &errArchive) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, f := range files {
+				names = append(names, f.name)
+			}
+			if diff := cmp.Diff(tt.names, names); diff != "" {
+				t.Errorf("unexpected files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuild_writeArtifacts(t *testing.T) {
+	// NOTE: t.Setenv does not support parallel tests.
+	file, err := os.CreateTemp(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	t.Setenv("GITHUB_OUTPUT", file.Name())
+	t.Setenv("GITHUB_REF_NAME", "v1.2.3")
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "generated")
+	if err := os.WriteFile(binary, []byte("binary"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &GoReleaserConfig{
+		Goos:   "linux",
+		Goarch: "amd64",
+		Binary: "binary-{{ .Os }}-{{ .Arch }}",
+		Archive: &ArchiveConfig{
+			Formats: []string{"tar.gz", "zip"},
+			Name:    "project-{{ .Version }}-{{ .Os }}-{{ .Arch }}",
+			Files:   []string{"testdata/go/main.go"},
+		},
+		Checksum: "checksums.txt",
+	}
+	b := GoBuildNew("go", cfg)
+	if err := b.writeArtifacts(dir, []builtBinary{{build: b, name: "binary-linux-amd64", path: binary}}); err != nil {
+		t.Fatalf("writeArtifacts: %v", err)
+	}
+
+	// The artifacts are shared as an output.
+	var artifacts []Artifact
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "go-artifacts=") {
+			if err := utils.UnmarshalBase64(strings.TrimPrefix(line, "go-artifacts="), &artifacts); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var names []string
+	for _, a := range artifacts {
+		digest, err := computeSHA256(filepath.Join(dir, a.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest != a.Digest {
+			t.Errorf("unexpected digest for %q, got: %q, want: %q", a.Name, a.Digest, digest)
+		}
+		names = append(names, a.Name)
+	}
+	want := []string{"project-1.2.3-linux-amd64.tar.gz", "project-1.2.3-linux-amd64.zip", "checksums.txt"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("unexpected artifacts (-want +got):\n%s", diff)
+	}
+
+	// The checksums file covers the binary and archives.
+	checksums, err := os.ReadFile(filepath.Join(dir, "checksums.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaryDigest, err := computeSHA256(binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChecksums := fmt.Sprintf("%s  binary-linux-amd64\n%s  %s\n%s  %s\n",
+		binaryDigest,
+		artifacts[0].Digest, artifacts[0].Name,
+		artifacts[1].Digest, artifacts[1].Name,
+	)
+	if diff := cmp.Diff(wantChecksums, string(checksums)); diff != "" {
+		t.Errorf("unexpected checksums (-want +got):\n%s", diff)
+	}
+}
+
+func Test_archiveFiles_symlinks(t *testing.T) {
+	// NOTE: the test changes the current directory, so it is not parallel.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("docs", 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("docs", "README"), []byte("readme"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"link-outside": filepath.Join(outside, "secret"),
+		"link-inside":  filepath.Join("docs", "README"),
+		"dir-outside":  outside,
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	binary := filepath.Join(t.TempDir(), "generated")
+	if err := os.WriteFile(binary, []byte("binary"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bin := builtBinary{name: "binary-linux-amd64", path: binary}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{
+			name: "regular file",
+			path: "docs/README",
+		},
+		{
+			name: "absolute path",
+			path: filepath.Join(dir, "docs", "README"),
+		},
+		{
+			name:    "symlink outside",
+			path:    "link-outside",
+			wantErr: true,
+		},
+		{
+			name:    "symlink inside",
+			path:    "link-inside",
+			wantErr: true,
+		},
+		{
+			name:    "symlinked directory",
+			path:    "dir-outside/secret",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := archiveFiles(bin, []string{tt.path})
+			if tt.wantErr {
+				var errArchive *ErrInvalidArchive
+				if !errors.As(err, &errArchive) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/slsa-framework/slsa-github-generator/github"
 	"github.com/slsa-framework/slsa-github-generator/internal/errors"
@@ -28,26 +29,6 @@ import (
 	"github.com/slsa-framework/slsa-github-generator/internal/utils"
 )
 
-var unknownTag = "unknown"
-
-// See `go build help`.
-// `-asmflags`, `-n`, `-mod`, `-installsuffix`, `-modfile`,
-// `-workfile`, `-overlay`, `-pkgdir`, `-toolexec`, `-o`,
-// `-modcacherw`, `-work` not supported for now.
-
-var allowedBuildArgs = map[string]bool{
-	"-a": true, "-race": true, "-msan": true, "-asan": true,
-	"-v": true, "-x": true, "-buildinfo": true,
-	"-buildmode": true, "-buildvcs": true, "-compiler": true,
-	"-gccgoflags": true, "-gcflags": true,
-	"-ldflags": true, "-linkshared": true,
-	"-tags": true, "-trimpath": true,
-}
-
-var allowedEnvVariablePrefix = map[string]bool{
-	"GO": true, "CGO_": true,
-}
-
 type errEnvVariableNameEmpty struct {
 	errors.WrappableError
 }
@@ -68,12 +49,23 @@ type errInvalidFilename struct {
 	errors.WrappableError
 }
 
+type errInvalidTag struct {
+	errors.WrappableError
+}
+
 // GoBuild implements building a Go application.
 type GoBuild struct {
 	cfg *GoReleaserConfig
 	// Note: static env variables are contained in cfg.Env.
 	argEnv map[string]string
 	goc    string
+
+	// variables are the values of the template variables used in the
+	// config. They are recorded in the provenance.
+	variables map[string]string
+
+	// date is the date of the build, see Date.
+	date time.Time
 }
 
 // GoBuildNew returns a new GoBuild.
@@ -87,36 +79,39 @@ func GoBuildNew(goc string, cfg *GoReleaserConfig) *GoBuild {
 	return &c
 }
 
-// Run executes the build.
-func (b *GoBuild) Run(dry bool) error {
-	// Get directory.
-	dir, err := b.getDir()
-	if err != nil {
-		return err
-	}
-	// Set flags.
-	flags, err := b.generateFlags()
-	if err != nil {
-		return err
-	}
+// Target describes the build of a binary.
+type Target struct {
+	// Binary is the resolved name of the binary.
+	Binary string `json:"binary"`
 
-	// Generate env variables.
-	envs, err := b.generateCommandEnvVariables()
-	if err != nil {
-		return err
+	// Variables are the values of the template variables used to build the
+	// binary.
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Digest is the hex-encoded sha256 digest of the binary. It is only set
+	// after the binary is built.
+	Digest string `json:"digest,omitempty"`
+
+	// Command is the command used to compile the binary.
+	Command []string `json:"command"`
+
+	// Env are the env variables used to compile the binary.
+	Env []string `json:"env"`
+}
+
+// Run executes the build. Configs with multiple targets are built with one
+// command per target.
+func (b *GoBuild) Run(dry bool) error {
+	if len(b.cfg.Targets) > 0 {
+		return b.runTargets(dry)
 	}
 
-	// Generate ldflags.
-	ldflags, err := b.generateLdflags()
+	// Get directory.
+	dir, err := b.getDir()
 	if err != nil {
 		return err
 	}
 
-	// Add ldflags.
-	if len(ldflags) > 0 {
-		flags = append(flags, fmt.Sprintf("-ldflags=%s", ldflags))
-	}
-
 	// A dry run prints the information that is trusted, before
 	// the compiler is invoked.
 	if dry {
@@ -130,22 +125,13 @@ func (b *GoBuild) Run(dry bool) error {
 			return err
 		}
 
-		// Generate the command.
-		com := b.generateCommand(flags, filename)
-
-		env, err := b.generateCommandEnvVariables()
+		step, err := b.generateStep(dir, filename)
 		if err != nil {
 			return err
 		}
 
 		r := runner.CommandRunner{
-			Steps: []*runner.CommandStep{
-				{
-					Command:    com,
-					Env:        env,
-					WorkingDir: dir,
-				},
-			},
+			Steps: []*runner.CommandStep{step},
 		}
 
 		steps, err := r.Dry()
@@ -179,6 +165,23 @@ func (b *GoBuild) Run(dry bool) error {
 			return err
 		}
 
+		// Share the template variables used.
+		variables, err := utils.MarshalToString(b.variables)
+		if err != nil {
+			return err
+		}
+		if err := github.SetOutput("go-variables", variables); err != nil {
+			return err
+		}
+
+		if err := b.setWorkspaceOutput(); err != nil {
+			return err
+		}
+
+		if err := b.setModOutputs(steps[0].Env); err != nil {
+			return err
+		}
+
 		// Share working directory necessary for issuing the vendoring command.
 		return github.SetOutput("go-working-dir", dir)
 	}
@@ -188,27 +191,213 @@ func (b *GoBuild) Run(dry bool) error {
 		return err
 	}
 
-	// Generate the command.
-	command := b.generateCommand(flags, binary)
+	step, err := b.generateStep(dir, binary)
+	if err != nil {
+		return err
+	}
 
 	fmt.Println("dir", dir)
 	fmt.Println("binary", binary)
-	fmt.Println("command", command)
-	fmt.Println("env", envs)
+	fmt.Println("command", step.Command)
+	fmt.Println("env", step.Env)
 
 	r := runner.CommandRunner{
-		Steps: []*runner.CommandStep{
-			{
-				Command:    command,
-				Env:        envs,
-				WorkingDir: dir,
-			},
-		},
+		Steps: b.setupSteps(dir, step.Env),
 	}
+	r.Steps = append(r.Steps, step)
 
 	// TODO: Add a timeout?
-	_, err = r.Run(context.Background())
-	return err
+	if _, err := r.Run(context.Background()); err != nil {
+		return err
+	}
+
+	if !b.hasArtifacts() {
+		return nil
+	}
+
+	// The archives use the resolved name of the binary rather than
+	// `OUTPUT_BINARY`.
+	filename, err := b.generateOutputFilename()
+	if err != nil {
+		return err
+	}
+
+	// Archives and checksums are written next to the binary.
+	return b.writeArtifacts(filepath.Dir(binary), []builtBinary{
+		{build: b, name: filename, path: binary},
+	})
+}
+
+// runTargets builds each target of a multi-target config. The binaries are
+// written to the directory given by `OUTPUT_DIR` under their resolved names.
+func (b *GoBuild) runTargets(dry bool) error {
+	// Note: all targets share the same directory.
+	dir, err := b.getDir()
+	if err != nil {
+		return err
+	}
+
+	var outputDir string
+	if !dry {
+		// `OUTPUT_DIR` is a trusted variable defined by the re-usable
+		// workflow, like `OUTPUT_BINARY` for single-target configs.
+		outputDir, err = getOutputDir(os.Getenv("OUTPUT_DIR"))
+		if err != nil {
+			return err
+		}
+	}
+
+	var builds []*GoBuild
+	var filenames []string
+	var binaries []builtBinary
+	var r runner.CommandRunner
+	seen := make(map[string]bool)
+	for _, cfg := range b.cfg.Targets {
+		tb := &GoBuild{
+			cfg:    cfg,
+			argEnv: b.argEnv,
+			goc:    b.goc,
+		}
+
+		filename, err := tb.generateOutputFilename()
+		if err != nil {
+			return err
+		}
+		if seen[filename] {
+			return fmt.Errorf("%w: duplicate binary name %q", &errInvalidFilename{}, filename)
+		}
+		seen[filename] = true
+		filenames = append(filenames, filename)
+
+		binary := filename
+		if !dry {
+			binary = filepath.Join(outputDir, filename)
+		}
+		step, err := tb.generateStep(dir, binary)
+		if err != nil {
+			return err
+		}
+		r.Steps = append(r.Steps, step)
+		builds = append(builds, tb)
+		binaries = append(binaries, builtBinary{build: tb, name: filename, path: binary})
+	}
+
+	if !dry {
+		fmt.Println("dir", dir)
+		for _, step := range r.Steps {
+			fmt.Println("command", step.Command)
+			fmt.Println("env", step.Env)
+		}
+
+		// Note: all targets share the module env variables.
+		r.Steps = append(b.setupSteps(dir, r.Steps[0].Env), r.Steps...)
+
+		// TODO: Add a timeout?
+		if _, err := r.Run(context.Background()); err != nil {
+			return err
+		}
+
+		if !b.hasArtifacts() {
+			return nil
+		}
+		return b.writeArtifacts(outputDir, binaries)
+	}
+
+	steps, err := r.Dry()
+	if err != nil {
+		return err
+	}
+
+	targets := make([]Target, len(steps))
+	for i, step := range steps {
+		targets[i] = Target{
+			Binary:    filenames[i],
+			Variables: builds[i].variables,
+			Command:   step.Command,
+			Env:       step.Env,
+		}
+	}
+	mtargets, err := utils.MarshalToString(targets)
+	if err != nil {
+		return err
+	}
+
+	// Share the resolved names, template variables, commands and env
+	// variables of the targets.
+	if err := github.SetOutput("go-targets", mtargets); err != nil {
+		return err
+	}
+
+	if err := b.setWorkspaceOutput(); err != nil {
+		return err
+	}
+
+	// Note: all targets share the module env variables.
+	if err := b.setModOutputs(steps[0].Env); err != nil {
+		return err
+	}
+
+	// Share working directory necessary for issuing the vendoring command.
+	return github.SetOutput("go-working-dir", dir)
+}
+
+// setupSteps returns the steps run before the compilation in dir with the
+// compilation env variables env. In ModReadonly mode, the module
+// dependencies are downloaded and verified. In ModVendor mode, the
+// dependencies are vendored by the workflow beforehand, so there is none.
+func (b *GoBuild) setupSteps(dir string, env []string) []*runner.CommandStep {
+	if b.cfg.mod() != ModReadonly {
+		return nil
+	}
+	return downloadSteps(b.goc, dir, env)
+}
+
+// setModOutputs shares the `mod` mode of the build as the `go-mod` output,
+// and the module env variables of the compilation env variables env as the
+// `go-module-env` output. The workflow uses them to vendor or download the
+// dependencies before the build.
+func (b *GoBuild) setModOutputs(env []string) error {
+	if err := github.SetOutput("go-mod", b.cfg.mod()); err != nil {
+		return err
+	}
+
+	menv, err := utils.MarshalToString(moduleEnv(env))
+	if err != nil {
+		return err
+	}
+	return github.SetOutput("go-module-env", menv)
+}
+
+// generateStep generates the command step compiling the binary.
+func (b *GoBuild) generateStep(dir, binary string) (*runner.CommandStep, error) {
+	// Set flags.
+	flags, err := b.generateFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate env variables.
+	envs, err := b.generateCommandEnvVariables()
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate ldflags.
+	ldflags, err := b.generateLdflags()
+	if err != nil {
+		return nil, err
+	}
+
+	// Add ldflags.
+	if len(ldflags) > 0 {
+		flags = append(flags, fmt.Sprintf("-ldflags=%s", ldflags))
+	}
+
+	return &runner.CommandStep{
+		Command:    b.generateCommand(flags, binary),
+		Env:        envs,
+		WorkingDir: dir,
+	}, nil
 }
 
 func getOutputBinaryPath(binary string) (string, error) {
@@ -231,7 +420,41 @@ func getOutputBinaryPath(binary string) (string, error) {
 	return binary, nil
 }
 
+func getOutputDir(dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("%w: OUTPUT_DIR not defined", &errInvalidFilename{})
+	}
+
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("%w: %v is not an absolute path", &errInvalidFilename{}, dir)
+	}
+
+	return filepath.Clean(dir), nil
+}
+
+// getDir returns the directory the binary is compiled in, i.e. the
+// directory of the workspace module to build if set, and the `dir` of the
+// config otherwise.
 func (b *GoBuild) getDir() (string, error) {
+	if b.cfg.Module == "" {
+		return b.getConfigDir()
+	}
+
+	w, err := b.getWorkspace()
+	if err != nil {
+		return "", err
+	}
+	if w == nil {
+		return "", errors.Errorf(&ErrInvalidWorkspace{}, "module %q requires a go.work file", b.cfg.Module)
+	}
+	m, err := w.module(b.cfg.Module)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(w.Dir, filepath.FromSlash(m.Dir)), nil
+}
+
+func (b *GoBuild) getConfigDir() (string, error) {
 	if b.cfg.Dir == nil {
 		return os.Getenv("PWD"), nil
 	}
@@ -245,6 +468,44 @@ func (b *GoBuild) getDir() (string, error) {
 	return fp, nil
 }
 
+// getWorkspace returns the go.work workspace of the build, searched from the
+// `dir` of the config up to the root of the repository. It returns nil if
+// there is no workspace or if workspaces are disabled with `GOWORK=off`.
+func (b *GoBuild) getWorkspace() (*Workspace, error) {
+	if b.cfg.Env["GOWORK"] == "off" {
+		if b.cfg.Module != "" {
+			return nil, errors.Errorf(&ErrInvalidWorkspace{}, "module %q requires a go.work file", b.cfg.Module)
+		}
+		return nil, nil
+	}
+
+	dir, err := b.getConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return findWorkspace(dir, os.Getenv("PWD"))
+}
+
+// setWorkspaceOutput shares the workspace of the build, if any, as the
+// `go-workspace` output, and its directory as the `go-workspace-dir` output.
+// The vendoring of a workspace uses `go work vendor` in the workspace
+// directory instead of `go mod vendor` in the working directory.
+func (b *GoBuild) setWorkspaceOutput() error {
+	w, err := b.getWorkspace()
+	if err != nil || w == nil {
+		return err
+	}
+
+	mw, err := utils.MarshalToString(w)
+	if err != nil {
+		return err
+	}
+	if err := github.SetOutput("go-workspace", mw); err != nil {
+		return err
+	}
+	return github.SetOutput("go-workspace-dir", w.Dir)
+}
+
 func (b *GoBuild) generateCommand(flags []string, binary string) []string {
 	var command []string
 	command = append(command, flags...)
@@ -272,11 +533,12 @@ func (b *GoBuild) generateCommandEnvVariables() ([]string, error) {
 
 	// Set env variables from config file.
 	for k, v := range b.cfg.Env {
-		if !isAllowedEnvVariable(k) {
-			return env, fmt.Errorf("%w: %s", &errEnvVariableNameNotAllowed{}, v)
+		e := fmt.Sprintf("%s=%s", k, v)
+		if err := b.cfg.policy().checkEnv(e); err != nil {
+			return env, fmt.Errorf("%w: %v", &errEnvVariableNameNotAllowed{}, err)
 		}
 
-		env = append(env, fmt.Sprintf("%s=%s", k, v))
+		env = append(env, e)
 	}
 
 	return env, nil
@@ -312,6 +574,12 @@ func (b *GoBuild) SetArgEnvVariables(envs string) error {
 }
 
 func (b *GoBuild) generateOutputFilename() (string, error) {
+	return b.resolveFilename(b.cfg.Binary)
+}
+
+// resolveFilename resolves the variables in the filename template and
+// validates the resulting filename.
+func (b *GoBuild) resolveFilename(template string) (string, error) {
 	// Note: the `.` is needed to accommodate the semantic version
 	// as part of the name.
 	const alpha = ".abcdefghijklmnopqrstuvwxyz1234567890-_"
@@ -319,7 +587,7 @@ func (b *GoBuild) generateOutputFilename() (string, error) {
 	var name string
 
 	// Special variables.
-	name, err := b.resolveSpecialVariables(b.cfg.Binary)
+	name, err := b.resolveSpecialVariables(template)
 	if err != nil {
 		return "", err
 	}
@@ -350,38 +618,18 @@ func (b *GoBuild) generateOutputFilename() (string, error) {
 
 func (b *GoBuild) generateFlags() ([]string, error) {
 	// -x
-	flags := []string{b.goc, "build", "-mod=vendor"}
+	flags := []string{b.goc, "build", "-mod=" + b.cfg.mod()}
 
+	p := b.cfg.policy()
 	for _, v := range b.cfg.Flags {
-		if !isAllowedArg(v) {
-			return nil, fmt.Errorf("%w: %s", &errUnsupportedArguments{}, v)
+		if err := p.checkFlag(v); err != nil {
+			return nil, fmt.Errorf("%w: %v", &errUnsupportedArguments{}, err)
 		}
 		flags = append(flags, v)
 	}
 	return flags, nil
 }
 
-func isAllowedArg(arg string) bool {
-	for k := range allowedBuildArgs {
-		if strings.HasPrefix(arg, k) {
-			return true
-		}
-	}
-	return false
-}
-
-// Check if the env variable is allowed. We want to avoid
-// variable injection, e.g. LD_PRELOAD, etc.
-// See an overview in https://www.hale-legacy.com/class/security/s20/handout/slides-env-vars.pdf.
-func isAllowedEnvVariable(name string) bool {
-	for k := range allowedEnvVariablePrefix {
-		if strings.HasPrefix(name, k) {
-			return true
-		}
-	}
-	return false
-}
-
 // TODO: maybe not needed if handled directly by go compiler.
 func (b *GoBuild) generateLdflags() (string, error) {
 	var a []string
@@ -410,31 +658,17 @@ func (b *GoBuild) generateLdflags() (string, error) {
 }
 
 func (b *GoBuild) resolveSpecialVariables(s string) (string, error) {
-	reVar := regexp.MustCompile(`{{ \.([A-Z][a-z]*) }}`)
+	reVar := regexp.MustCompile(`{{ \.([A-Z][A-Za-z]*) }}`)
 	names := reVar.FindAllString(s, -1)
 	for _, n := range names {
 		name := strings.ReplaceAll(n, "{{ .", "")
 		name = strings.ReplaceAll(name, " }}", "")
 
-		switch name {
-		case "Os":
-			if b.cfg.Goos == "" {
-				return "", fmt.Errorf("%w: {{ .Os }}", &errEnvVariableNameEmpty{})
-			}
-			s = strings.ReplaceAll(s, n, b.cfg.Goos)
-
-		case "Arch":
-			if b.cfg.Goarch == "" {
-				return "", fmt.Errorf("%w: {{ .Arch }}", &errEnvVariableNameEmpty{})
-			}
-			s = strings.ReplaceAll(s, n, b.cfg.Goarch)
-
-		case "Tag":
-			tag := getTag()
-			s = strings.ReplaceAll(s, n, tag)
-		default:
-			return "", fmt.Errorf("%w: %s", &errInvalidEnvArgument{}, n)
+		value, err := b.variable(name)
+		if err != nil {
+			return "", err
 		}
+		s = strings.ReplaceAll(s, n, value)
 	}
 	return s, nil
 }
@@ -454,11 +688,3 @@ func (b *GoBuild) resolveEnvVariables(s string) (string, error) {
 	}
 	return s, nil
 }
-
-func getTag() string {
-	tag := os.Getenv("GITHUB_REF_NAME")
-	if tag == "" {
-		return unknownTag
-	}
-	return tag
-}
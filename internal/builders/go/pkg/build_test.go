@@ -15,10 +15,14 @@
 package pkg
 
 import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -60,48 +64,6 @@ func errInvalidFilenameFunc(t *testing.T, got error) {
 	}
 }
 
-func Test_isAllowedEnvVariable(t *testing.T) {
-	t.Parallel()
-
-	tests := []struct {
-		name     string
-		variable string
-		expected bool
-	}{
-		{
-			name:     "BLA variable",
-			variable: "BLA",
-			expected: false,
-		},
-		{
-			name:     "random variable",
-			variable: "random",
-			expected: false,
-		},
-		{
-			name:     "GOSOMETHING variable",
-			variable: "GOSOMETHING",
-			expected: true,
-		},
-		{
-			name:     "CGO_SOMETHING variable",
-			variable: "CGO_SOMETHING",
-			expected: true,
-		},
-	}
-	for _, tt := range tests {
-		tt := tt // Re-initializing variable so it is not changed while executing the closure below
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-
-			r := isAllowedEnvVariable(tt.variable)
-			if !cmp.Equal(r, tt.expected) {
-				t.Errorf(cmp.Diff(r, tt.expected))
-			}
-		})
-	}
-}
-
 func Test_getOutputBinaryPath(t *testing.T) {
 	t.Parallel()
 
@@ -146,49 +108,6 @@ func Test_getOutputBinaryPath(t *testing.T) {
 	}
 }
 
-func Test_isAllowedArg(t *testing.T) {
-	t.Parallel()
-
-	type test struct {
-		name     string
-		argument string
-		expected bool
-	}
-
-	var tests []test
-
-	for k := range allowedBuildArgs {
-		tests = append(tests, test{
-			name:     fmt.Sprintf("%s argument", k),
-			argument: k,
-			expected: true,
-		}, test{
-			name:     fmt.Sprintf("%sbla argument", k),
-			argument: fmt.Sprintf("%sbla", k),
-			expected: true,
-		}, test{
-			name:     fmt.Sprintf("bla %s argument", k),
-			argument: fmt.Sprintf("bla%s", k),
-			expected: false,
-		}, test{
-			name:     fmt.Sprintf("space %s argument", k),
-			argument: fmt.Sprintf(" %s", k),
-			expected: false,
-		})
-	}
-	for _, tt := range tests {
-		tt := tt // Re-initializing variable so it is not changed while executing the closure below
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-
-			r := isAllowedArg(tt.argument)
-			if !cmp.Equal(r, tt.expected) {
-				t.Errorf(cmp.Diff(r, tt.expected))
-			}
-		})
-	}
-}
-
 func Test_generateOutputFilename(t *testing.T) {
 	// Disable to avoid env clobbering between tests.
 	// t.Parallel()
@@ -685,18 +604,42 @@ func Test_generateEnvVariables(t *testing.T) {
 			},
 		},
 		{
-			name:   "invalid flags",
+			name:   "prefixed flags",
 			goos:   "windows",
 			goarch: "amd64",
-			env:    []string{"GOVAR1=value1", "GOVAR2=value2", "CGO_VAR1=val1", "CGO_VAR2=val2"},
+			env:    []string{"GOVAR1=value1", "CGO_VAR1=val1"},
+			expected: struct {
+				err   func(*testing.T, error)
+				flags []string
+			}{
+				err: errEnvVariableNameNotAllowedFunc,
+			},
+		},
+		{
+			name:   "denied flag value",
+			goos:   "windows",
+			goarch: "amd64",
+			env:    []string{"GOFLAGS=-mod=mod"},
+			expected: struct {
+				err   func(*testing.T, error)
+				flags []string
+			}{
+				err: errEnvVariableNameNotAllowedFunc,
+			},
+		},
+		{
+			name:   "valid flags",
+			goos:   "windows",
+			goarch: "amd64",
+			env:    []string{"GO111MODULE=on", "GOAMD64=v3", "CGO_ENABLED=1", "CGO_CFLAGS=-O2"},
 			expected: struct {
 				err   func(*testing.T, error)
 				flags []string
 			}{
 				flags: []string{
 					"GOOS=windows", "GOARCH=amd64",
-					"GOVAR1=value1", "GOVAR2=value2",
-					"CGO_VAR1=val1", "CGO_VAR2=val2",
+					"GO111MODULE=on", "GOAMD64=v3",
+					"CGO_ENABLED=1", "CGO_CFLAGS=-O2",
 				},
 				err: nil,
 			},
@@ -918,12 +861,18 @@ func Test_generateFlags(t *testing.T) {
 		name  string
 		err   func(*testing.T, error)
 		flags []string
+		mod   string
 	}{
 		{
 			name:  "valid flags",
 			flags: []string{"-race", "-x"},
 			err:   nil,
 		},
+		{
+			name:  "readonly mod",
+			flags: []string{"-trimpath"},
+			mod:   ModReadonly,
+		},
 		{
 			name:  "invalid -mod flags",
 			flags: []string{"-mod=whatever", "-x"},
@@ -961,6 +910,7 @@ func Test_generateFlags(t *testing.T) {
 			cfg := goReleaserConfigFile{
 				Version: 1,
 				Flags:   tt.flags,
+				Mod:     tt.mod,
 			}
 			c, err := fromConfig(&cfg)
 			if err != nil {
@@ -969,7 +919,11 @@ func Test_generateFlags(t *testing.T) {
 			b := GoBuildNew("gocompiler", c)
 
 			flags, err := b.generateFlags()
-			expectedFlags := append([]string{"gocompiler", "build", "-mod=vendor"}, tt.flags...)
+			mod := ModVendor
+			if tt.mod != "" {
+				mod = tt.mod
+			}
+			expectedFlags := append([]string{"gocompiler", "build", "-mod=" + mod}, tt.flags...)
 
 			if tt.err != nil {
 				tt.err(t, err)
@@ -1184,3 +1138,185 @@ func TestGoBuild_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestGoBuild_Run_targets(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		targets []Target
+		err     func(*testing.T, error)
+	}{
+		{
+			name: "multiple targets",
+			config: `
+version: 2
+env:
+  - CGO_ENABLED=0
+flags:
+  - -trimpath
+main: main.go
+binary: binary-{{ .Os }}-{{ .Arch }}
+ldflags:
+  - "{{ .Env.VERSION_LDFLAGS }}"
+targets:
+  - goos: linux
+    goarch: amd64
+  - goos: windows
+    goarch: amd64
+    binary: binary-{{ .Os }}-{{ .Arch }}.exe
+    env:
+      - CGO_ENABLED=1
+    flags:
+      - -tags=netgo
+`,
+			targets: []Target{
+				{
+					Binary:    "binary-linux-amd64",
+					Variables: map[string]string{"Os": "linux", "Arch": "amd64"},
+					Command:   []string{"go", "build", "-mod=vendor", "-trimpath", "-ldflags=-X main.version=1.0.0", "-o", "binary-linux-amd64", "main.go"},
+					Env:       []string{"GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0"},
+				},
+				{
+					Binary:    "binary-windows-amd64.exe",
+					Variables: map[string]string{"Os": "windows", "Arch": "amd64"},
+					Command:   []string{"go", "build", "-mod=vendor", "-trimpath", "-tags=netgo", "-ldflags=-X main.version=1.0.0", "-o", "binary-windows-amd64.exe", "main.go"},
+					Env:       []string{"GOOS=windows", "GOARCH=amd64", "CGO_ENABLED=1"},
+				},
+			},
+		},
+		{
+			name: "duplicate binary names",
+			config: `
+version: 2
+binary: binary
+targets:
+  - goos: linux
+    goarch: amd64
+  - goos: linux
+    goarch: arm64
+`,
+			err: errInvalidFilenameFunc,
+		},
+		{
+			name: "missing arch",
+			config: `
+version: 2
+binary: binary-{{ .Os }}
+targets:
+  - goos: linux
+`,
+			err: errEnvVariableNameEmptyFunc,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			// NOTE: t.Setenv does not support parallel tests.
+			file, err := os.CreateTemp(t.TempDir(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			t.Setenv("GITHUB_OUTPUT", file.Name())
+
+			cfg, err := configFromString([]byte(tt.config), nil)
+			if err != nil {
+				t.Fatalf("configFromString: %v", err)
+			}
+			b := GoBuildNew("go", cfg)
+			b.argEnv["VERSION_LDFLAGS"] = "-X main.version=1.0.0"
+
+			err = b.Run(true)
+			if tt.err != nil {
+				tt.err(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			var targets []Target
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				if !strings.HasPrefix(scanner.Text(), "go-targets=") {
+					continue
+				}
+				value := strings.TrimPrefix(scanner.Text(), "go-targets=")
+				b, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal(b, &targets); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sorted := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+			if diff := cmp.Diff(tt.targets, targets, sorted); diff != "" {
+				t.Errorf("unexpected targets (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuild_setModOutputs(t *testing.T) {
+	tests := []struct {
+		name      string
+		mod       string
+		env       []string
+		expected  string
+		moduleEnv []string
+	}{
+		{
+			name:     "vendor",
+			env:      []string{"GOOS=linux", "GOPROXY=https://proxy.example.com"},
+			expected: ModVendor,
+			// Note: the module env is shared in all modes.
+			moduleEnv: []string{"GOPROXY=https://proxy.example.com"},
+		},
+		{
+			name:      "readonly",
+			mod:       ModReadonly,
+			env:       []string{"GOOS=linux", "GOFLAGS=-modcacherw", "GONOSUMDB=example.com"},
+			expected:  ModReadonly,
+			moduleEnv: []string{"GOFLAGS=-modcacherw", "GONOSUMDB=example.com"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			// NOTE: t.Setenv does not support parallel tests.
+			file, err := os.CreateTemp(t.TempDir(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			t.Setenv("GITHUB_OUTPUT", file.Name())
+
+			if err := GoBuildNew("go", &GoReleaserConfig{Mod: tt.mod}).setModOutputs(tt.env); err != nil {
+				t.Fatalf("setModOutputs: %v", err)
+			}
+
+			outputs := make(map[string]string)
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				name, value, _ := strings.Cut(scanner.Text(), "=")
+				outputs[name] = value
+			}
+			if outputs["go-mod"] != tt.expected {
+				t.Errorf("unexpected go-mod, got: %v, want: %v", outputs["go-mod"], tt.expected)
+			}
+			b, err := base64.StdEncoding.DecodeString(outputs["go-module-env"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var moduleEnv []string
+			if err := json.Unmarshal(b, &moduleEnv); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.moduleEnv, moduleEnv); diff != "" {
+				t.Errorf("unexpected module env (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
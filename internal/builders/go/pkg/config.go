@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	gomodule "golang.org/x/mod/module"
 	"gopkg.in/yaml.v3"
 
 	"github.com/slsa-framework/slsa-github-generator/internal/errors"
@@ -28,8 +29,20 @@ import (
 
 var supportedVersions = map[int]bool{
 	1: true,
+	2: true,
 }
 
+const (
+	// ModVendor builds with the vendored dependencies, i.e. with
+	// `-mod=vendor` after `go mod vendor`.
+	ModVendor = "vendor"
+
+	// ModReadonly builds with the dependencies downloaded from the module
+	// proxy, i.e. with `-mod=readonly` after `go mod download` and
+	// `go mod verify`.
+	ModReadonly = "readonly"
+)
+
 type goReleaserConfigFile struct {
 	Main    *string  `yaml:"main"`
 	Dir     *string  `yaml:"dir"`
@@ -40,6 +53,41 @@ type goReleaserConfigFile struct {
 	Flags   []string `yaml:"flags"`
 	Ldflags []string `yaml:"ldflags"`
 	Version int      `yaml:"version"`
+
+	// Module is the path of the workspace module to build.
+	Module string `yaml:"module"`
+
+	// Mod is the module download mode: `vendor` or `readonly`.
+	Mod string `yaml:"mod"`
+
+	// Targets is only supported in version 2.
+	Targets []goReleaserTargetFile `yaml:"targets"`
+
+	Archive  *goReleaserArchiveFile  `yaml:"archive"`
+	Checksum *goReleaserChecksumFile `yaml:"checksum"`
+}
+
+// goReleaserArchiveFile configures the archives of the binaries.
+type goReleaserArchiveFile struct {
+	Formats []string `yaml:"formats"`
+	Name    string   `yaml:"name"`
+	Files   []string `yaml:"files"`
+}
+
+// goReleaserChecksumFile configures the checksums file.
+type goReleaserChecksumFile struct {
+	Name string `yaml:"name"`
+}
+
+// goReleaserTargetFile is a build target in a version 2 config file. Unset
+// fields are inherited from the top-level fields of the config file.
+type goReleaserTargetFile struct {
+	Goos    string   `yaml:"goos"`
+	Goarch  string   `yaml:"goarch"`
+	Binary  string   `yaml:"binary"`
+	Env     []string `yaml:"env"`
+	Flags   []string `yaml:"flags"`
+	Ldflags []string `yaml:"ldflags"`
 }
 
 // GoReleaserConfig tracks configuration for goreleaser.
@@ -52,6 +100,46 @@ type GoReleaserConfig struct {
 	Binary  string
 	Flags   []string
 	Ldflags []string
+
+	// Module is the path of the module of the go.work workspace to build.
+	// The module is built in its directory, and the workspace is searched
+	// from Dir. It is empty if the build is not in a workspace or is in Dir.
+	Module string
+
+	// Mod is the module download mode of the build, i.e. the value of the
+	// `-mod` flag: ModVendor or ModReadonly. ModVendor is used if empty.
+	Mod string
+
+	// Targets are the build targets of a version 2 config, with the
+	// top-level fields of the config applied. It is empty for version 1
+	// configs, which have a single target.
+	Targets []*GoReleaserConfig
+
+	// Archive configures the archives of the binary. No archive is
+	// created if nil.
+	Archive *ArchiveConfig
+
+	// Checksum is the name of the checksums file of the binaries and
+	// archives. No checksums file is created if empty.
+	Checksum string
+
+	// Policy is the allowlist of the flags and env variables. The default
+	// policy is used if nil.
+	Policy *Policy
+}
+
+// ArchiveConfig configures the archives of a binary.
+type ArchiveConfig struct {
+	// Formats are the formats of the archives, i.e. `tar.gz` or `zip`.
+	Formats []string
+
+	// Name is the name of the archives without extension. It defaults to
+	// the name of the binary.
+	Name string
+
+	// Files are the files included in the archives in addition to the
+	// binary, e.g. LICENSE or README.md.
+	Files []string
 }
 
 // ErrUnsupportedVersion indicates an unsupported Go builder version.
@@ -64,23 +152,56 @@ type ErrInvalidDirectory struct {
 	errors.WrappableError
 }
 
+// ErrInvalidMod indicates an unsupported module download mode.
+type ErrInvalidMod struct {
+	errors.WrappableError
+}
+
 // ErrInvalidEnvironmentVariable indicates  an invalid environment variable.
 type ErrInvalidEnvironmentVariable struct {
 	errors.WrappableError
 }
 
-func configFromString(b []byte) (*GoReleaserConfig, error) {
+// ErrInvalidTarget indicates an invalid build target.
+type ErrInvalidTarget struct {
+	errors.WrappableError
+}
+
+// ErrInvalidArchive indicates an invalid archive or checksum configuration.
+type ErrInvalidArchive struct {
+	errors.WrappableError
+}
+
+func configFromString(b []byte, p *Policy) (*GoReleaserConfig, error) {
+	// Note: the document is kept to report the line of policy violations.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("yaml.Unmarshal: %w", err)
+	}
 	var cf goReleaserConfigFile
-	if err := yaml.Unmarshal(b, &cf); err != nil {
+	if err := doc.Decode(&cf); err != nil {
 		return nil, fmt.Errorf("yaml.Unmarshal: %w", err)
 	}
 
-	return fromConfig(&cf)
+	cfg, err := fromConfig(&cf)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		p = DefaultPolicy()
+	}
+	if err := checkConfigPolicy(&doc, p); err != nil {
+		return nil, err
+	}
+	cfg.setPolicy(p)
+	return cfg, nil
 }
 
 // ConfigFromFile reads the file located at path and builds a GoReleaserConfig
-// from it.
-func ConfigFromFile(path string) (*GoReleaserConfig, error) {
+// from it. The flags and env variables of the file are checked against the
+// policy, or the default policy if nil.
+func ConfigFromFile(path string, p *Policy) (*GoReleaserConfig, error) {
 	if err := validatePath(path); err != nil {
 		return nil, fmt.Errorf("%q: %w", path, err)
 	}
@@ -90,7 +211,7 @@ func ConfigFromFile(path string) (*GoReleaserConfig, error) {
 		return nil, fmt.Errorf("%q: os.ReadFile: %w", path, err)
 	}
 
-	c, err := configFromString(cfg)
+	c, err := configFromString(cfg, p)
 	if err != nil {
 		return nil, fmt.Errorf("%q: %w", path, err)
 	}
@@ -110,6 +231,14 @@ func fromConfig(cf *goReleaserConfigFile) (*GoReleaserConfig, error) {
 		return nil, err
 	}
 
+	if err := validateModule(cf); err != nil {
+		return nil, err
+	}
+
+	if err := validateMod(cf); err != nil {
+		return nil, err
+	}
+
 	cfg := GoReleaserConfig{
 		Goos:    cf.Goos,
 		Goarch:  cf.Goarch,
@@ -118,9 +247,19 @@ func fromConfig(cf *goReleaserConfigFile) (*GoReleaserConfig, error) {
 		Binary:  cf.Binary,
 		Main:    cf.Main,
 		Dir:     cf.Dir,
+		Module:  cf.Module,
+		Mod:     cf.Mod,
+	}
+
+	if err := cfg.setEnvs(cf.Env); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.setArchive(cf); err != nil {
+		return nil, err
 	}
 
-	if err := cfg.setEnvs(cf); err != nil {
+	if err := cfg.setTargets(cf); err != nil {
 		return nil, err
 	}
 
@@ -142,6 +281,25 @@ func validateDir(cf *goReleaserConfigFile) error {
 	return validatePath(*cf.Dir)
 }
 
+func validateModule(cf *goReleaserConfigFile) error {
+	if cf.Module == "" {
+		return nil
+	}
+	if err := gomodule.CheckImportPath(cf.Module); err != nil {
+		return errors.Errorf(&ErrInvalidWorkspace{}, "invalid module: %v", err)
+	}
+	return nil
+}
+
+func validateMod(cf *goReleaserConfigFile) error {
+	switch cf.Mod {
+	case "", ModVendor, ModReadonly:
+		return nil
+	default:
+		return errors.Errorf(&ErrInvalidMod{}, "invalid mod %q: must be %q or %q", cf.Mod, ModVendor, ModReadonly)
+	}
+}
+
 func validateMain(cf *goReleaserConfigFile) error {
 	if cf.Main == nil {
 		return nil
@@ -176,9 +334,12 @@ func validateVersion(cf *goReleaserConfigFile) error {
 	return nil
 }
 
-func (r *GoReleaserConfig) setEnvs(cf *goReleaserConfigFile) error {
+func (r *GoReleaserConfig) setEnvs(env []string) error {
 	m := make(map[string]string)
-	for _, e := range cf.Env {
+	for k, v := range r.Env {
+		m[k] = v
+	}
+	for _, e := range env {
 		name, value, present := strings.Cut(e, "=")
 		if !present {
 			return errors.Errorf(&ErrInvalidEnvironmentVariable{}, "'%s' contains no '='", e)
@@ -192,3 +353,125 @@ func (r *GoReleaserConfig) setEnvs(cf *goReleaserConfigFile) error {
 
 	return nil
 }
+
+// setTargets sets the build targets of a version 2 config. Each target
+// inherits the top-level fields of the config: os, arch and binary are used
+// unless the target sets them, env variables are merged and flags and ldflags
+// are appended to the top-level ones.
+func (r *GoReleaserConfig) setTargets(cf *goReleaserConfigFile) error {
+	if cf.Version < 2 {
+		if len(cf.Targets) > 0 {
+			return errors.Errorf(&ErrInvalidTarget{}, "targets require version 2")
+		}
+		return nil
+	}
+
+	if len(cf.Targets) == 0 {
+		return errors.Errorf(&ErrInvalidTarget{}, "no targets defined")
+	}
+
+	for i := range cf.Targets {
+		tf := &cf.Targets[i]
+		t := &GoReleaserConfig{
+			Env:     r.Env,
+			Main:    r.Main,
+			Dir:     r.Dir,
+			Module:  r.Module,
+			Mod:     r.Mod,
+			Goos:    valueOrDefault(tf.Goos, r.Goos),
+			Goarch:  valueOrDefault(tf.Goarch, r.Goarch),
+			Binary:  valueOrDefault(tf.Binary, r.Binary),
+			Flags:   concat(r.Flags, tf.Flags),
+			Ldflags: concat(r.Ldflags, tf.Ldflags),
+			Archive: r.Archive,
+		}
+		if err := t.setEnvs(tf.Env); err != nil {
+			return fmt.Errorf("target %d: %w", i, err)
+		}
+		r.Targets = append(r.Targets, t)
+	}
+
+	return nil
+}
+
+// setArchive sets the archive and checksum configuration. The archives are
+// created in the `tar.gz` format unless other formats are given and the
+// checksums file is named `checksums.txt` unless another name is given.
+func (r *GoReleaserConfig) setArchive(cf *goReleaserConfigFile) error {
+	if cf.Checksum != nil {
+		r.Checksum = valueOrDefault(cf.Checksum.Name, defaultChecksumName)
+	}
+
+	if cf.Archive == nil {
+		return nil
+	}
+
+	a := &ArchiveConfig{
+		Formats: cf.Archive.Formats,
+		Name:    cf.Archive.Name,
+		Files:   cf.Archive.Files,
+	}
+	if len(a.Formats) == 0 {
+		a.Formats = []string{archiveFormatTarGz}
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range a.Formats {
+		if !supportedArchiveFormats[f] {
+			return errors.Errorf(&ErrInvalidArchive{}, "unsupported archive format %q", f)
+		}
+		if seen[f] {
+			return errors.Errorf(&ErrInvalidArchive{}, "duplicate archive format %q", f)
+		}
+		seen[f] = true
+	}
+
+	for _, f := range a.Files {
+		if err := utils.PathIsUnderCurrentDirectory(f); err != nil {
+			return errors.Errorf(&ErrInvalidArchive{}, "archive file %q: %v", f, err)
+		}
+	}
+
+	r.Archive = a
+	return nil
+}
+
+// setPolicy sets the policy of the config and its targets.
+func (r *GoReleaserConfig) setPolicy(p *Policy) {
+	r.Policy = p
+	for _, t := range r.Targets {
+		t.Policy = p
+	}
+}
+
+// policy returns the policy of the config.
+func (r *GoReleaserConfig) policy() *Policy {
+	if r.Policy == nil {
+		return DefaultPolicy()
+	}
+	return r.Policy
+}
+
+// mod returns the module download mode of the build.
+func (r *GoReleaserConfig) mod() string {
+	if r.Mod == "" {
+		return ModVendor
+	}
+	return r.Mod
+}
+
+func valueOrDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// concat returns a new slice with the elements of a followed by those of b,
+// or nil if both are empty.
+func concat(a, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	return append(append([]string{}, a...), b...)
+}
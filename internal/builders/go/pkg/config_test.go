@@ -43,6 +43,41 @@ func errInvalidEnvironmentVariableFunc(t *testing.T, got error) {
 	}
 }
 
+func errInvalidTargetFunc(t *testing.T, got error) {
+	want := &ErrInvalidTarget{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", cmp.Diff(got, want, cmpopts.EquateErrors()))
+	}
+}
+
+func errPolicyViolationFunc(t *testing.T, got error) {
+	want := &ErrPolicyViolation{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", cmp.Diff(got, want, cmpopts.EquateErrors()))
+	}
+}
+
+func errInvalidWorkspaceFunc(t *testing.T, got error) {
+	want := &ErrInvalidWorkspace{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", cmp.Diff(got, want, cmpopts.EquateErrors()))
+	}
+}
+
+func errInvalidModFunc(t *testing.T, got error) {
+	want := &ErrInvalidMod{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", cmp.Diff(got, want, cmpopts.EquateErrors()))
+	}
+}
+
+func errInvalidArchiveFunc(t *testing.T, got error) {
+	want := &ErrInvalidArchive{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", cmp.Diff(got, want, cmpopts.EquateErrors()))
+	}
+}
+
 func Test_ConfigFromFile(t *testing.T) {
 	t.Parallel()
 
@@ -177,6 +212,133 @@ func Test_ConfigFromFile(t *testing.T) {
 				Dir: asPointer("./path/to/dir"),
 			},
 		},
+		{
+			name: "valid targets",
+			path: "./testdata/releaser-valid-targets.yml",
+			config: GoReleaserConfig{
+				Flags:   []string{"-trimpath"},
+				Ldflags: []string{"{{ .Env.VERSION_LDFLAGS }}"},
+				Binary:  "binary-{{ .Os }}-{{ .Arch }}",
+				Env: map[string]string{
+					"GO111MODULE": "on", "CGO_ENABLED": "0",
+				},
+				Main: asPointer("./relative/main.go"),
+				Targets: []*GoReleaserConfig{
+					{
+						Goos: "linux", Goarch: "amd64",
+						Flags:   []string{"-trimpath"},
+						Ldflags: []string{"{{ .Env.VERSION_LDFLAGS }}"},
+						Binary:  "binary-{{ .Os }}-{{ .Arch }}",
+						Env: map[string]string{
+							"GO111MODULE": "on", "CGO_ENABLED": "0",
+						},
+						Main: asPointer("./relative/main.go"),
+					},
+					{
+						Goos: "darwin", Goarch: "arm64",
+						Flags:   []string{"-trimpath", "-tags=netgo"},
+						Ldflags: []string{"{{ .Env.VERSION_LDFLAGS }}"},
+						Binary:  "binary-macos",
+						Env: map[string]string{
+							"GO111MODULE": "on", "CGO_ENABLED": "1",
+						},
+						Main: asPointer("./relative/main.go"),
+					},
+				},
+			},
+		},
+		{
+			name: "valid archive",
+			path: "./testdata/releaser-valid-archive.yml",
+			config: GoReleaserConfig{
+				Goos: "linux", Goarch: "amd64",
+				Binary: "binary-{{ .Os }}-{{ .Arch }}",
+				Archive: &ArchiveConfig{
+					Formats: []string{"tar.gz", "zip"},
+					Name:    "project-{{ .Version }}-{{ .Os }}-{{ .Arch }}",
+					Files:   []string{"LICENSE", "docs/README.md"},
+				},
+				Checksum: "checksums.txt",
+			},
+		},
+		{
+			name: "valid archive defaults",
+			path: "./testdata/releaser-valid-archive-defaults.yml",
+			config: GoReleaserConfig{
+				Goos: "linux", Goarch: "amd64",
+				Binary: "binary-{{ .Os }}-{{ .Arch }}",
+				Archive: &ArchiveConfig{
+					Formats: []string{"tar.gz"},
+					Files:   []string{"LICENSE"},
+				},
+				Checksum: "checksums.txt",
+			},
+		},
+		{
+			name: "invalid archive format",
+			path: "./testdata/releaser-invalid-archive-format.yml",
+			err:  errInvalidArchiveFunc,
+		},
+		{
+			name: "archive file outside the repository",
+			path: "./testdata/releaser-invalid-archive-file.yml",
+			err:  errInvalidArchiveFunc,
+		},
+		{
+			name: "targets in version 1",
+			path: "./testdata/releaser-invalid-targets-version.yml",
+			err:  errInvalidTargetFunc,
+		},
+		{
+			name: "no targets in version 2",
+			path: "./testdata/releaser-invalid-no-targets.yml",
+			err:  errInvalidTargetFunc,
+		},
+		{
+			name: "flag denied by policy",
+			path: "./testdata/releaser-invalid-policy-flag.yml",
+			err:  errPolicyViolationFunc,
+		},
+		{
+			name: "env variable not allowed by policy",
+			path: "./testdata/releaser-invalid-policy-env.yml",
+			err:  errPolicyViolationFunc,
+		},
+		{
+			name: "valid workspace module",
+			path: "./testdata/releaser-valid-module.yml",
+			config: GoReleaserConfig{
+				Goos: "linux", Goarch: "amd64",
+				Flags:  []string{"-trimpath"},
+				Binary: "binary-{{ .OS }}-{{ .Arch }}",
+				Env: map[string]string{
+					"CGO_ENABLED": "0",
+				},
+				Module: "example.com/tools/cmd",
+			},
+		},
+		{
+			name: "invalid workspace module",
+			path: "./testdata/releaser-invalid-module.yml",
+			err:  errInvalidWorkspaceFunc,
+		},
+		{
+			name: "valid readonly mod",
+			path: "./testdata/releaser-valid-mod.yml",
+			config: GoReleaserConfig{
+				Goos: "linux", Goarch: "amd64",
+				Binary: "binary-{{ .OS }}-{{ .Arch }}",
+				Env: map[string]string{
+					"GOPROXY": "https://proxy.example.com", "GONOSUMDB": "example.com/private",
+				},
+				Mod: ModReadonly,
+			},
+		},
+		{
+			name: "invalid mod",
+			path: "./testdata/releaser-invalid-mod.yml",
+			err:  errInvalidModFunc,
+		},
 		{
 			name: "invalid config path with dots",
 			// Resolves to "../releaser-valid-dir.yml".
@@ -189,7 +351,7 @@ func Test_ConfigFromFile(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			cfg, err := ConfigFromFile(tt.path)
+			cfg, err := ConfigFromFile(tt.path, nil)
 
 			if tt.err != nil {
 				tt.err(t, err)
@@ -198,8 +360,10 @@ func Test_ConfigFromFile(t *testing.T) {
 				return
 			}
 
-			if !cmp.Equal(*cfg, tt.config) {
-				t.Errorf(cmp.Diff(*cfg, tt.config))
+			// Note: the default policy is tested separately.
+			ignorePolicy := cmpopts.IgnoreFields(GoReleaserConfig{}, "Policy")
+			if !cmp.Equal(*cfg, tt.config, ignorePolicy) {
+				t.Errorf(cmp.Diff(*cfg, tt.config, ignorePolicy))
 			}
 		})
 	}
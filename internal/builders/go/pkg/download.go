@@ -0,0 +1,163 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+	"github.com/slsa-framework/slsa-github-generator/internal/runner"
+)
+
+// moduleEnvVariables are the env variables of the compilation that configure
+// the download of modules, e.g. the module proxy and the checksum database.
+// They are set for the download steps too.
+var moduleEnvVariables = map[string]bool{
+	"GO111MODULE": true,
+	"GOFLAGS":     true,
+	"GOINSECURE":  true,
+	"GONOPROXY":   true,
+	"GONOSUMDB":   true,
+	"GOPRIVATE":   true,
+	"GOPROXY":     true,
+	"GOSUMDB":     true,
+	"GOTOOLCHAIN": true,
+	"GOWORK":      true,
+}
+
+// downloadedModule is a module downloaded by `go mod download -json`.
+type downloadedModule struct {
+	Path    string
+	Version string
+	Error   string
+	// Zip is the path of the zip of the module in the module cache.
+	Zip string
+	// Sum is the go.sum hash of the module.
+	Sum string
+}
+
+// modMode returns the module download mode of a compilation command, i.e.
+// the value of its `-mod` flag.
+func modMode(command []string) string {
+	for _, arg := range command {
+		if strings.HasPrefix(arg, "-mod=") {
+			return strings.TrimPrefix(arg, "-mod=")
+		}
+	}
+	return ModVendor
+}
+
+// moduleEnv returns the env variables of env configuring the download of
+// modules.
+func moduleEnv(env []string) []string {
+	var res []string
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		if moduleEnvVariables[name] {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// downloadSteps returns the steps downloading the module dependencies of the
+// build in dir and verifying their hashes with the compiler goc. They are
+// run before the compilation in ModReadonly mode, with the module env
+// variables of the compilation env.
+func downloadSteps(goc, dir string, env []string) []*runner.CommandStep {
+	menv := moduleEnv(env)
+	return []*runner.CommandStep{
+		{Command: []string{goc, "mod", "download", "-json"}, Env: menv, WorkingDir: dir},
+		{Command: []string{goc, "mod", "verify"}, Env: menv, WorkingDir: dir},
+	}
+}
+
+// downloadMaterials downloads the module dependencies of the build in dir
+// and returns their materials. The digests of a module are its go.sum hash
+// and the sha256 digest of its zip.
+func downloadMaterials(goc, dir string, env []string) ([]slsacommon.ProvenanceMaterial, error) {
+	var out bytes.Buffer
+	r := runner.CommandRunner{
+		Stdout: &out,
+		Steps:  downloadSteps(goc, dir, env)[:1],
+	}
+	_, runErr := r.Run(context.Background())
+
+	// Note: the errors of the modules are in the output.
+	modules, err := parseDownloadedModules(&out)
+	if err != nil {
+		return nil, err
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("go mod download: %w", runErr)
+	}
+
+	var materials []slsacommon.ProvenanceMaterial
+	for _, m := range modules {
+		digest, err := computeSHA256(m.Zip)
+		if err != nil {
+			return nil, err
+		}
+		materials = append(materials, slsacommon.ProvenanceMaterial{
+			URI: fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version),
+			Digest: slsacommon.DigestSet{
+				dirHashAlgorithm: m.Sum,
+				"sha256":         digest,
+			},
+		})
+	}
+	return materials, nil
+}
+
+// parseDownloadedModules parses the output of `go mod download -json`, i.e.
+// a stream of JSON objects, and returns the modules sorted by path and
+// version.
+func parseDownloadedModules(r io.Reader) ([]downloadedModule, error) {
+	var modules []downloadedModule
+	dec := json.NewDecoder(r)
+	for {
+		var m downloadedModule
+		err := dec.Decode(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Errorf(&ErrInvalidModules{}, "decoding go mod download output: %v", err)
+		}
+		if m.Error != "" {
+			return nil, errors.Errorf(&ErrInvalidModules{}, "downloading %s@%s: %s", m.Path, m.Version, m.Error)
+		}
+		if m.Path == "" || m.Version == "" || m.Zip == "" || m.Sum == "" {
+			return nil, errors.Errorf(&ErrInvalidModules{}, "incomplete module %s@%s", m.Path, m.Version)
+		}
+		modules = append(modules, m)
+	}
+
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Path != modules[j].Path {
+			return modules[i].Path < modules[j].Path
+		}
+		return modules[i].Version < modules[j].Version
+	})
+	return modules, nil
+}
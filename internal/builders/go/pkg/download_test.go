@@ -0,0 +1,260 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	gomodule "golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+)
+
+func Test_modMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		command  []string
+		expected string
+	}{
+		{
+			name:     "vendor",
+			command:  []string{"go", "build", "-mod=vendor", "-o", "binary"},
+			expected: ModVendor,
+		},
+		{
+			name:     "readonly",
+			command:  []string{"go", "build", "-mod=readonly", "-o", "binary"},
+			expected: ModReadonly,
+		},
+		{
+			name:     "no flag",
+			command:  []string{"go", "build", "-o", "binary"},
+			expected: ModVendor,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := modMode(tt.command); got != tt.expected {
+				t.Errorf("unexpected mode, got: %q, want: %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_downloadSteps(t *testing.T) {
+	t.Parallel()
+
+	env := []string{"GOOS=linux", "GOPROXY=file:///proxy", "CGO_ENABLED=0", "GONOSUMDB=example.com"}
+	steps := downloadSteps("/opt/go/bin/go", "/src", env)
+
+	menv := []string{"GOPROXY=file:///proxy", "GONOSUMDB=example.com"}
+	want := []step{
+		{Command: []string{"/opt/go/bin/go", "mod", "download", "-json"}, Env: menv, WorkingDir: "/src"},
+		{Command: []string{"/opt/go/bin/go", "mod", "verify"}, Env: menv, WorkingDir: "/src"},
+	}
+	var got []step
+	for _, s := range steps {
+		got = append(got, step{Command: s.Command, Env: s.Env, WorkingDir: s.WorkingDir})
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected steps (-want +got):\n%s", diff)
+	}
+}
+
+func Test_parseDownloadedModules(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		output   string
+		expected []downloadedModule
+		wantErr  bool
+	}{
+		{
+			name: "modules",
+			output: `{
+	"Path": "golang.org/x/net",
+	"Version": "v0.7.0",
+	"Zip": "/cache/golang.org/x/net/@v/v0.7.0.zip",
+	"Sum": "h1:rJrUqqhjsgNp7KqAIc25s9pZnjU7TUcSY7HcVZjdn1g="
+}
+{
+	"Path": "golang.org/x/mod",
+	"Version": "v0.8.0",
+	"Zip": "/cache/golang.org/x/mod/@v/v0.8.0.zip",
+	"Sum": "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8="
+}
+`,
+			expected: []downloadedModule{
+				{
+					Path: "golang.org/x/mod", Version: "v0.8.0",
+					Zip: "/cache/golang.org/x/mod/@v/v0.8.0.zip",
+					Sum: "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8=",
+				},
+				{
+					Path: "golang.org/x/net", Version: "v0.7.0",
+					Zip: "/cache/golang.org/x/net/@v/v0.7.0.zip",
+					Sum: "h1:rJrUqqhjsgNp7KqAIc25s9pZnjU7TUcSY7HcVZjdn1g=",
+				},
+			},
+		},
+		{
+			name: "no modules",
+		},
+		{
+			name:    "download error",
+			output:  `{"Path": "golang.org/x/mod", "Version": "v0.8.0", "Error": "not found"}`,
+			wantErr: true,
+		},
+		{
+			name:    "no hash",
+			output:  `{"Path": "golang.org/x/mod", "Version": "v0.8.0", "Zip": "/cache/v0.8.0.zip"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			output:  `{"Path":`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			modules, err := parseDownloadedModules(strings.NewReader(tt.output))
+			if tt.wantErr {
+				var errModules *ErrInvalidModules
+				if !errors.As(err, &errModules) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, modules); diff != "" {
+				t.Errorf("unexpected modules (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// writeProxy writes a file:// module proxy serving the module
+// example.com/dep@v1.0.0, and returns the proxy URL, the go.sum lines of the
+// module and the path of its zip.
+func writeProxy(t *testing.T) (string, string, string) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"go.mod": "module example.com/dep\n\ngo 1.19\n",
+		"dep.go": "package dep\n\nconst Name = \"dep\"\n",
+	})
+
+	proxy := t.TempDir()
+	dir := filepath.Join(proxy, "example.com", "dep", "@v")
+	writeFiles(t, dir, map[string]string{
+		"list":        "v1.0.0\n",
+		"v1.0.0.info": `{"Version":"v1.0.0","Time":"2023-03-01T12:00:00Z"}`,
+		"v1.0.0.mod":  "module example.com/dep\n\ngo 1.19\n",
+	})
+	zipPath := filepath.Join(dir, "v1.0.0.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := modzip.CreateFromDir(f, gomodule.Version{Path: "example.com/dep", Version: "v1.0.0"}, src); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modh, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, "v1.0.0.mod"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum := "example.com/dep v1.0.0 " + h + "\nexample.com/dep v1.0.0/go.mod " + modh + "\n"
+	return "file://" + filepath.ToSlash(proxy), goSum, zipPath
+}
+
+func TestGoBuild_Materials_readonly(t *testing.T) {
+	goc, err := exec.LookPath("go")
+	if err != nil {
+		t.Fatalf("exec.LookPath: %v", err)
+	}
+	// Use an empty module cache that can be removed.
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	proxy, goSum, zipPath := writeProxy(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/main\n\ngo 1.19\n\nrequire example.com/dep v1.0.0\n",
+		"go.sum":  goSum,
+		"main.go": "package main\n\nimport \"example.com/dep\"\n\nfunc main() { println(dep.Name) }\n",
+	})
+
+	b := GoBuildNew(goc, &GoReleaserConfig{
+		Dir: &dir,
+		Mod: ModReadonly,
+		Env: map[string]string{"GOPROXY": proxy, "GOSUMDB": "off"},
+	})
+	materials, err := b.Materials()
+	if err != nil {
+		t.Fatalf("Materials: %v", err)
+	}
+
+	digest, err := computeSHA256(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := strings.Fields(goSum)[2]
+	want := []slsacommon.ProvenanceMaterial{
+		{
+			URI:    "pkg:golang/example.com/dep@v1.0.0",
+			Digest: slsacommon.DigestSet{dirHashAlgorithm: h, "sha256": digest},
+		},
+	}
+	if diff := cmp.Diff(want, materials[1:]); diff != "" {
+		t.Errorf("unexpected materials (-want +got):\n%s", diff)
+	}
+
+	// The download fails if the hash does not match go.sum.
+	writeFiles(t, dir, map[string]string{
+		"go.sum": strings.Replace(goSum, h, "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8=", 1),
+	})
+	t.Setenv("GOMODCACHE", t.TempDir())
+	if _, err := b.Materials(); err == nil {
+		t.Errorf("expected an error for a hash mismatch")
+	}
+}
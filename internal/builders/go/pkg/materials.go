@@ -0,0 +1,261 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+// dirHashAlgorithm is the digest algorithm of Go module hashes, as computed
+// by the golang.org/x/mod/sumdb/dirhash package.
+const dirHashAlgorithm = "dirHash"
+
+// toolchainURIPrefix is the prefix of the URI of the Go toolchain material,
+// which is followed by the Go version.
+const toolchainURIPrefix = "pkg:golang/stdlib@"
+
+// ErrInvalidModules indicates invalid go.sum or vendor/modules.txt files.
+type ErrInvalidModules struct {
+	errors.WrappableError
+}
+
+// module is a Go module dependency.
+type module struct {
+	path    string
+	version string
+}
+
+// Materials returns the materials of the build: the Go toolchain and the
+// module dependencies of the main module. In ModReadonly mode, the
+// dependencies are downloaded to record the digests of their zips. In
+// ModVendor mode, it must be called after the dependencies are vendored, as
+// the dependencies are the vendored modules.
+func (b *GoBuild) Materials() ([]slsacommon.ProvenanceMaterial, error) {
+	dir, err := b.getDir()
+	if err != nil {
+		return nil, err
+	}
+
+	toolchain, err := toolchainMaterial(b.goc)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := b.getWorkspace()
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []slsacommon.ProvenanceMaterial
+	switch {
+	case b.cfg.mod() == ModReadonly:
+		// Note: the env variables are validated against the policy
+		// when the config is loaded.
+		var env []string
+		for k, v := range b.cfg.Env {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+		modules, err = downloadMaterials(b.goc, dir, env)
+	case w != nil:
+		modules, err = workspaceMaterials(w)
+	default:
+		modules, err = moduleMaterials(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]slsacommon.ProvenanceMaterial{toolchain}, modules...), nil
+}
+
+// toolchainMaterial returns the material of the Go toolchain goc. Its digest
+// is the sha256 digest of the go command.
+func toolchainMaterial(goc string) (slsacommon.ProvenanceMaterial, error) {
+	out, err := exec.Command(goc, "env", "GOVERSION").Output()
+	if err != nil {
+		return slsacommon.ProvenanceMaterial{}, fmt.Errorf("%s env GOVERSION: %w", goc, err)
+	}
+	path, err := exec.LookPath(goc)
+	if err != nil {
+		return slsacommon.ProvenanceMaterial{}, err
+	}
+	digest, err := computeSHA256(path)
+	if err != nil {
+		return slsacommon.ProvenanceMaterial{}, fmt.Errorf("computing the digest of %s: %w", goc, err)
+	}
+	return slsacommon.ProvenanceMaterial{
+		URI:    toolchainURIPrefix + strings.TrimSpace(string(out)),
+		Digest: slsacommon.DigestSet{"sha256": digest},
+	}, nil
+}
+
+// moduleMaterials returns the materials of the module dependencies of the
+// vendored main module in dir. The dependencies are read from
+// vendor/modules.txt and their hashes from go.sum.
+func moduleMaterials(dir string) ([]slsacommon.ProvenanceMaterial, error) {
+	return readModuleMaterials([]string{filepath.Join(dir, "go.sum")}, filepath.Join(dir, "vendor", "modules.txt"))
+}
+
+// workspaceMaterials returns the materials of the module dependencies of
+// the workspace w. The dependencies are read from the vendor/modules.txt file
+// of the workspace and their hashes from the go.work.sum file and the go.sum
+// files of the workspace modules. The workspace modules and their local
+// replacements are part of the source and are not materials.
+func workspaceMaterials(w *Workspace) ([]slsacommon.ProvenanceMaterial, error) {
+	return readModuleMaterials(w.sumFiles(), filepath.Join(w.Dir, "vendor", "modules.txt"))
+}
+
+// readModuleMaterials returns the materials of the modules in the
+// vendor/modules.txt file at modulesTxt. There is none if it does not exist,
+// as `go mod vendor` and `go work vendor` do not create it when there is no
+// dependency to vendor.
+func readModuleMaterials(sumFiles []string, modulesTxt string) ([]slsacommon.ProvenanceMaterial, error) {
+	sums := make(map[module]string)
+	for _, f := range sumFiles {
+		s, err := readGoSum(f)
+		if err != nil {
+			return nil, err
+		}
+		for m, h := range s {
+			sums[m] = h
+		}
+	}
+
+	modules, err := readModulesTxt(modulesTxt)
+	if err != nil {
+		return nil, err
+	}
+
+	var materials []slsacommon.ProvenanceMaterial
+	for _, m := range modules {
+		hash, ok := sums[m]
+		if !ok {
+			return nil, errors.Errorf(&ErrInvalidModules{}, "no go.sum entry for %s@%s", m.path, m.version)
+		}
+		materials = append(materials, slsacommon.ProvenanceMaterial{
+			URI:    fmt.Sprintf("pkg:golang/%s@%s", m.path, m.version),
+			Digest: slsacommon.DigestSet{dirHashAlgorithm: hash},
+		})
+	}
+	return materials, nil
+}
+
+// readGoSum reads the module hashes in the go.sum file at path. Hashes of
+// go.mod files are ignored. It returns no hashes if the file does not exist.
+func readGoSum(path string) (map[module]string, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading go.sum: %w", err)
+	}
+
+	sums := make(map[module]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		// Format: <path> <version>[/go.mod] <hash>
+		f := strings.Fields(line)
+		if len(f) != 3 {
+			return nil, errors.Errorf(&ErrInvalidModules{}, "invalid go.sum line: %q", line)
+		}
+		if strings.HasSuffix(f[1], "/go.mod") {
+			continue
+		}
+		sums[module{path: f[0], version: f[1]}] = f[2]
+	}
+	return sums, scanner.Err()
+}
+
+// readModulesTxt reads the modules providing packages in the
+// vendor/modules.txt file at path. Replaced modules are resolved to their
+// replacement and modules replaced by a local directory are skipped, as they
+// are part of the source. It returns nil if the file does not exist.
+func readModulesTxt(path string) ([]module, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening vendor/modules.txt: %w", err)
+	}
+	defer f.Close()
+	return parseModulesTxt(f)
+}
+
+func parseModulesTxt(r io.Reader) ([]module, error) {
+	modules := []module{}
+	// current is the module of the following package lines. It is nil if
+	// the packages are not from a module dependency.
+	var current *module
+	var hasPackages bool
+	add := func() {
+		if current != nil && hasPackages {
+			modules = append(modules, *current)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "## "):
+			// Module annotations, e.g. "## explicit; go 1.19".
+		case strings.HasPrefix(line, "# "):
+			add()
+			current, hasPackages = nil, false
+
+			// Format: # <path> <version> [=> <path> [<version>]]
+			f := strings.Fields(strings.TrimPrefix(line, "# "))
+			var replaced bool
+			for i := range f {
+				if f[i] == "=>" {
+					f, replaced = f[i+1:], true
+					break
+				}
+			}
+			switch {
+			case replaced && len(f) == 1:
+				// Replacement by a local directory.
+			case len(f) == 2:
+				current = &module{path: f[0], version: f[1]}
+			default:
+				return nil, errors.Errorf(&ErrInvalidModules{}, "invalid vendor/modules.txt line: %q", line)
+			}
+		case line != "":
+			hasPackages = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading vendor/modules.txt: %w", err)
+	}
+	add()
+	return modules, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+)
+
+const testGoSum = `github.com/google/go-cmp v0.5.9 h1:O2Tfq5qg4qc4AmwVlvv0oLiVAGB7enBSJ2x2DqQFi38=
+github.com/google/go-cmp v0.5.9/go.mod h1:17dUlkBOakJ0+DkrSSNjCkIjxS6bF9zb3elmeNGIjoY=
+golang.org/x/mod v0.8.0 h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8=
+golang.org/x/mod v0.8.0/go.mod h1:iBbtSCu2XBx23ZKBPSOrRkjjQPZFPuis4dIYUhu/chs=
+golang.org/x/net v0.7.0 h1:rJrUqqhjsgNp7KqAIc25s9pZnjU7TUcSY7HcVZjdn1g=
+golang.org/x/net v0.7.0/go.mod h1:2Tu9+aMcznHK/AK1HMvgo6xiTLG5rD5rZLDS+rp2Bjs=
+`
+
+func writeModule(t *testing.T, goSum, modulesTxt string) string {
+	dir := t.TempDir()
+	if goSum != "" {
+		if err := os.WriteFile(filepath.Join(dir, "go.sum"), []byte(goSum), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if modulesTxt != "" {
+		if err := os.Mkdir(filepath.Join(dir, "vendor"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "vendor", "modules.txt"), []byte(modulesTxt), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func Test_moduleMaterials(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		goSum      string
+		modulesTxt string
+		materials  []slsacommon.ProvenanceMaterial
+		wantErr    bool
+	}{
+		{
+			name: "no dependencies",
+		},
+		{
+			// The go.sum entries are not dependencies without
+			// vendor/modules.txt.
+			name:  "not vendored",
+			goSum: testGoSum,
+		},
+		{
+			name:  "vendored",
+			goSum: testGoSum,
+			modulesTxt: `# github.com/google/go-cmp v0.5.9
+## explicit; go 1.13
+github.com/google/go-cmp/cmp
+github.com/google/go-cmp/cmp/internal/diff
+# golang.org/x/mod v0.7.0 => golang.org/x/mod v0.8.0
+## explicit; go 1.17
+golang.org/x/mod/semver
+# golang.org/x/net v0.7.0
+## explicit; go 1.17
+# example.com/local v1.0.0 => ../local
+## explicit
+example.com/local
+`,
+			materials: []slsacommon.ProvenanceMaterial{
+				{
+					URI:    "pkg:golang/github.com/google/go-cmp@v0.5.9",
+					Digest: slsacommon.DigestSet{"dirHash": "h1:O2Tfq5qg4qc4AmwVlvv0oLiVAGB7enBSJ2x2DqQFi38="},
+				},
+				{
+					URI:    "pkg:golang/golang.org/x/mod@v0.8.0",
+					Digest: slsacommon.DigestSet{"dirHash": "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8="},
+				},
+			},
+		},
+		{
+			name:  "missing go.sum entry",
+			goSum: testGoSum,
+			modulesTxt: `# github.com/google/go-cmp v0.5.8
+github.com/google/go-cmp/cmp
+`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid go.sum",
+			goSum:   "github.com/google/go-cmp v0.5.9\n",
+			wantErr: true,
+		},
+		{
+			name:       "invalid modules.txt",
+			goSum:      testGoSum,
+			modulesTxt: "# github.com/google/go-cmp\n",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			materials, err := moduleMaterials(writeModule(t, tt.goSum, tt.modulesTxt))
+			if tt.wantErr {
+				var errModules *ErrInvalidModules
+				if !errors.As(err, &errModules) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.materials, materials); diff != "" {
+				t.Errorf("unexpected materials (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuild_Materials(t *testing.T) {
+	t.Parallel()
+
+	goc, err := exec.LookPath("go")
+	if err != nil {
+		t.Fatalf("exec.LookPath: %v", err)
+	}
+
+	dir := writeModule(t, testGoSum, `# github.com/google/go-cmp v0.5.9
+github.com/google/go-cmp/cmp
+`)
+	b := GoBuildNew(goc, &GoReleaserConfig{Dir: &dir})
+	materials, err := b.Materials()
+	if err != nil {
+		t.Fatalf("Materials: %v", err)
+	}
+
+	if got := materials[0].URI; !strings.HasPrefix(got, "pkg:golang/stdlib@go") {
+		t.Errorf("unexpected toolchain material: %q", got)
+	}
+	digest, err := computeSHA256(goc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(slsacommon.DigestSet{"sha256": digest}, materials[0].Digest); diff != "" {
+		t.Errorf("unexpected toolchain digest (-want +got):\n%s", diff)
+	}
+	if got, want := len(materials), 2; got != want {
+		t.Errorf("unexpected number of materials, got: %d, want: %d", got, want)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"golang.org/x/mod/modfile"
+	gomodule "golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+// ErrInvalidModule indicates a module that cannot be published at the
+// requested version.
+type ErrInvalidModule struct {
+	errors.WrappableError
+}
+
+// Module is the zip of a Go module, as served by the Go module proxy.
+type Module struct {
+	// Path is the module path, e.g. github.com/org/repo.
+	Path string `json:"path"`
+
+	// Version is the version of the module, e.g. v1.2.3.
+	Version string `json:"version"`
+
+	// Zip is the file name of the module zip.
+	Zip string `json:"zip"`
+
+	// SHA256 is the hex-encoded sha256 digest of the module zip.
+	SHA256 string `json:"sha256"`
+
+	// DirHash is the hash of the module zip used in go.sum files, e.g.
+	// h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8=.
+	DirHash string `json:"dirHash"`
+}
+
+// URI returns the package URL of the module, e.g.
+// pkg:golang/github.com/org/repo@v1.2.3.
+func (m *Module) URI() string {
+	return fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version)
+}
+
+// subject returns the provenance subject of the module.
+func (m *Module) subject() (intoto.Subject, error) {
+	s, err := newSubject(m.URI(), m.SHA256)
+	if err != nil {
+		return s, err
+	}
+	if !strings.HasPrefix(m.DirHash, "h1:") {
+		return s, fmt.Errorf("module hash is not valid: %s", m.DirHash)
+	}
+	s.Digest[dirHashAlgorithm] = m.DirHash
+	return s, nil
+}
+
+// BuildModule creates the zip of the main module in dir at version in
+// outputDir. The zip has the layout and exclusions of the zips served by the
+// Go module proxy, and is created from the committed files if dir is in a git
+// repository.
+func BuildModule(dir, version, outputDir string) (*Module, error) {
+	goMod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidModule{}, "reading go.mod: %v", err)
+	}
+	modPath := modfile.ModulePath(goMod)
+	if modPath == "" {
+		return nil, errors.Errorf(&ErrInvalidModule{}, "no module path in go.mod")
+	}
+
+	// Check that the version is canonical and compatible with the major
+	// version of the module path.
+	mv := gomodule.Version{Path: modPath, Version: version}
+	if err := gomodule.Check(mv.Path, mv.Version); err != nil {
+		return nil, errors.Errorf(&ErrInvalidModule{}, "%v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := createModuleZip(&buf, mv, dir); err != nil {
+		return nil, err
+	}
+
+	m := &Module{
+		Path:    mv.Path,
+		Version: mv.Version,
+		// e.g. repo@v1.2.3.zip for github.com/org/repo.
+		Zip: fmt.Sprintf("%s@%s.zip", path.Base(mv.Path), mv.Version),
+	}
+	if err := validatePath(m.Zip); err != nil {
+		return nil, errors.Errorf(&ErrInvalidModule{}, "invalid zip name %q", m.Zip)
+	}
+
+	a, err := writeArtifact(outputDir, m.Zip, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	m.SHA256 = a.Digest
+
+	m.DirHash, err = dirhash.HashZip(filepath.Join(outputDir, m.Zip), dirhash.Hash1)
+	if err != nil {
+		return nil, fmt.Errorf("hashing module zip: %w", err)
+	}
+	return m, nil
+}
+
+// createModuleZip writes the zip of module mv in dir to buf. The zip is
+// created from the HEAD commit if dir is in a git repository, like the Go
+// module proxy does, and from the files in dir otherwise.
+func createModuleZip(buf *bytes.Buffer, mv gomodule.Version, dir string) error {
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		// Not a git repository.
+		if err := modzip.CreateFromDir(buf, mv, dir); err != nil {
+			return errors.Errorf(&ErrInvalidModule{}, "creating module zip: %v", err)
+		}
+		return nil
+	}
+
+	root := strings.TrimSpace(string(out))
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	// Note: the repository root is resolved by git, e.g. without symlinks.
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return err
+	}
+	subdir, err := filepath.Rel(root, abs)
+	if err != nil {
+		return err
+	}
+	if subdir == "." {
+		subdir = ""
+	}
+
+	if err := modzip.CreateFromVCS(buf, mv, root, "HEAD", filepath.ToSlash(subdir)); err != nil {
+		return errors.Errorf(&ErrInvalidModule{}, "creating module zip: %v", err)
+	}
+	return nil
+}
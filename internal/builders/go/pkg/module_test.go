@@ -0,0 +1,241 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"golang.org/x/mod/sumdb/dirhash"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/builders/common"
+	"github.com/slsa-framework/slsa-github-generator/internal/testutil"
+	"github.com/slsa-framework/slsa-github-generator/slsa"
+)
+
+func zipFileNames(t *testing.T, path string) []string {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBuildModule(t *testing.T) {
+	t.Parallel()
+
+	repo, _ := newTestRepository(t)
+	// Untracked files are not part of the module.
+	if err := os.WriteFile(filepath.Join(repo, "untracked.go"), []byte("package main\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	m, err := BuildModule(repo, "v1.2.3", out)
+	if err != nil {
+		t.Fatalf("BuildModule: %v", err)
+	}
+
+	if got, want := m.URI(), "pkg:golang/example.com/hello@v1.2.3"; got != want {
+		t.Errorf("unexpected URI, got: %q, want: %q", got, want)
+	}
+	if got, want := m.Zip, "hello@v1.2.3.zip"; got != want {
+		t.Errorf("unexpected zip name, got: %q, want: %q", got, want)
+	}
+
+	zipPath := filepath.Join(out, m.Zip)
+	want := []string{"example.com/hello@v1.2.3/cmd/hello/main.go", "example.com/hello@v1.2.3/go.mod"}
+	if diff := cmp.Diff(want, zipFileNames(t, zipPath)); diff != "" {
+		t.Errorf("unexpected zip files (-want +got):\n%s", diff)
+	}
+
+	digest, err := computeSHA256(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SHA256 != digest {
+		t.Errorf("unexpected sha256, got: %q, want: %q", m.SHA256, digest)
+	}
+
+	// The hash is the one of the committed files, as in go.sum.
+	if err := os.Remove(filepath.Join(repo, "untracked.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(repo, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dirhash.HashDir(repo, "example.com/hello@v1.2.3", dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DirHash != h1 {
+		t.Errorf("unexpected dirhash, got: %q, want: %q", m.DirHash, h1)
+	}
+}
+
+func TestBuildModule_subdirectory(t *testing.T) {
+	t.Parallel()
+
+	// The module is in a sub-directory of this repository.
+	out := t.TempDir()
+	m, err := BuildModule("testdata/go", "v0.1.0", out)
+	if err != nil {
+		t.Fatalf("BuildModule: %v", err)
+	}
+
+	prefix := "github.com/slsa-framework/slsa-github-generator/internal/builders/go/pkg/testdata/go@v0.1.0/"
+	want := []string{prefix + "go.mod", prefix + "main.go"}
+	if diff := cmp.Diff(want, zipFileNames(t, filepath.Join(out, m.Zip))); diff != "" {
+		t.Errorf("unexpected zip files (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildModule_notGit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/hello/v2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "vendor", "example.com", "dep"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "vendor", "example.com", "dep", "dep.go"), []byte("package dep\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	m, err := BuildModule(dir, "v2.0.0", out)
+	if err != nil {
+		t.Fatalf("BuildModule: %v", err)
+	}
+
+	// Vendored packages are excluded.
+	want := []string{"example.com/hello/v2@v2.0.0/go.mod"}
+	if diff := cmp.Diff(want, zipFileNames(t, filepath.Join(out, m.Zip))); diff != "" {
+		t.Errorf("unexpected zip files (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildModule_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		dir     string
+		version string
+	}{
+		{
+			name:    "not canonical",
+			dir:     "testdata/go",
+			version: "1.2.3",
+		},
+		{
+			name:    "major version without suffix",
+			dir:     "testdata/go",
+			version: "v2.0.0",
+		},
+		{
+			name:    "no go.mod",
+			dir:     "testdata",
+			version: "v1.0.0",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := BuildModule(tt.dir, tt.version, t.TempDir())
+			var errModule *ErrInvalidModule
+			if !errors.As(err, &errModule) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateModuleProvenance(t *testing.T) {
+	// Disable pre-submit detection.
+	// TODO(github.com/slsa-framework/slsa-github-generator/issues/124): Remove
+	t.Setenv("GITHUB_EVENT_NAME", "non_event")
+	t.Setenv("GITHUB_CONTEXT", "{}")
+
+	m := &Module{
+		Path:    "example.com/hello",
+		Version: "v1.2.3",
+		Zip:     "hello@v1.2.3.zip",
+		SHA256:  "2e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d2",
+		DirHash: "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8=",
+	}
+
+	s := &captureSigner{}
+	_, err := GenerateModuleProvenance(m, "/home/foo", nil,
+		s, &testutil.TestTransparencyLog{Entry: &testutil.TestLogEntry{}},
+		&slsa.NilClientProvider{}, common.FormatDSSE,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []intoto.Subject{
+		{
+			Name: "pkg:golang/example.com/hello@v1.2.3",
+			Digest: slsacommon.DigestSet{
+				"sha256":  m.SHA256,
+				"dirHash": m.DirHash,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, s.statement.Subject); diff != "" {
+		t.Errorf("unexpected subjects (-want +got):\n%s", diff)
+	}
+
+	predicate, ok := s.statement.Predicate.(slsa02.ProvenancePredicate)
+	if !ok {
+		t.Fatalf("unexpected predicate type %T", s.statement.Predicate)
+	}
+	wantConfig := buildConfig{
+		Version: buildConfigVersion,
+		Module:  &moduleConfig{Path: m.Path, Version: m.Version, WorkingDir: "/home/foo"},
+	}
+	if diff := cmp.Diff(wantConfig, predicate.BuildConfig); diff != "" {
+		t.Errorf("unexpected build config (-want +got):\n%s", diff)
+	}
+
+	// The go.sum hash is required.
+	m.DirHash = "abc"
+	if _, err := GenerateModuleProvenance(m, "/home/foo", nil,
+		s, &testutil.TestTransparencyLog{Entry: &testutil.TestLogEntry{}},
+		&slsa.NilClientProvider{}, common.FormatDSSE,
+	); err == nil {
+		t.Errorf("expected error for invalid hash")
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+// PolicyEnvVar is the env variable containing the path of the policy file
+// used when none is given explicitly.
+const PolicyEnvVar = "SLSA_GO_BUILDER_POLICY"
+
+var supportedPolicyVersions = map[int]bool{
+	1: true,
+}
+
+// ErrInvalidPolicy indicates an invalid policy file.
+type ErrInvalidPolicy struct {
+	errors.WrappableError
+}
+
+// ErrPolicyViolation indicates a flag or env variable of the config file that
+// is not allowed by the policy.
+type ErrPolicyViolation struct {
+	errors.WrappableError
+
+	// Line and Column are the position of the offending value in the config
+	// file.
+	Line   int
+	Column int
+}
+
+// PolicyRule allows or denies a compiler flag or an env variable.
+type PolicyRule struct {
+	// Name is the exact name of the flag, e.g. `-ldflags`, or of the env
+	// variable, e.g. `GOFLAGS`.
+	Name string
+
+	// Values are regular expressions matching the whole value of the flag
+	// or env variable. The rule applies to any value if empty.
+	Values []*regexp.Regexp
+
+	// Deny denies the flag or env variable instead of allowing it. Deny
+	// rules take precedence over allow rules.
+	Deny bool
+}
+
+// Policy is the allowlist of the compiler flags and env variables of the
+// config file. A flag or env variable is allowed if an allow rule matches it
+// and no deny rule does.
+type Policy struct {
+	Flags []PolicyRule
+	Env   []PolicyRule
+}
+
+type policyFile struct {
+	Version int              `yaml:"version"`
+	Flags   []policyRuleFile `yaml:"flags"`
+	Env     []policyRuleFile `yaml:"env"`
+}
+
+type policyRuleFile struct {
+	Name   string      `yaml:"name"`
+	Values []yaml.Node `yaml:"values"`
+	Deny   bool        `yaml:"deny"`
+}
+
+// See `go help build`. `-mod` is set by the builder, and `-modfile`,
+// `-overlay` and `-toolexec` change the compiled source or the tools used,
+// so they are always denied.
+var defaultFlagRules = []PolicyRule{
+	{Name: "-a"}, {Name: "-race"}, {Name: "-msan"}, {Name: "-asan"},
+	{Name: "-v"}, {Name: "-x"}, {Name: "-buildinfo"},
+	{Name: "-buildmode"}, {Name: "-buildvcs"}, {Name: "-compiler"},
+	{Name: "-gccgoflags"}, {Name: "-gcflags"},
+	{Name: "-ldflags"}, {Name: "-linkshared"},
+	{Name: "-tags"}, {Name: "-trimpath"},
+	{Name: "-mod", Deny: true},
+	{Name: "-modfile", Deny: true},
+	{Name: "-overlay", Deny: true},
+	{Name: "-toolexec", Deny: true},
+}
+
+// See `go help environment`. We want to avoid variable injection, e.g.
+// LD_PRELOAD, etc.
+// See an overview in https://www.hale-legacy.com/class/security/s20/handout/slides-env-vars.pdf.
+var defaultEnvRules = []PolicyRule{
+	{Name: "GOOS"}, {Name: "GOARCH"},
+	{Name: "GO111MODULE"}, {Name: "GOEXPERIMENT"}, {Name: "GOFLAGS"},
+	{Name: "GO386"}, {Name: "GOAMD64"}, {Name: "GOARM"}, {Name: "GOMIPS"},
+	{Name: "GOMIPS64"}, {Name: "GOPPC64"}, {Name: "GOWASM"},
+	{Name: "GOPROXY"}, {Name: "GOPRIVATE"}, {Name: "GONOPROXY"},
+	{Name: "GOSUMDB"}, {Name: "GONOSUMDB"}, {Name: "GOINSECURE"},
+	{Name: "GOTOOLCHAIN", Values: mustCompileValues("local")},
+	{Name: "GOWORK", Values: mustCompileValues("off")},
+	{Name: "CGO_ENABLED", Values: mustCompileValues("0", "1")},
+	{Name: "CGO_CFLAGS"}, {Name: "CGO_CPPFLAGS"}, {Name: "CGO_CXXFLAGS"},
+	{Name: "CGO_FFLAGS"}, {Name: "CGO_LDFLAGS"},
+	// The flags denied on the command line are denied in GOFLAGS too.
+	{Name: "GOFLAGS", Values: mustCompileValues(`(.*\s)?--?(mod|modfile|overlay|toolexec)(=.*|\s.*)?`), Deny: true},
+}
+
+func mustCompileValues(values ...string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, v := range values {
+		res = append(res, regexp.MustCompile("^(?:"+v+")$"))
+	}
+	return res
+}
+
+// DefaultPolicy returns the policy used when no policy file is given.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Flags: append([]PolicyRule{}, defaultFlagRules...),
+		Env:   append([]PolicyRule{}, defaultEnvRules...),
+	}
+}
+
+// PolicyFromFile reads the policy file located at path. Its rules are added
+// to the rules of the default policy, so a policy file can allow additional
+// flags and env variables, restrict their values or deny them.
+func PolicyFromFile(path string) (*Policy, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("%q: os.ReadFile: %w", path, err)
+	}
+
+	p, err := policyFromString(b)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+	return p, nil
+}
+
+func policyFromString(b []byte) (*Policy, error) {
+	var pf policyFile
+	if err := yaml.Unmarshal(b, &pf); err != nil {
+		return nil, errors.Errorf(&ErrInvalidPolicy{}, "yaml.Unmarshal: %v", err)
+	}
+
+	if !supportedPolicyVersions[pf.Version] {
+		return nil, errors.Errorf(&ErrInvalidPolicy{}, "version '%d' not supported", pf.Version)
+	}
+
+	p := DefaultPolicy()
+	for _, rf := range pf.Flags {
+		r, err := rf.rule()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(r.Name, "-") {
+			return nil, errors.Errorf(&ErrInvalidPolicy{}, "flag %q does not start with '-'", r.Name)
+		}
+		p.Flags = append(p.Flags, r)
+	}
+	for _, rf := range pf.Env {
+		r, err := rf.rule()
+		if err != nil {
+			return nil, err
+		}
+		p.Env = append(p.Env, r)
+	}
+	return p, nil
+}
+
+func (rf *policyRuleFile) rule() (PolicyRule, error) {
+	r := PolicyRule{
+		Name: rf.Name,
+		Deny: rf.Deny,
+	}
+	if r.Name == "" || strings.ContainsAny(r.Name, "= \t") {
+		return r, errors.Errorf(&ErrInvalidPolicy{}, "invalid rule name %q", r.Name)
+	}
+
+	for i := range rf.Values {
+		n := &rf.Values[i]
+		if n.Kind != yaml.ScalarNode {
+			return r, errors.Errorf(&ErrInvalidPolicy{}, "line %d: value of %q is not a string", n.Line, r.Name)
+		}
+		re, err := regexp.Compile("^(?:" + n.Value + ")$")
+		if err != nil {
+			return r, errors.Errorf(&ErrInvalidPolicy{}, "line %d: value of %q: %v", n.Line, r.Name, err)
+		}
+		r.Values = append(r.Values, re)
+	}
+	return r, nil
+}
+
+// matches returns true if the rule applies to the name and value.
+func (r *PolicyRule) matches(name, value string) bool {
+	if r.Name != name {
+		return false
+	}
+	if len(r.Values) == 0 {
+		return true
+	}
+	for _, re := range r.Values {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFlag returns an error if the flag, e.g. `-tags=netgo`, is not allowed.
+func (p *Policy) checkFlag(flag string) error {
+	name, value, _ := strings.Cut(flag, "=")
+	// The go command accepts flags with two dashes too.
+	if strings.HasPrefix(name, "--") {
+		name = name[1:]
+	}
+	return check("flag", flag, name, value, p.Flags)
+}
+
+// checkEnv returns an error if the env variable, e.g. `CGO_ENABLED=0`, is not
+// allowed.
+func (p *Policy) checkEnv(env string) error {
+	name, value, _ := strings.Cut(env, "=")
+	return check("env variable", env, name, value, p.Env)
+}
+
+func check(kind, s, name, value string, rules []PolicyRule) error {
+	allowed := false
+	for i := range rules {
+		r := &rules[i]
+		if !r.matches(name, value) {
+			continue
+		}
+		if r.Deny {
+			return fmt.Errorf("%s %q is denied by policy", kind, s)
+		}
+		allowed = true
+	}
+	if !allowed {
+		return fmt.Errorf("%s %q is not allowed by policy", kind, s)
+	}
+	return nil
+}
+
+// checkConfigPolicy checks the flags and env variables of the config file
+// against the policy. The errors contain the position of the offending value
+// in the config file.
+func checkConfigPolicy(doc *yaml.Node, p *Policy) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+
+	if err := checkNodePolicy(root, p); err != nil {
+		return err
+	}
+	if targets := mappingValue(root, "targets"); targets != nil && targets.Kind == yaml.SequenceNode {
+		for _, t := range targets.Content {
+			if err := checkNodePolicy(t, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkNodePolicy checks the `flags` and `env` fields of the mapping n.
+func checkNodePolicy(n *yaml.Node, p *Policy) error {
+	fields := []struct {
+		key   string
+		check func(string) error
+	}{
+		{key: "flags", check: p.checkFlag},
+		{key: "env", check: p.checkEnv},
+	}
+	for _, f := range fields {
+		seq := mappingValue(n, f.key)
+		if seq == nil || seq.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, v := range seq.Content {
+			if err := f.check(v.Value); err != nil {
+				return errors.Errorf(&ErrPolicyViolation{Line: v.Line, Column: v.Column},
+					"line %d: %v", v.Line, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in the mapping n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"testing"
+)
+
+func errInvalidPolicyFunc(t *testing.T, got error) {
+	want := &ErrInvalidPolicy{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", got)
+	}
+}
+
+func TestPolicy_checkFlag(t *testing.T) {
+	t.Parallel()
+
+	custom, err := PolicyFromFile("testdata/policy-valid.yml")
+	if err != nil {
+		t.Fatalf("PolicyFromFile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		flag     string
+		expected bool
+	}{
+		{name: "flag", policy: DefaultPolicy(), flag: "-trimpath", expected: true},
+		{name: "flag with two dashes", policy: DefaultPolicy(), flag: "--trimpath", expected: true},
+		{name: "flag with value", policy: DefaultPolicy(), flag: "-ldflags=-X main.version=1.2.3", expected: true},
+		{name: "flag prefix", policy: DefaultPolicy(), flag: "-ldflagsbla", expected: false},
+		{name: "space flag", policy: DefaultPolicy(), flag: " -trimpath", expected: false},
+		{name: "unknown flag", policy: DefaultPolicy(), flag: "-pgo=auto", expected: false},
+		{name: "denied flag", policy: DefaultPolicy(), flag: "-toolexec=/bin/sh", expected: false},
+		{name: "denied flag with two dashes", policy: DefaultPolicy(), flag: "--toolexec=/bin/sh", expected: false},
+		{name: "denied mod flag", policy: DefaultPolicy(), flag: "-mod=mod", expected: false},
+		{name: "not a flag", policy: DefaultPolicy(), flag: "bla", expected: false},
+		{name: "custom flag", policy: custom, flag: "-pgo=auto", expected: true},
+		{name: "custom flag value", policy: custom, flag: "-pgo=default.pgo", expected: false},
+		{name: "custom denied flag", policy: custom, flag: "-race", expected: false},
+		{name: "custom denied value", policy: custom, flag: "-tags=foo,netgo", expected: false},
+		{name: "custom allowed value", policy: custom, flag: "-tags=foo", expected: true},
+		{name: "default flag", policy: custom, flag: "-trimpath", expected: true},
+		{name: "default denied flag", policy: custom, flag: "-toolexec=/bin/sh", expected: false},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.policy.checkFlag(tt.flag)
+			if got := err == nil; got != tt.expected {
+				t.Errorf("unexpected result for %q, got: %v, want: %v (%v)", tt.flag, got, tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestPolicy_checkEnv(t *testing.T) {
+	t.Parallel()
+
+	custom, err := PolicyFromFile("testdata/policy-valid.yml")
+	if err != nil {
+		t.Fatalf("PolicyFromFile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		env      string
+		expected bool
+	}{
+		{name: "GOOS variable", policy: DefaultPolicy(), env: "GOOS=linux", expected: true},
+		{name: "CGO_ENABLED variable", policy: DefaultPolicy(), env: "CGO_ENABLED=1", expected: true},
+		{name: "CGO_ENABLED value", policy: DefaultPolicy(), env: "CGO_ENABLED=2", expected: false},
+		{name: "GOFLAGS variable", policy: DefaultPolicy(), env: "GOFLAGS=-trimpath -modcacherw", expected: true},
+		{name: "GOFLAGS -mod", policy: DefaultPolicy(), env: "GOFLAGS=-mod=mod", expected: false},
+		{name: "GOFLAGS -toolexec", policy: DefaultPolicy(), env: "GOFLAGS=-trimpath --toolexec /bin/sh", expected: false},
+		{name: "GOSOMETHING variable", policy: DefaultPolicy(), env: "GOSOMETHING=value", expected: false},
+		{name: "CGO_SOMETHING variable", policy: DefaultPolicy(), env: "CGO_SOMETHING=value", expected: false},
+		{name: "BLA variable", policy: DefaultPolicy(), env: "BLA=value", expected: false},
+		{name: "LD_PRELOAD variable", policy: DefaultPolicy(), env: "LD_PRELOAD=/tmp/lib.so", expected: false},
+		{name: "custom variable", policy: custom, env: "GOFIPS140=latest", expected: true},
+		{name: "custom denied value", policy: custom, env: "CGO_LDFLAGS=-fuse-ld=gold", expected: false},
+		{name: "custom allowed value", policy: custom, env: "CGO_LDFLAGS=-lm", expected: true},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.policy.checkEnv(tt.env)
+			if got := err == nil; got != tt.expected {
+				t.Errorf("unexpected result for %q, got: %v, want: %v (%v)", tt.env, got, tt.expected, err)
+			}
+		})
+	}
+}
+
+func Test_policyFromString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{
+			name:   "no version",
+			policy: "flags:\n  - name: -pgo\n",
+		},
+		{
+			name:   "unsupported version",
+			policy: "version: 2\n",
+		},
+		{
+			name:   "empty name",
+			policy: "version: 1\nenv:\n  - values: [\"1\"]\n",
+		},
+		{
+			name:   "name with value",
+			policy: "version: 1\nflags:\n  - name: -tags=netgo\n",
+		},
+		{
+			name:   "flag without dash",
+			policy: "version: 1\nflags:\n  - name: tags\n",
+		},
+		{
+			name:   "invalid value pattern",
+			policy: "version: 1\nenv:\n  - name: GOFLAGS\n    values:\n      - \"(\"\n",
+		},
+		{
+			name:   "value not a string",
+			policy: "version: 1\nenv:\n  - name: GOFLAGS\n    values:\n      - [a]\n",
+		},
+		{
+			name:   "invalid yaml",
+			policy: "version: [",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := policyFromString([]byte(tt.policy))
+			errInvalidPolicyFunc(t, err)
+		})
+	}
+}
+
+func TestConfigFromFile_policy(t *testing.T) {
+	t.Parallel()
+
+	custom, err := PolicyFromFile("testdata/policy-valid.yml")
+	if err != nil {
+		t.Fatalf("PolicyFromFile: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		policy *Policy
+		line   int
+		column int
+	}{
+		{
+			name:   "denied target flag",
+			path:   "./testdata/releaser-invalid-policy-flag.yml",
+			line:   19,
+			column: 9,
+		},
+		{
+			name:   "denied env value",
+			path:   "./testdata/releaser-invalid-policy-env.yml",
+			line:   4,
+			column: 5,
+		},
+		{
+			name:   "flag denied by custom policy",
+			path:   "./testdata/releaser-valid-targets.yml",
+			policy: custom,
+			line:   23,
+			column: 9,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ConfigFromFile(tt.path, tt.policy)
+			var errViolation *ErrPolicyViolation
+			if !errors.As(err, &errViolation) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if errViolation.Line != tt.line || errViolation.Column != tt.column {
+				t.Errorf("unexpected position, got: %d:%d, want: %d:%d (%v)",
+					errViolation.Line, errViolation.Column, tt.line, tt.column, err)
+			}
+		})
+	}
+}
+
+func TestConfigFromFile_policyTargets(t *testing.T) {
+	t.Parallel()
+
+	p := DefaultPolicy()
+	cfg, err := ConfigFromFile("./testdata/releaser-valid-targets.yml", p)
+	if err != nil {
+		t.Fatalf("ConfigFromFile: %v", err)
+	}
+
+	// The targets are built with the policy of the config.
+	if cfg.Policy != p {
+		t.Errorf("unexpected policy: %v", cfg.Policy)
+	}
+	for i, target := range cfg.Targets {
+		if target.Policy != p {
+			t.Errorf("unexpected policy for target %d: %v", i, target.Policy)
+		}
+	}
+}
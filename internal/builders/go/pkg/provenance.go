@@ -25,6 +25,7 @@ import (
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	"github.com/slsa-framework/slsa-github-generator/github"
+	"github.com/slsa-framework/slsa-github-generator/internal/builders/common"
 	"github.com/slsa-framework/slsa-github-generator/internal/utils"
 	"github.com/slsa-framework/slsa-github-generator/slsa"
 )
@@ -36,13 +37,24 @@ const (
 
 type (
 	step struct {
-		WorkingDir string   `json:"workingDir"`
-		Command    []string `json:"command"`
-		Env        []string `json:"env"`
+		WorkingDir string            `json:"workingDir"`
+		Command    []string          `json:"command"`
+		Env        []string          `json:"env"`
+		Variables  map[string]string `json:"variables,omitempty"`
+	}
+	moduleConfig struct {
+		Path       string `json:"path"`
+		Version    string `json:"version"`
+		WorkingDir string `json:"workingDir"`
 	}
 	buildConfig struct {
-		Steps   []step `json:"steps"`
-		Version int    `json:"version"`
+		Steps []step `json:"steps,omitempty"`
+		// Workspace is set for builds in a go.work workspace, which are
+		// vendored with `go work vendor`.
+		Workspace *Workspace `json:"workspace,omitempty"`
+		// Module is set for module zip builds, which have no steps.
+		Module  *moduleConfig `json:"module,omitempty"`
+		Version int           `json:"version"`
 	}
 )
 
@@ -62,64 +74,149 @@ func (b *goProvenanceBuild) BuildConfig(context.Context) (interface{}, error) {
 }
 
 // GenerateProvenance translates github context into a SLSA provenance
-// attestation.
+// attestation. The materials of the build, e.g. the Go toolchain and module
+// dependencies, are added to the provenance materials. The signed
+// attestation is returned encoded in the given format.
 // Spec: https://slsa.dev/provenance/v0.2
 func GenerateProvenance(name, digest, command, envs, workingDir string,
-	s signing.Signer, r signing.TransparencyLog, provider slsa.ClientProvider,
+	materials []slsacommon.ProvenanceMaterial, s signing.Signer, r signing.TransparencyLog, provider slsa.ClientProvider,
+	format common.AttestationFormat,
 ) ([]byte, error) {
-	gh, err := github.GetWorkflowContext()
+	com, err := utils.UnmarshalList(command)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := hex.DecodeString(digest); err != nil || len(digest) != 64 {
-		return nil, fmt.Errorf("sha256 digest is not valid: %s", digest)
-	}
-
-	com, err := utils.UnmarshalList(command)
+	env, err := utils.UnmarshalList(envs)
 	if err != nil {
 		return nil, err
 	}
 
-	env, err := utils.UnmarshalList(envs)
+	return GenerateMultiProvenance([]Target{
+		{
+			Binary:  name,
+			Digest:  digest,
+			Command: com,
+			Env:     env,
+		},
+	}, nil, workingDir, nil, materials, s, r, provider, format)
+}
+
+// GenerateMultiProvenance generates a single SLSA provenance attestation
+// covering the binaries of all the given targets and the artifacts created
+// from them, i.e. archives and checksums files. If the build is in a go.work
+// workspace, the workspace is vendored instead of the module in workingDir.
+// The signed attestation is returned encoded in the given format.
+func GenerateMultiProvenance(targets []Target, artifacts []Artifact, workingDir string, workspace *Workspace,
+	materials []slsacommon.ProvenanceMaterial, s signing.Signer, r signing.TransparencyLog, provider slsa.ClientProvider,
+	format common.AttestationFormat,
+) ([]byte, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no binaries to generate provenance for")
+	}
+
+	var subjects []intoto.Subject
+	for _, t := range targets {
+		subject, err := newSubject(t.Binary, t.Digest)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+	for _, a := range artifacts {
+		subject, err := newSubject(a.Name, a.Digest)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+
+	// Note: all targets are compiled with the same compiler.
+	var steps []step
+	if com := targets[0].Command; len(com) > 0 && modMode(com) == ModReadonly {
+		// Download and verification steps, with the module env variables
+		// of the compilation.
+		for _, s := range downloadSteps(com[0], workingDir, targets[0].Env) {
+			steps = append(steps, step{
+				Command:    s.Command,
+				Env:        s.Env,
+				WorkingDir: s.WorkingDir,
+			})
+		}
+	} else {
+		var cmd []string
+		vendorDir := workingDir
+		if len(com) > 0 {
+			cmd = []string{com[0], "mod", "vendor"}
+			if workspace != nil {
+				cmd = []string{com[0], "work", "vendor"}
+				vendorDir = workspace.Dir
+			}
+		}
+
+		// Vendoring step.
+		steps = append(steps, step{
+			// Note: vendoring and compilation are
+			// performed in the same VM, so the compiler is
+			// the same.
+			Command:    cmd,
+			WorkingDir: vendorDir,
+			// Note: No user-defined env set for this step.
+		})
+	}
+	// Compilation steps.
+	for _, t := range targets {
+		steps = append(steps, step{
+			Command:    t.Command,
+			Env:        t.Env,
+			Variables:  t.Variables,
+			WorkingDir: workingDir,
+		})
+	}
+
+	return generateProvenance(subjects, buildConfig{
+		Version:   buildConfigVersion,
+		Steps:     steps,
+		Workspace: workspace,
+	}, materials, s, r, provider, format)
+}
+
+// GenerateModuleProvenance generates a SLSA provenance attestation for the
+// zip of a Go module. The subject is the package URL of the module with the
+// sha256 digest and the go.sum hash of the zip. The signed attestation is
+// returned encoded in the given format.
+func GenerateModuleProvenance(m *Module, workingDir string,
+	materials []slsacommon.ProvenanceMaterial, s signing.Signer, r signing.TransparencyLog, provider slsa.ClientProvider,
+	format common.AttestationFormat,
+) ([]byte, error) {
+	subject, err := m.subject()
 	if err != nil {
 		return nil, err
 	}
 
-	var cmd []string
-	if len(com) > 0 {
-		cmd = []string{com[0], "mod", "vendor"}
+	return generateProvenance([]intoto.Subject{subject}, buildConfig{
+		Version: buildConfigVersion,
+		Module: &moduleConfig{
+			Path:       m.Path,
+			Version:    m.Version,
+			WorkingDir: workingDir,
+		},
+	}, materials, s, r, provider, format)
+}
+
+// generateProvenance generates and signs the provenance of the subjects.
+func generateProvenance(subjects []intoto.Subject, cfg buildConfig,
+	materials []slsacommon.ProvenanceMaterial, s signing.Signer, r signing.TransparencyLog, provider slsa.ClientProvider,
+	format common.AttestationFormat,
+) ([]byte, error) {
+	gh, err := github.GetWorkflowContext()
+	if err != nil {
+		return nil, err
 	}
 
 	b := goProvenanceBuild{
-		GithubActionsBuild: slsa.NewGithubActionsBuild([]intoto.Subject{
-			{
-				Name: name,
-				Digest: slsacommon.DigestSet{
-					"sha256": digest,
-				},
-			},
-		}, &gh),
-		buildConfig: buildConfig{
-			Version: buildConfigVersion,
-			Steps: []step{
-				// Vendoring step.
-				{
-					// Note: vendoring and compilation are
-					// performed in the same VM, so the compiler is
-					// the same.
-					Command:    cmd,
-					WorkingDir: workingDir,
-					// Note: No user-defined env set for this step.
-				},
-				// Compilation step.
-				{
-					Command:    com,
-					Env:        env,
-					WorkingDir: workingDir,
-				},
-			},
-		},
+		GithubActionsBuild: slsa.NewGithubActionsBuild(subjects, &gh),
+		buildConfig:        cfg,
 	}
 
 	// Pre-submit tests don't have access to write OIDC token.
@@ -166,6 +263,7 @@ func GenerateProvenance(name, digest, command, envs, workingDir string,
 		),
 	}
 	p.Predicate.Materials = append(p.Predicate.Materials, runnerMaterials)
+	p.Predicate.Materials = append(p.Predicate.Materials, materials...)
 
 	if utils.IsPresubmitTests() {
 		fmt.Println("Pre-submit tests detected. Skipping signing.")
@@ -189,5 +287,19 @@ func GenerateProvenance(name, digest, command, envs, workingDir string,
 
 	fmt.Printf("Uploaded signed attestation to rekor with UUID %s.\n", logEntry.UUID())
 
-	return att.Bytes(), nil
+	return format.Encode(att, logEntry)
+}
+
+// newSubject returns the subject of the file name with the hex-encoded
+// sha256 digest.
+func newSubject(name, digest string) (intoto.Subject, error) {
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != 64 {
+		return intoto.Subject{}, fmt.Errorf("sha256 digest is not valid: %s", digest)
+	}
+	return intoto.Subject{
+		Name: name,
+		Digest: slsacommon.DigestSet{
+			"sha256": digest,
+		},
+	}, nil
 }
@@ -15,9 +15,17 @@
 package pkg
 
 import (
+	"context"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/builders/common"
 	"github.com/slsa-framework/slsa-github-generator/internal/testutil"
+	"github.com/slsa-framework/slsa-github-generator/signing"
 	"github.com/slsa-framework/slsa-github-generator/slsa"
 )
 
@@ -28,11 +36,223 @@ func TestGenerateProvenance_withErr(t *testing.T) {
 	t.Setenv("GITHUB_CONTEXT", "{}")
 	sha256 := "2e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d2"
 	_, err := GenerateProvenance(
-		"foo", sha256, "", "", "/home/foo",
+		"foo", sha256, "", "", "/home/foo", nil,
 		&testutil.TestSigner{}, &testutil.TransparencyLogWithErr{},
-		&slsa.NilClientProvider{},
+		&slsa.NilClientProvider{}, common.FormatDSSE,
 	)
 	if want, got := testutil.ErrTransparencyLog, err; want != got {
 		t.Errorf("expected error, want: %v, got: %v", want, got)
 	}
 }
+
+// captureSigner records the statement it signs.
+type captureSigner struct {
+	testutil.TestSigner
+	statement *intoto.Statement
+}
+
+func (s *captureSigner) Sign(ctx context.Context, p *intoto.Statement) (signing.Attestation, error) {
+	s.statement = p
+	return s.TestSigner.Sign(ctx, p)
+}
+
+func TestGenerateMultiProvenance(t *testing.T) {
+	// Disable pre-submit detection.
+	// TODO(github.com/slsa-framework/slsa-github-generator/issues/124): Remove
+	t.Setenv("GITHUB_EVENT_NAME", "non_event")
+	t.Setenv("GITHUB_CONTEXT", "{}")
+
+	targets := []Target{
+		{
+			Binary:    "binary-linux-amd64",
+			Digest:    "2e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d2",
+			Variables: map[string]string{"Os": "linux", "Arch": "amd64"},
+			Command:   []string{"/usr/bin/go", "build", "-o", "binary-linux-amd64"},
+			Env:       []string{"GOOS=linux", "GOARCH=amd64"},
+		},
+		{
+			Binary:  "binary-darwin-arm64",
+			Digest:  "7c89d4681d22e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c",
+			Command: []string{"/usr/bin/go", "build", "-o", "binary-darwin-arm64"},
+			Env:     []string{"GOOS=darwin", "GOARCH=arm64"},
+		},
+	}
+
+	materials := []slsacommon.ProvenanceMaterial{
+		{URI: "pkg:golang/stdlib@go1.20.1"},
+		{
+			URI:    "pkg:golang/golang.org/x/mod@v0.8.0",
+			Digest: slsacommon.DigestSet{"dirHash": "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8="},
+		},
+	}
+
+	artifacts := []Artifact{
+		{Name: "binary-linux-amd64.tar.gz", Digest: "a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d22e0390eb024"},
+		{Name: "checksums.txt", Digest: "b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d22e0390eb024a52963db7"},
+	}
+
+	s := &captureSigner{}
+	_, err := GenerateMultiProvenance(targets, artifacts, "/home/foo", nil, materials,
+		s, &testutil.TestTransparencyLog{Entry: &testutil.TestLogEntry{}},
+		&slsa.NilClientProvider{}, common.FormatDSSE,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []intoto.Subject{
+		{Name: "binary-linux-amd64", Digest: slsacommon.DigestSet{"sha256": targets[0].Digest}},
+		{Name: "binary-darwin-arm64", Digest: slsacommon.DigestSet{"sha256": targets[1].Digest}},
+		{Name: "binary-linux-amd64.tar.gz", Digest: slsacommon.DigestSet{"sha256": artifacts[0].Digest}},
+		{Name: "checksums.txt", Digest: slsacommon.DigestSet{"sha256": artifacts[1].Digest}},
+	}
+	if diff := cmp.Diff(want, s.statement.Subject); diff != "" {
+		t.Errorf("unexpected subjects (-want +got):\n%s", diff)
+	}
+
+	predicate, ok := s.statement.Predicate.(slsa02.ProvenancePredicate)
+	if !ok {
+		t.Fatalf("unexpected predicate type %T", s.statement.Predicate)
+	}
+	wantConfig := buildConfig{
+		Version: buildConfigVersion,
+		Steps: []step{
+			{Command: []string{"/usr/bin/go", "mod", "vendor"}, WorkingDir: "/home/foo"},
+			{Command: targets[0].Command, Env: targets[0].Env, Variables: targets[0].Variables, WorkingDir: "/home/foo"},
+			{Command: targets[1].Command, Env: targets[1].Env, WorkingDir: "/home/foo"},
+		},
+	}
+	if diff := cmp.Diff(wantConfig, predicate.BuildConfig); diff != "" {
+		t.Errorf("unexpected build config (-want +got):\n%s", diff)
+	}
+
+	// The build materials follow the source and runner materials.
+	got := predicate.Materials[len(predicate.Materials)-len(materials):]
+	if diff := cmp.Diff(materials, got); diff != "" {
+		t.Errorf("unexpected materials (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateMultiProvenance_workspace(t *testing.T) {
+	// Disable pre-submit detection.
+	// TODO(github.com/slsa-framework/slsa-github-generator/issues/124): Remove
+	t.Setenv("GITHUB_EVENT_NAME", "non_event")
+	t.Setenv("GITHUB_CONTEXT", "{}")
+
+	targets := []Target{
+		{
+			Binary:  "binary-linux-amd64",
+			Digest:  "2e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d2",
+			Command: []string{"/usr/bin/go", "build", "-mod=vendor", "-o", "binary-linux-amd64"},
+		},
+	}
+	workspace := &Workspace{
+		Dir:          "/home/foo",
+		Modules:      []WorkspaceModule{{Path: "example.com/a", Dir: "a"}, {Path: "example.com/lib", Dir: "lib"}},
+		Replacements: []WorkspaceModule{{Path: "example.com/lib", Dir: "lib"}},
+	}
+
+	s := &captureSigner{}
+	_, err := GenerateMultiProvenance(targets, nil, "/home/foo/a", workspace, nil,
+		s, &testutil.TestTransparencyLog{Entry: &testutil.TestLogEntry{}},
+		&slsa.NilClientProvider{}, common.FormatDSSE,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	predicate, ok := s.statement.Predicate.(slsa02.ProvenancePredicate)
+	if !ok {
+		t.Fatalf("unexpected predicate type %T", s.statement.Predicate)
+	}
+	// The workspace is vendored in its directory.
+	wantConfig := buildConfig{
+		Version: buildConfigVersion,
+		Steps: []step{
+			{Command: []string{"/usr/bin/go", "work", "vendor"}, WorkingDir: "/home/foo"},
+			{Command: targets[0].Command, WorkingDir: "/home/foo/a"},
+		},
+		Workspace: workspace,
+	}
+	if diff := cmp.Diff(wantConfig, predicate.BuildConfig); diff != "" {
+		t.Errorf("unexpected build config (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateMultiProvenance_readonly(t *testing.T) {
+	// Disable pre-submit detection.
+	// TODO(github.com/slsa-framework/slsa-github-generator/issues/124): Remove
+	t.Setenv("GITHUB_EVENT_NAME", "non_event")
+	t.Setenv("GITHUB_CONTEXT", "{}")
+
+	targets := []Target{
+		{
+			Binary:  "binary-linux-amd64",
+			Digest:  "2e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d2",
+			Command: []string{"/usr/bin/go", "build", "-mod=readonly", "-o", "binary-linux-amd64"},
+			Env:     []string{"GOOS=linux", "GOARCH=amd64", "GOPROXY=https://proxy.example.com", "GONOSUMDB=example.com"},
+		},
+	}
+
+	s := &captureSigner{}
+	_, err := GenerateMultiProvenance(targets, nil, "/home/foo", nil, nil,
+		s, &testutil.TestTransparencyLog{Entry: &testutil.TestLogEntry{}},
+		&slsa.NilClientProvider{}, common.FormatDSSE,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	predicate, ok := s.statement.Predicate.(slsa02.ProvenancePredicate)
+	if !ok {
+		t.Fatalf("unexpected predicate type %T", s.statement.Predicate)
+	}
+	// The modules are downloaded and verified with the module env
+	// variables instead of being vendored.
+	env := []string{"GOPROXY=https://proxy.example.com", "GONOSUMDB=example.com"}
+	wantConfig := buildConfig{
+		Version: buildConfigVersion,
+		Steps: []step{
+			{Command: []string{"/usr/bin/go", "mod", "download", "-json"}, Env: env, WorkingDir: "/home/foo"},
+			{Command: []string{"/usr/bin/go", "mod", "verify"}, Env: env, WorkingDir: "/home/foo"},
+			{Command: targets[0].Command, Env: targets[0].Env, WorkingDir: "/home/foo"},
+		},
+	}
+	if diff := cmp.Diff(wantConfig, predicate.BuildConfig); diff != "" {
+		t.Errorf("unexpected build config (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateMultiProvenance_invalidDigest(t *testing.T) {
+	t.Setenv("GITHUB_EVENT_NAME", "non_event")
+	t.Setenv("GITHUB_CONTEXT", "{}")
+
+	valid := "2e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d2"
+	tests := []struct {
+		name      string
+		targets   []Target
+		artifacts []Artifact
+	}{
+		{
+			name:    "target",
+			targets: []Target{{Binary: "foo", Digest: "abc"}},
+		},
+		{
+			name:      "artifact",
+			targets:   []Target{{Binary: "foo", Digest: valid}},
+			artifacts: []Artifact{{Name: "foo.zip", Digest: "abc"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateMultiProvenance(tt.targets, tt.artifacts, "/home/foo", nil, nil,
+				&testutil.TestSigner{}, &testutil.TestTransparencyLog{},
+				&slsa.NilClientProvider{}, common.FormatDSSE,
+			)
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
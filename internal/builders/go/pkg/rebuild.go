@@ -0,0 +1,568 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+	"github.com/slsa-framework/slsa-github-generator/internal/runner"
+	"github.com/slsa-framework/slsa-github-generator/signing/bundle"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+)
+
+type errInvalidProvenance struct {
+	errors.WrappableError
+}
+
+type errInvalidStep struct {
+	errors.WrappableError
+}
+
+// RebuildOptions are the options used to rebuild the binaries of a
+// provenance.
+type RebuildOptions struct {
+	// Goc is the path of the Go compiler used for the rebuild. It replaces
+	// the compiler recorded in the provenance.
+	Goc string
+
+	// Dir is the empty directory the source is checked out in.
+	Dir string
+
+	// Policy is the allowlist of the flags and env variables of the
+	// replayed steps. The default policy is used if nil.
+	Policy *Policy
+
+	// Repository is the repository the source is fetched from. It defaults
+	// to the repository recorded in the provenance and may be set to use a
+	// mirror or a local clone.
+	Repository string
+
+	// Stdout and Stderr are the Writers used for the output of the
+	// commands. If nil then os.Stdout and os.Stderr are used.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// RebuildReport is the result of the rebuild of the binaries of a
+// provenance.
+type RebuildReport struct {
+	// Subjects are the rebuilt subjects of the provenance.
+	Subjects []SubjectRebuild `json:"subjects"`
+
+	// Toolchain is the Go toolchain recorded in the provenance materials,
+	// e.g. go1.19.5. It is empty if not recorded.
+	Toolchain string `json:"toolchain,omitempty"`
+
+	// RebuildToolchain is the Go toolchain used for the rebuild.
+	RebuildToolchain string `json:"rebuildToolchain"`
+}
+
+// SubjectRebuild is the result of the rebuild of a single subject.
+type SubjectRebuild struct {
+	// Name is the name of the subject.
+	Name string `json:"name"`
+
+	// Digest is the hex-encoded sha256 digest of the subject.
+	Digest string `json:"digest"`
+
+	// RebuildDigest is the hex-encoded sha256 digest of the rebuilt binary.
+	RebuildDigest string `json:"rebuildDigest"`
+
+	// Command and Env are the compilation command and env variables
+	// recorded in the provenance.
+	Command []string `json:"command"`
+	Env     []string `json:"env"`
+
+	// RebuildCommand and RebuildEnv are the compilation command and env
+	// variables of the rebuild.
+	RebuildCommand []string `json:"rebuildCommand"`
+	RebuildEnv     []string `json:"rebuildEnv"`
+}
+
+// RebuildDiff is the machine-readable difference between the build recorded
+// in a provenance and its rebuild.
+type RebuildDiff struct {
+	// Subjects are the subjects that were not reproduced.
+	Subjects []SubjectDiff `json:"subjects"`
+
+	// Toolchain is set if the Go toolchain of the rebuild is not the one
+	// recorded in the provenance.
+	Toolchain *StringDiff `json:"toolchain,omitempty"`
+}
+
+// SubjectDiff is the difference between a subject of a provenance and its
+// rebuilt binary.
+type SubjectDiff struct {
+	// Name is the name of the subject.
+	Name string `json:"name"`
+
+	// Digest are the hex-encoded sha256 digests of the subject and of the
+	// rebuilt binary.
+	Digest StringDiff `json:"digest"`
+
+	// Command are the recorded and replayed compilation commands.
+	Command ListDiff `json:"command"`
+
+	// Env are the recorded and replayed env variables of the compilation.
+	Env ListDiff `json:"env"`
+}
+
+// StringDiff is a value recorded in a provenance and the value of its
+// rebuild.
+type StringDiff struct {
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// ListDiff is a list recorded in a provenance and the list of its rebuild.
+type ListDiff struct {
+	Expected []string `json:"expected"`
+	Actual   []string `json:"actual"`
+}
+
+// Reproduced returns true if the rebuilt binary is identical to the subject.
+func (s *SubjectRebuild) Reproduced() bool {
+	return strings.EqualFold(s.Digest, s.RebuildDigest)
+}
+
+// Reproduced returns true if all the rebuilt binaries are identical to the
+// subjects of the provenance.
+func (r *RebuildReport) Reproduced() bool {
+	for i := range r.Subjects {
+		if !r.Subjects[i].Reproduced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff returns the difference between the subjects of the provenance and the
+// rebuilt binaries. It is nil if all the binaries were reproduced.
+func (r *RebuildReport) Diff() *RebuildDiff {
+	var d RebuildDiff
+	for i := range r.Subjects {
+		s := &r.Subjects[i]
+		if s.Reproduced() {
+			continue
+		}
+		d.Subjects = append(d.Subjects, SubjectDiff{
+			Name:    s.Name,
+			Digest:  StringDiff{Expected: s.Digest, Actual: s.RebuildDigest},
+			Command: ListDiff{Expected: s.Command, Actual: s.RebuildCommand},
+			Env:     ListDiff{Expected: s.Env, Actual: s.RebuildEnv},
+		})
+	}
+	if len(d.Subjects) == 0 {
+		return nil
+	}
+
+	// A different toolchain is the most common cause of differences.
+	if r.Toolchain != "" && r.Toolchain != r.RebuildToolchain {
+		d.Toolchain = &StringDiff{Expected: r.Toolchain, Actual: r.RebuildToolchain}
+	}
+	return &d
+}
+
+// VerifyProvenance verifies the signatures of a Go builder provenance in a
+// DSSE envelope or a Sigstore bundle with opts and returns the provenance.
+// The builder ID of the provenance must be the identity of a verified
+// signing certificate.
+func VerifyProvenance(attBytes []byte, opts *envelope.VerifyOptions) (*intoto.ProvenanceStatement, error) {
+	envBytes, err := bundleEnvelope(attBytes)
+	if err != nil {
+		return nil, err
+	}
+	v, err := envelope.Verify(envBytes, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", &errInvalidProvenance{}, err)
+	}
+	p, err := ParseProvenance(v.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: The builder ID is written by the signer, so it is checked
+	// against the identity attested by the certificate authority.
+	for i := range v.Signatures {
+		sig := &v.Signatures[i]
+		if !sig.Verified() || sig.Cert == nil {
+			continue
+		}
+		for _, uri := range sig.Cert.URIs {
+			if uri.String() == p.Predicate.Builder.ID {
+				return p, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: builder ID %q is not the identity of a verified signing certificate",
+		&errInvalidProvenance{}, p.Predicate.Builder.ID)
+}
+
+// bundleEnvelope returns the DSSE envelope of a Sigstore bundle, with the
+// signing certificate and timestamp of the bundle attached to its signature.
+// Other attestations are returned as is.
+func bundleEnvelope(attBytes []byte) ([]byte, error) {
+	var b bundle.Bundle
+	if err := json.Unmarshal(attBytes, &b); err != nil {
+		return nil, fmt.Errorf("%w: %v", &errInvalidProvenance{}, err)
+	}
+	if b.DSSEEnvelope == nil {
+		return attBytes, nil
+	}
+	if len(b.DSSEEnvelope.Signatures) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one signature in the bundle", &errInvalidProvenance{})
+	}
+
+	sig := envelope.Signature{
+		KeyID: b.DSSEEnvelope.Signatures[0].KeyID,
+		Sig:   b.DSSEEnvelope.Signatures[0].Sig,
+	}
+	if vm := b.VerificationMaterial; vm != nil {
+		if vm.X509CertificateChain != nil && len(vm.X509CertificateChain.Certificates) > 0 {
+			sig.Cert = string(pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: vm.X509CertificateChain.Certificates[0].RawBytes,
+			}))
+		}
+		if ts := vm.TimestampVerificationData; ts != nil && len(ts.RFC3161Timestamps) > 0 {
+			sig.Timestamp = base64.StdEncoding.EncodeToString(ts.RFC3161Timestamps[0].SignedTimestamp)
+		}
+	}
+	return json.Marshal(&envelope.Envelope{
+		PayloadType: b.DSSEEnvelope.PayloadType,
+		Payload:     b.DSSEEnvelope.Payload,
+		Signatures:  []envelope.Signature{sig},
+	})
+}
+
+// ParseProvenance parses a Go builder provenance from a DSSE envelope, a
+// Sigstore bundle or an unsigned in-toto statement.
+// NOTE: signatures are not verified, so the provenance must be trusted. Use
+// VerifyProvenance otherwise.
+func ParseProvenance(attBytes []byte) (*intoto.ProvenanceStatement, error) {
+	var att struct {
+		// DSSE envelope.
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+
+		// Sigstore bundle.
+		DSSEEnvelope *struct {
+			Payload string `json:"payload"`
+		} `json:"dsseEnvelope"`
+	}
+	if err := json.Unmarshal(attBytes, &att); err != nil {
+		return nil, fmt.Errorf("%w: %v", &errInvalidProvenance{}, err)
+	}
+
+	payload := attBytes
+	encoded := att.Payload
+	if att.DSSEEnvelope != nil {
+		encoded = att.DSSEEnvelope.Payload
+	}
+	if encoded != "" {
+		var err error
+		payload, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: decoding payload: %v", &errInvalidProvenance{}, err)
+		}
+	}
+
+	var p intoto.ProvenanceStatement
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("%w: decoding statement: %v", &errInvalidProvenance{}, err)
+	}
+	if p.Predicate.BuildType != buildType {
+		return nil, fmt.Errorf("%w: unexpected build type %q", &errInvalidProvenance{}, p.Predicate.BuildType)
+	}
+	return &p, nil
+}
+
+// Rebuild checks out the source recorded in the provenance, replays its
+// build steps and compares the rebuilt binaries to the subjects.
+func Rebuild(ctx context.Context, p *intoto.ProvenanceStatement, opts *RebuildOptions) (*RebuildReport, error) {
+	var cfg buildConfig
+	if err := remarshal(p.Predicate.BuildConfig, &cfg); err != nil {
+		return nil, fmt.Errorf("%w: decoding buildConfig: %v", &errInvalidProvenance{}, err)
+	}
+	if cfg.Version != buildConfigVersion {
+		return nil, fmt.Errorf("%w: unsupported buildConfig version %d", &errInvalidProvenance{}, cfg.Version)
+	}
+	setup := setupStepCount(cfg.Steps)
+	if setup == 0 || setup == len(cfg.Steps) {
+		return nil, fmt.Errorf("%w: expected vendoring or download steps and compilation steps", &errInvalidProvenance{})
+	}
+
+	source := p.Predicate.Invocation.ConfigSource
+	repoURI, _, _ := strings.Cut(strings.TrimPrefix(source.URI, "git+"), "@")
+	commit := source.Digest["sha1"]
+	if repoURI == "" || commit == "" {
+		return nil, fmt.Errorf("%w: no source repository or digest", &errInvalidProvenance{})
+	}
+	repo := opts.Repository
+	if repo == "" {
+		repo = repoURI
+	}
+
+	rebuildToolchain, err := toolchainMaterial(opts.Goc)
+	if err != nil {
+		return nil, err
+	}
+	report := &RebuildReport{
+		RebuildToolchain: strings.TrimPrefix(rebuildToolchain.URI, toolchainURIPrefix),
+	}
+	for _, m := range p.Predicate.Materials {
+		if strings.HasPrefix(m.URI, toolchainURIPrefix) {
+			report.Toolchain = strings.TrimPrefix(m.URI, toolchainURIPrefix)
+		}
+	}
+
+	r := runner.CommandRunner{
+		Stdout: opts.Stdout,
+		Stderr: opts.Stderr,
+	}
+
+	// Check out the source.
+	r.Steps = append(r.Steps,
+		&runner.CommandStep{Command: []string{"git", "init", "-q"}, WorkingDir: opts.Dir},
+		&runner.CommandStep{Command: []string{"git", "fetch", "-q", "--depth=1", repo, commit}, WorkingDir: opts.Dir},
+		&runner.CommandStep{Command: []string{"git", "checkout", "-q", "--detach", "FETCH_HEAD"}, WorkingDir: opts.Dir},
+	)
+
+	policy := opts.Policy
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+
+	// Replay the vendoring or download steps and the compilation steps.
+	type compilation struct {
+		binary   string
+		recorded step
+		replayed *runner.CommandStep
+	}
+	var compilations []compilation
+	for i, s := range cfg.Steps {
+		dir, err := rebuildDir(opts.Dir, s.WorkingDir, path.Base(repoURI))
+		if err != nil {
+			return nil, err
+		}
+
+		step, binary, err := rebuildStep(s, i < setup, opts.Goc, policy)
+		if err != nil {
+			return nil, err
+		}
+		step.WorkingDir = dir
+		r.Steps = append(r.Steps, step)
+		if binary != "" {
+			compilations = append(compilations, compilation{
+				binary:   filepath.Join(dir, binary),
+				recorded: s,
+				replayed: step,
+			})
+		}
+	}
+
+	if _, err := r.Run(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, c := range compilations {
+		subject, err := findSubject(p.Subject, filepath.Base(c.binary))
+		if err != nil {
+			return nil, err
+		}
+		digest, err := computeSHA256(c.binary)
+		if err != nil {
+			return nil, err
+		}
+		report.Subjects = append(report.Subjects, SubjectRebuild{
+			Name:           subject.Name,
+			Digest:         subject.Digest["sha256"],
+			RebuildDigest:  digest,
+			Command:        c.recorded.Command,
+			Env:            c.recorded.Env,
+			RebuildCommand: c.replayed.Command,
+			RebuildEnv:     c.replayed.Env,
+		})
+	}
+	return report, nil
+}
+
+// rebuildDir returns the directory in the checkout at dir corresponding to
+// the recorded working directory. The repository is checked out in the
+// GitHub workspace, i.e. `<work>/<repo>/<repo>`, by the workflows.
+func rebuildDir(dir, workingDir, repo string) (string, error) {
+	workspace := "/" + repo + "/" + repo
+	i := strings.LastIndex(workingDir+"/", workspace+"/")
+	if i < 0 {
+		return "", fmt.Errorf("%w: working directory %q is not in the workspace of %q",
+			&errInvalidStep{}, workingDir, repo)
+	}
+	rel := strings.TrimPrefix(workingDir[i+len(workspace):], "/")
+	if rel != "" {
+		if err := validatePath(rel); err != nil {
+			return "", fmt.Errorf("%w: working directory %q: %v", &errInvalidStep{}, workingDir, err)
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+// setupCommands are the arguments of the commands run before the
+// compilation: `go mod vendor`, or `go work vendor` for builds in a go.work
+// workspace, in ModVendor mode, and `go mod download -json` and
+// `go mod verify` in ModReadonly mode.
+var setupCommands = [][]string{
+	{"mod", "vendor"},
+	{"work", "vendor"},
+	{"mod", "download", "-json"},
+	{"mod", "verify"},
+}
+
+// setupStepCount returns the number of steps before the first compilation
+// step.
+func setupStepCount(steps []step) int {
+	for i, s := range steps {
+		if len(s.Command) > 1 && s.Command[1] == "build" {
+			return i
+		}
+	}
+	return len(steps)
+}
+
+// rebuildStep validates a recorded step and returns the step replaying it
+// with the compiler goc, with the name of the binary of compilation steps.
+// Only the commands generated by the builder with the flags and env variables
+// allowed by the policy are replayed so that a provenance cannot run
+// arbitrary commands.
+func rebuildStep(s step, setup bool, goc string, p *Policy) (*runner.CommandStep, string, error) {
+	if len(s.Command) < 2 {
+		return nil, "", fmt.Errorf("%w: invalid command %q", &errInvalidStep{}, s.Command)
+	}
+	args := s.Command[1:]
+
+	if setup {
+		if !isSetupCommand(args) {
+			return nil, "", fmt.Errorf("%w: expected vendoring or download command, got %q", &errInvalidStep{}, s.Command)
+		}
+		for _, e := range s.Env {
+			if err := p.checkEnv(e); err != nil {
+				return nil, "", fmt.Errorf("%w: %v", &errEnvVariableNameNotAllowed{}, err)
+			}
+		}
+		return &runner.CommandStep{
+			Command: append([]string{goc}, args...),
+			Env:     s.Env,
+		}, "", nil
+	}
+
+	if args[0] != "build" {
+		return nil, "", fmt.Errorf("%w: expected compilation command, got %q", &errInvalidStep{}, s.Command)
+	}
+	var binary string
+	for i, arg := range args[1:] {
+		switch {
+		case arg == "-o":
+			if i+2 >= len(args) {
+				return nil, "", fmt.Errorf("%w: no value for -o", &errInvalidStep{})
+			}
+			binary = args[i+2]
+			if err := validatePath(binary); err != nil {
+				return nil, "", fmt.Errorf("%w: %v", &errInvalidStep{}, err)
+			}
+		case arg == "-mod="+ModVendor || arg == "-mod="+ModReadonly:
+			// Set by the builder.
+		case strings.HasPrefix(arg, "-"):
+			if err := p.checkFlag(arg); err != nil {
+				return nil, "", fmt.Errorf("%w: %v", &errUnsupportedArguments{}, err)
+			}
+		}
+	}
+	if binary == "" {
+		return nil, "", fmt.Errorf("%w: no output binary in %q", &errInvalidStep{}, s.Command)
+	}
+
+	for _, e := range s.Env {
+		if err := p.checkEnv(e); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", &errEnvVariableNameNotAllowed{}, err)
+		}
+	}
+
+	return &runner.CommandStep{
+		Command: append([]string{goc}, args...),
+		Env:     s.Env,
+	}, binary, nil
+}
+
+func isSetupCommand(args []string) bool {
+	for _, c := range setupCommands {
+		if len(c) != len(args) {
+			continue
+		}
+		equal := true
+		for i := range c {
+			equal = equal && c[i] == args[i]
+		}
+		if equal {
+			return true
+		}
+	}
+	return false
+}
+
+// findSubject returns the subject with the given name.
+func findSubject(subjects []intoto.Subject, name string) (*intoto.Subject, error) {
+	for i := range subjects {
+		if subjects[i].Name == name {
+			return &subjects[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no subject for binary %q", &errInvalidProvenance{}, name)
+}
+
+// remarshal converts the decoded JSON value v to out.
+func remarshal(v, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func computeSHA256(path string) (string, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,692 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/runner"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/bundle"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+	"github.com/slsa-framework/slsa-github-generator/signing/local"
+)
+
+const testWorkspace = "/home/runner/work/repo/repo"
+
+func testProvenance(commit string, steps []step, subjects ...intoto.Subject) *intoto.ProvenanceStatement {
+	return &intoto.ProvenanceStatement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: slsa02.PredicateSLSAProvenance,
+			Subject:       subjects,
+		},
+		Predicate: slsa02.ProvenancePredicate{
+			BuildType: buildType,
+			Invocation: slsa02.ProvenanceInvocation{
+				ConfigSource: slsa02.ConfigSource{
+					URI:    "git+https://github.com/org/repo@refs/tags/v1.2.3",
+					Digest: slsacommon.DigestSet{"sha1": commit},
+				},
+			},
+			BuildConfig: buildConfig{
+				Version: buildConfigVersion,
+				Steps:   steps,
+			},
+		},
+	}
+}
+
+func TestParseProvenance(t *testing.T) {
+	t.Parallel()
+
+	statement, err := json.Marshal(testProvenance("abc", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := base64.StdEncoding.EncodeToString(statement)
+
+	tests := []struct {
+		name    string
+		att     string
+		wantErr bool
+	}{
+		{
+			name: "statement",
+			att:  string(statement),
+		},
+		{
+			name: "dsse envelope",
+			att:  `{"payloadType":"application/vnd.in-toto+json","payload":"` + payload + `","signatures":[]}`,
+		},
+		{
+			name: "bundle",
+			att:  `{"mediaType":"application/vnd.dev.sigstore.bundle+json;version=0.1","dsseEnvelope":{"payload":"` + payload + `"}}`,
+		},
+		{
+			name:    "invalid payload",
+			att:     `{"payloadType":"application/vnd.in-toto+json","payload":"%%%"}`,
+			wantErr: true,
+		},
+		{
+			name:    "other build type",
+			att:     `{"predicate":{"buildType":"https://example.com/other"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			att:     "garbage",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := ParseProvenance([]byte(tt.att))
+			if tt.wantErr {
+				var errProvenance *errInvalidProvenance
+				if !errors.As(err, &errProvenance) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, want := p.Predicate.Invocation.ConfigSource.Digest["sha1"], "abc"; got != want {
+				t.Errorf("unexpected source digest, got: %q, want: %q", got, want)
+			}
+		})
+	}
+}
+
+func Test_rebuildDir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		workingDir string
+		expected   string
+		wantErr    bool
+	}{
+		{
+			name:       "workspace",
+			workingDir: testWorkspace,
+			expected:   "/checkout",
+		},
+		{
+			name:       "sub-directory",
+			workingDir: testWorkspace + "/cmd/tool",
+			expected:   "/checkout/cmd/tool",
+		},
+		{
+			name:       "repository directory in workspace",
+			workingDir: testWorkspace + "/repo/repo/sub",
+			expected:   "/checkout/sub",
+		},
+		{
+			name:       "outside workspace",
+			workingDir: "/home/runner/work/other/other",
+			wantErr:    true,
+		},
+		{
+			name:       "prefix of repository name",
+			workingDir: "/home/runner/work/repo/repository",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir, err := rebuildDir("/checkout", tt.workingDir, "repo")
+			if tt.wantErr {
+				var errStep *errInvalidStep
+				if !errors.As(err, &errStep) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dir != tt.expected {
+				t.Errorf(cmp.Diff(tt.expected, dir))
+			}
+		})
+	}
+}
+
+func Test_rebuildStep(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		step     step
+		setup    bool
+		expected *runner.CommandStep
+		binary   string
+		err      func(*testing.T, error)
+	}{
+		{
+			name:     "vendoring",
+			step:     step{Command: []string{"/opt/go/bin/go", "mod", "vendor"}},
+			setup:    true,
+			expected: &runner.CommandStep{Command: []string{"go", "mod", "vendor"}},
+		},
+		{
+			name:     "workspace vendoring",
+			step:     step{Command: []string{"/opt/go/bin/go", "work", "vendor"}},
+			setup:    true,
+			expected: &runner.CommandStep{Command: []string{"go", "work", "vendor"}},
+		},
+		{
+			name: "download",
+			step: step{
+				Command: []string{"/opt/go/bin/go", "mod", "download", "-json"},
+				Env:     []string{"GOPROXY=https://proxy.example.com"},
+			},
+			setup: true,
+			expected: &runner.CommandStep{
+				Command: []string{"go", "mod", "download", "-json"},
+				Env:     []string{"GOPROXY=https://proxy.example.com"},
+			},
+		},
+		{
+			name:     "verification",
+			step:     step{Command: []string{"/opt/go/bin/go", "mod", "verify"}},
+			setup:    true,
+			expected: &runner.CommandStep{Command: []string{"go", "mod", "verify"}},
+		},
+		{
+			name: "download env variable not allowed",
+			step: step{
+				Command: []string{"/opt/go/bin/go", "mod", "download", "-json"},
+				Env:     []string{"LD_PRELOAD=/tmp/lib.so"},
+			},
+			setup: true,
+			err:   errEnvVariableNameNotAllowedFunc,
+		},
+		{
+			name:  "unexpected download command",
+			step:  step{Command: []string{"/opt/go/bin/go", "mod", "download", "-x"}},
+			setup: true,
+			err:   errInvalidStepFunc,
+		},
+		{
+			name:  "unexpected vendoring command",
+			step:  step{Command: []string{"/opt/go/bin/go", "build", "-o", "binary"}},
+			setup: true,
+			err:   errInvalidStepFunc,
+		},
+		{
+			name: "compilation",
+			step: step{
+				Command: []string{"/opt/go/bin/go", "build", "-mod=vendor", "-trimpath", "-ldflags=-X main.Version=1.2.3", "-o", "binary", "./cmd"},
+				Env:     []string{"GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0"},
+			},
+			expected: &runner.CommandStep{
+				Command: []string{"go", "build", "-mod=vendor", "-trimpath", "-ldflags=-X main.Version=1.2.3", "-o", "binary", "./cmd"},
+				Env:     []string{"GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0"},
+			},
+			binary: "binary",
+		},
+		{
+			name: "readonly compilation",
+			step: step{
+				Command: []string{"/opt/go/bin/go", "build", "-mod=readonly", "-o", "binary"},
+			},
+			expected: &runner.CommandStep{
+				Command: []string{"go", "build", "-mod=readonly", "-o", "binary"},
+			},
+			binary: "binary",
+		},
+		{
+			name: "mod flag not set by the builder",
+			step: step{Command: []string{"go", "build", "-mod=mod", "-o", "binary"}},
+			err:  errUnsupportedArgumentsFunc,
+		},
+		{
+			name: "arbitrary command",
+			step: step{Command: []string{"sh", "-c", "echo"}},
+			err:  errInvalidStepFunc,
+		},
+		{
+			name: "unsupported flag",
+			step: step{Command: []string{"go", "build", "-toolexec=/bin/sh", "-o", "binary"}},
+			err:  errUnsupportedArgumentsFunc,
+		},
+		{
+			name: "env variable not allowed",
+			step: step{
+				Command: []string{"go", "build", "-o", "binary"},
+				Env:     []string{"LD_PRELOAD=/tmp/lib.so"},
+			},
+			err: errEnvVariableNameNotAllowedFunc,
+		},
+		{
+			name: "env variable denied",
+			step: step{
+				Command: []string{"go", "build", "-o", "binary"},
+				Env:     []string{"GOFLAGS=-mod=mod"},
+			},
+			err: errEnvVariableNameNotAllowedFunc,
+		},
+		{
+			name: "no output",
+			step: step{Command: []string{"go", "build"}},
+			err:  errInvalidStepFunc,
+		},
+		{
+			name: "output outside the checkout",
+			step: step{Command: []string{"go", "build", "-o", "../binary"}},
+			err:  errInvalidStepFunc,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, binary, err := rebuildStep(tt.step, tt.setup, "go", DefaultPolicy())
+			if tt.err != nil {
+				tt.err(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, s); diff != "" {
+				t.Errorf("unexpected step (-want +got):\n%s", diff)
+			}
+			if binary != tt.binary {
+				t.Errorf(cmp.Diff(tt.binary, binary))
+			}
+		})
+	}
+}
+
+func errInvalidStepFunc(t *testing.T, got error) {
+	want := &errInvalidStep{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", got)
+	}
+}
+
+// newTestRepository creates a git repository with a Go module and returns
+// its path and the commit.
+func newTestRepository(t *testing.T) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not found: %v", err)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":            "module example.com/hello\n\ngo 1.19\n",
+		"cmd/hello/main.go": "package main\n\nvar version string\n\nfunc main() { println(version) }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "hello")
+	return dir, git("rev-parse", "HEAD")
+}
+
+func TestRebuild(t *testing.T) {
+	t.Parallel()
+
+	goc, err := exec.LookPath("go")
+	if err != nil {
+		t.Fatalf("exec.LookPath: %v", err)
+	}
+	repo, commit := newTestRepository(t)
+
+	steps := []step{
+		{
+			Command:    []string{"/opt/hostedtoolcache/go/bin/go", "mod", "vendor"},
+			WorkingDir: testWorkspace,
+		},
+		{
+			Command: []string{
+				"/opt/hostedtoolcache/go/bin/go", "build", "-mod=vendor", "-trimpath",
+				"-ldflags=-X main.version=1.2.3", "-o", "hello", "./cmd/hello",
+			},
+			Env:        []string{"GOOS=" + runtime.GOOS, "GOARCH=" + runtime.GOARCH, "CGO_ENABLED=0"},
+			WorkingDir: testWorkspace,
+		},
+	}
+	rebuild := func(digest string) *RebuildReport {
+		p := testProvenance(commit, steps, intoto.Subject{
+			Name:   "hello",
+			Digest: slsacommon.DigestSet{"sha256": digest},
+		})
+		report, err := Rebuild(context.Background(), p, &RebuildOptions{
+			Goc:        goc,
+			Dir:        t.TempDir(),
+			Repository: repo,
+			Stdout:     io.Discard,
+			Stderr:     io.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Rebuild: %v", err)
+		}
+		if got, want := len(report.Subjects), 1; got != want {
+			t.Fatalf("unexpected number of subjects, got: %d, want: %d", got, want)
+		}
+		return report
+	}
+
+	// The first build has an unexpected digest.
+	report := rebuild(strings.Repeat("0", 64))
+	if report.Reproduced() {
+		t.Fatalf("expected a mismatch")
+	}
+	digest := report.Subjects[0].RebuildDigest
+	diff := report.Diff()
+	if diff == nil || len(diff.Subjects) != 1 {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+	if got := diff.Subjects[0].Digest; got.Actual != digest {
+		t.Errorf("unexpected digest diff: %+v", got)
+	}
+	wantCommand := append([]string{goc}, steps[1].Command[1:]...)
+	if got := diff.Subjects[0].Command; !cmp.Equal(got.Expected, steps[1].Command) || !cmp.Equal(got.Actual, wantCommand) {
+		t.Errorf("unexpected command diff: %+v", got)
+	}
+	if got := diff.Subjects[0].Env; !cmp.Equal(got.Expected, steps[1].Env) || !cmp.Equal(got.Actual, steps[1].Env) {
+		t.Errorf("unexpected env diff: %+v", got)
+	}
+
+	// A second build in another directory reproduces the binary.
+	report = rebuild(digest)
+	if !report.Reproduced() {
+		t.Errorf("binary not reproduced: %+v", report.Diff())
+	}
+	if diff := report.Diff(); diff != nil {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+}
+
+func TestRebuildReport_Diff(t *testing.T) {
+	t.Parallel()
+
+	r := &RebuildReport{
+		Subjects: []SubjectRebuild{
+			{Name: "same", Digest: "aaaa", RebuildDigest: "AAAA"},
+			{
+				Name:           "different",
+				Digest:         "aaaa",
+				RebuildDigest:  "bbbb",
+				Command:        []string{"/opt/go/bin/go", "build", "-o", "different"},
+				Env:            []string{"GOOS=linux"},
+				RebuildCommand: []string{"/usr/bin/go", "build", "-o", "different"},
+				RebuildEnv:     []string{"GOOS=linux"},
+			},
+		},
+		Toolchain:        "go1.19.5",
+		RebuildToolchain: "go1.20",
+	}
+	want := `{
+  "subjects": [
+    {
+      "name": "different",
+      "digest": {
+        "expected": "aaaa",
+        "actual": "bbbb"
+      },
+      "command": {
+        "expected": [
+          "/opt/go/bin/go",
+          "build",
+          "-o",
+          "different"
+        ],
+        "actual": [
+          "/usr/bin/go",
+          "build",
+          "-o",
+          "different"
+        ]
+      },
+      "env": {
+        "expected": [
+          "GOOS=linux"
+        ],
+        "actual": [
+          "GOOS=linux"
+        ]
+      }
+    }
+  ],
+  "toolchain": {
+    "expected": "go1.19.5",
+    "actual": "go1.20"
+  }
+}`
+	got, err := json.MarshalIndent(r.Diff(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n%s", diff)
+	}
+
+	// There is no diff if all the binaries are reproduced.
+	r.Subjects = r.Subjects[:1]
+	if d := r.Diff(); d != nil {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+}
+
+// testBuilderID is the builder ID of the provenances signed in tests.
+const testBuilderID = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/builder_go_slsa3.yml@refs/tags/v1.5.0"
+
+// newTestCA returns a self-signed root certificate and its key.
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, key
+}
+
+// signTestProvenance signs p with a certificate of the CA for the identity
+// builderID.
+func signTestProvenance(t *testing.T, root *x509.Certificate, rootKey *ecdsa.PrivateKey, builderID string,
+	p *intoto.ProvenanceStatement,
+) signing.Attestation {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{mustParseURL(t, builderID)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := local.NewKeySigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = s.WithCert(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})); err != nil {
+		t.Fatal(err)
+	}
+	att, err := s.Sign(context.Background(), &intoto.Statement{
+		StatementHeader: p.StatementHeader,
+		Predicate:       p.Predicate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return att
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestVerifyProvenance(t *testing.T) {
+	t.Parallel()
+
+	root, rootKey := newTestCA(t)
+	otherRoot, _ := newTestCA(t)
+	p := testProvenance("abc", nil)
+	p.Predicate.Builder.ID = testBuilderID
+
+	signed := signTestProvenance(t, root, rootKey, testBuilderID, p)
+	b, err := bundle.New(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBundle, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		att     []byte
+		roots   []*x509.Certificate
+		wantErr bool
+	}{
+		{
+			name:  "dsse envelope",
+			att:   signed.Bytes(),
+			roots: []*x509.Certificate{root},
+		},
+		{
+			name:  "bundle",
+			att:   signedBundle,
+			roots: []*x509.Certificate{root},
+		},
+		{
+			name:    "untrusted certificate",
+			att:     signed.Bytes(),
+			roots:   []*x509.Certificate{otherRoot},
+			wantErr: true,
+		},
+		{
+			name:    "other builder",
+			att:     signTestProvenance(t, root, rootKey, "https://github.com/org/repo/.github/workflows/release.yml@refs/tags/v1.2.3", p).Bytes(),
+			roots:   []*x509.Certificate{root},
+			wantErr: true,
+		},
+		{
+			name:    "unsigned statement",
+			att:     statement,
+			roots:   []*x509.Certificate{root},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := VerifyProvenance(tt.att, &envelope.VerifyOptions{Roots: tt.roots})
+			if tt.wantErr {
+				var errProvenance *errInvalidProvenance
+				if !errors.As(err, &errProvenance) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Predicate.Builder.ID != testBuilderID {
+				t.Errorf("unexpected builder ID: %q", got.Predicate.Builder.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+const (
+	// SBOMFormatSPDX is the SPDX 2.3 JSON format.
+	SBOMFormatSPDX = "spdx"
+
+	// SBOMFormatCycloneDX is the CycloneDX 1.4 JSON format.
+	SBOMFormatCycloneDX = "cyclonedx"
+)
+
+// sbomExtensions are the file extensions of the SBOM formats.
+var sbomExtensions = map[string]string{
+	SBOMFormatSPDX:      "spdx.json",
+	SBOMFormatCycloneDX: "cdx.json",
+}
+
+// sbomTool is the tool recorded as the creator of the SBOMs.
+const sbomTool = "slsa-github-generator"
+
+// ErrInvalidSBOM indicates an SBOM that cannot be generated.
+type ErrInvalidSBOM struct {
+	errors.WrappableError
+}
+
+// ParseSBOMFormats parses a comma-separated list of SBOM formats.
+func ParseSBOMFormats(s string) ([]string, error) {
+	var formats []string
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if _, ok := sbomExtensions[f]; !ok {
+			return nil, errors.Errorf(&ErrInvalidSBOM{}, "unsupported SBOM format %q", f)
+		}
+		if seen[f] {
+			return nil, errors.Errorf(&ErrInvalidSBOM{}, "duplicate SBOM format %q", f)
+		}
+		seen[f] = true
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// sbomComponent is a Go module linked in a binary.
+type sbomComponent struct {
+	path    string
+	version string
+
+	// sha256 is the hex-encoded hash of the module from go.sum. It is empty
+	// if unknown.
+	sha256 string
+}
+
+// purl returns the package URL of the module.
+func (c *sbomComponent) purl() string {
+	if c.version == "" {
+		return "pkg:golang/" + c.path
+	}
+	return fmt.Sprintf("pkg:golang/%s@%s", c.path, c.version)
+}
+
+// sbomBinary is the content of the SBOM of a binary.
+type sbomBinary struct {
+	name      string
+	digest    string
+	goVersion string
+	main      sbomComponent
+	deps      []sbomComponent
+	created   time.Time
+}
+
+// GenerateSBOMs writes the SBOMs of the binaries of the targets in dir, in
+// each of the formats. The binaries are read from dir and must match the
+// digests of the targets. The components of the SBOMs are the modules in the
+// build info embedded in the binaries, with the hashes of the module
+// materials for vendored modules, whose hashes are not embedded.
+func GenerateSBOMs(targets []Target, dir string, materials []slsacommon.ProvenanceMaterial,
+	formats []string, created time.Time,
+) ([]Artifact, error) {
+	// hashes are the go.sum hashes of the module materials by URI.
+	hashes := make(map[string]string)
+	for _, m := range materials {
+		if h, ok := m.Digest[dirHashAlgorithm]; ok {
+			hashes[m.URI] = h
+		}
+	}
+
+	var artifacts []Artifact
+	for _, t := range targets {
+		b, err := readSBOMBinary(dir, t, hashes)
+		if err != nil {
+			return nil, err
+		}
+		b.created = created.UTC()
+
+		for _, format := range formats {
+			var content []byte
+			switch format {
+			case SBOMFormatSPDX:
+				content, err = b.spdx()
+			case SBOMFormatCycloneDX:
+				content, err = b.cycloneDX()
+			default:
+				err = errors.Errorf(&ErrInvalidSBOM{}, "unsupported SBOM format %q", format)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			name := fmt.Sprintf("%s.%s", t.Binary, sbomExtensions[format])
+			if err := validatePath(name); err != nil {
+				return nil, errors.Errorf(&ErrInvalidSBOM{}, "invalid SBOM name %q", name)
+			}
+			a, err := writeArtifact(dir, name, content)
+			if err != nil {
+				return nil, err
+			}
+			artifacts = append(artifacts, a)
+		}
+	}
+	return artifacts, nil
+}
+
+// readSBOMBinary reads the build info of the binary of the target in dir.
+func readSBOMBinary(dir string, t Target, hashes map[string]string) (*sbomBinary, error) {
+	path := filepath.Join(dir, t.Binary)
+	digest, err := computeSHA256(path)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidSBOM{}, "binary %q: %v", t.Binary, err)
+	}
+	if digest != t.Digest {
+		return nil, errors.Errorf(&ErrInvalidSBOM{}, "binary %q: digest mismatch, got: %s, want: %s",
+			t.Binary, digest, t.Digest)
+	}
+
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidSBOM{}, "binary %q: %v", t.Binary, err)
+	}
+	return newSBOMBinary(t.Binary, digest, bi, hashes), nil
+}
+
+// newSBOMBinary returns the SBOM content of the binary with the build info.
+// The hashes of the modules not in the build info are looked up in hashes by
+// package URL.
+func newSBOMBinary(name, digest string, bi *debug.BuildInfo, hashes map[string]string) *sbomBinary {
+	b := &sbomBinary{
+		name:      name,
+		digest:    digest,
+		goVersion: bi.GoVersion,
+		main:      sbomComponent{path: bi.Main.Path},
+	}
+	// Note: binaries built from the main module have a `(devel)` version.
+	if bi.Main.Version != "(devel)" {
+		b.main.version = bi.Main.Version
+	}
+
+	for _, d := range bi.Deps {
+		// The replacement of a module is the module that is linked.
+		sum := d.Sum
+		if d.Replace != nil {
+			d = d.Replace
+			sum = d.Sum
+		}
+		c := sbomComponent{path: d.Path, version: d.Version}
+		if sum == "" {
+			// Vendored modules have no sums in the build info.
+			sum = hashes[c.purl()]
+		}
+		c.sha256 = moduleHashHex(sum)
+		b.deps = append(b.deps, c)
+	}
+	return b
+}
+
+// moduleHashHex returns the hex encoding of the sha256 hash of a go.sum hash,
+// e.g. h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8=. It returns an empty
+// string if the hash is not a valid `h1:` hash.
+func moduleHashHex(sum string) string {
+	if !strings.HasPrefix(sum, "h1:") {
+		return ""
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sum, "h1:"))
+	if err != nil || len(b) != sha256.Size {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// stdlib returns the component of the Go standard library.
+func (b *sbomBinary) stdlib() sbomComponent {
+	return sbomComponent{path: "stdlib", version: b.goVersion}
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdx returns the SBOM in the SPDX 2.3 JSON format.
+func (b *sbomBinary) spdx() ([]byte, error) {
+	const binaryID = "SPDXRef-Binary"
+	doc := spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        b.name,
+		// Note: the namespace is unique for each binary.
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", b.name, b.digest),
+		CreationInfo: spdxCreationInfo{
+			Created:  b.created.Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomTool},
+		},
+		Packages: []spdxPackage{
+			{
+				SPDXID:                binaryID,
+				Name:                  b.name,
+				DownloadLocation:      "NOASSERTION",
+				PrimaryPackagePurpose: "APPLICATION",
+				Checksums:             []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: b.digest}},
+			},
+		},
+		Relationships: []spdxRelationship{
+			{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: binaryID},
+		},
+	}
+
+	add := func(c sbomComponent, relationship string) {
+		id := fmt.Sprintf("SPDXRef-Package-%d", len(doc.Packages))
+		p := spdxPackage{
+			SPDXID:           id,
+			Name:             c.path,
+			VersionInfo:      c.version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{
+				{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: c.purl()},
+			},
+		}
+		if c.sha256 != "" {
+			p.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: c.sha256}}
+		}
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID: binaryID, RelationshipType: relationship, RelatedSPDXElement: id,
+		})
+	}
+	add(b.main, "GENERATED_FROM")
+	add(b.stdlib(), "DEPENDS_ON")
+	for _, d := range b.deps {
+		add(d, "DEPENDS_ON")
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Name string `json:"name"`
+}
+
+type cdxComponent struct {
+	BOMRef  string    `json:"bom-ref"`
+	Type    string    `json:"type"`
+	Name    string    `json:"name"`
+	Version string    `json:"version,omitempty"`
+	PURL    string    `json:"purl,omitempty"`
+	Hashes  []cdxHash `json:"hashes,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// cycloneDX returns the SBOM in the CycloneDX 1.4 JSON format.
+func (b *sbomBinary) cycloneDX() ([]byte, error) {
+	binaryRef := "binary:" + b.name
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + digestUUID(b.digest),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: b.created.Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: sbomTool}},
+			Component: cdxComponent{
+				BOMRef: binaryRef,
+				Type:   "application",
+				Name:   b.name,
+				Hashes: []cdxHash{{Alg: "SHA-256", Content: b.digest}},
+			},
+		},
+	}
+
+	dependency := cdxDependency{Ref: binaryRef, DependsOn: []string{}}
+	seen := make(map[string]bool)
+	for _, c := range append([]sbomComponent{b.main, b.stdlib()}, b.deps...) {
+		purl := c.purl()
+		// Note: references must be unique.
+		if seen[purl] {
+			continue
+		}
+		seen[purl] = true
+
+		comp := cdxComponent{
+			BOMRef:  purl,
+			Type:    "library",
+			Name:    c.path,
+			Version: c.version,
+			PURL:    purl,
+		}
+		if c.sha256 != "" {
+			comp.Hashes = []cdxHash{{Alg: "SHA-256", Content: c.sha256}}
+		}
+		doc.Components = append(doc.Components, comp)
+		dependency.DependsOn = append(dependency.DependsOn, purl)
+	}
+	doc.Dependencies = []cdxDependency{dependency}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// digestUUID returns a UUID derived from the digest of a binary, so that the
+// serial number of its SBOM is stable.
+func digestUUID(digest string) string {
+	h := sha256.Sum256([]byte(digest))
+	u := h[:16]
+	// Version 8 (custom) and RFC 4122 variant.
+	u[6] = (u[6] & 0x0f) | 0x80
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,323 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+)
+
+const testModuleHash = "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8="
+
+var testBuildInfo = &debug.BuildInfo{
+	GoVersion: "go1.19.5",
+	Main:      debug.Module{Path: "example.com/hello", Version: "(devel)"},
+	Deps: []*debug.Module{
+		{Path: "example.com/sum", Version: "v1.0.0", Sum: testModuleHash},
+		{Path: "example.com/vendored", Version: "v1.1.0"},
+		{
+			Path: "example.com/replaced", Version: "v1.2.0",
+			Replace: &debug.Module{Path: "example.com/fork", Version: "v1.2.1"},
+		},
+	},
+}
+
+func TestParseSBOMFormats(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		formats  string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "spdx",
+			formats:  "spdx",
+			expected: []string{SBOMFormatSPDX},
+		},
+		{
+			name:     "all formats",
+			formats:  "cyclonedx, spdx",
+			expected: []string{SBOMFormatCycloneDX, SBOMFormatSPDX},
+		},
+		{
+			name:    "unsupported format",
+			formats: "spdx,syft",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate format",
+			formats: "spdx,spdx",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			formats: "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			formats, err := ParseSBOMFormats(tt.formats)
+			if tt.wantErr {
+				var errSBOM *ErrInvalidSBOM
+				if !errors.As(err, &errSBOM) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, formats); diff != "" {
+				t.Errorf("unexpected formats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_moduleHashHex(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		sum      string
+		expected string
+	}{
+		{
+			name:     "h1 hash",
+			sum:      testModuleHash,
+			expected: "2d462ea5278dad33421b347f855064d8d1d93b8857715696d64e10c7bae33f1f",
+		},
+		{
+			name: "empty",
+		},
+		{
+			name: "other algorithm",
+			sum:  "h2:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8=",
+		},
+		{
+			name: "invalid base64",
+			sum:  "h1:???",
+		},
+		{
+			name: "invalid length",
+			sum:  "h1:YWJj",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := moduleHashHex(tt.sum); got != tt.expected {
+				t.Errorf("unexpected hash, got: %q, want: %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_newSBOMBinary(t *testing.T) {
+	t.Parallel()
+
+	hashes := map[string]string{
+		"pkg:golang/example.com/vendored@v1.1.0": testModuleHash,
+	}
+	b := newSBOMBinary("binary", "abc", testBuildInfo, hashes)
+
+	want := &sbomBinary{
+		name:      "binary",
+		digest:    "abc",
+		goVersion: "go1.19.5",
+		main:      sbomComponent{path: "example.com/hello"},
+		deps: []sbomComponent{
+			{path: "example.com/sum", version: "v1.0.0", sha256: moduleHashHex(testModuleHash)},
+			// The hash of vendored modules is the one of the materials.
+			{path: "example.com/vendored", version: "v1.1.0", sha256: moduleHashHex(testModuleHash)},
+			// Replaced modules are recorded as their replacement.
+			{path: "example.com/fork", version: "v1.2.1"},
+		},
+	}
+	if diff := cmp.Diff(want, b, cmp.AllowUnexported(sbomBinary{}, sbomComponent{})); diff != "" {
+		t.Errorf("unexpected binary (-want +got):\n%s", diff)
+	}
+}
+
+func Test_sbomBinary_spdx(t *testing.T) {
+	t.Parallel()
+
+	b := newSBOMBinary("binary", "abc", testBuildInfo, nil)
+	b.created = time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	content, err := b.spdx()
+	if err != nil {
+		t.Fatalf("spdx: %v", err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" || doc.CreationInfo.Created != "2023-03-01T12:00:00Z" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+
+	var purls []string
+	for _, p := range doc.Packages[1:] {
+		purls = append(purls, p.ExternalRefs[0].ReferenceLocator)
+	}
+	wantPurls := []string{
+		"pkg:golang/example.com/hello",
+		"pkg:golang/stdlib@go1.19.5",
+		"pkg:golang/example.com/sum@v1.0.0",
+		"pkg:golang/example.com/vendored@v1.1.0",
+		"pkg:golang/example.com/fork@v1.2.1",
+	}
+	if diff := cmp.Diff(wantPurls, purls); diff != "" {
+		t.Errorf("unexpected packages (-want +got):\n%s", diff)
+	}
+
+	wantBinary := spdxPackage{
+		SPDXID:                "SPDXRef-Binary",
+		Name:                  "binary",
+		DownloadLocation:      "NOASSERTION",
+		PrimaryPackagePurpose: "APPLICATION",
+		Checksums:             []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: "abc"}},
+	}
+	if diff := cmp.Diff(wantBinary, doc.Packages[0]); diff != "" {
+		t.Errorf("unexpected binary package (-want +got):\n%s", diff)
+	}
+
+	// The binary is described by the document and generated from the main
+	// module.
+	wantRelationships := []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Binary"},
+		{SPDXElementID: "SPDXRef-Binary", RelationshipType: "GENERATED_FROM", RelatedSPDXElement: "SPDXRef-Package-1"},
+	}
+	if diff := cmp.Diff(wantRelationships, doc.Relationships[:2]); diff != "" {
+		t.Errorf("unexpected relationships (-want +got):\n%s", diff)
+	}
+}
+
+func Test_sbomBinary_cycloneDX(t *testing.T) {
+	t.Parallel()
+
+	b := newSBOMBinary("binary", "abc", testBuildInfo, nil)
+	content, err := b.cycloneDX()
+	if err != nil {
+		t.Fatalf("cycloneDX: %v", err)
+	}
+
+	var doc cdxDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.BOMFormat != "CycloneDX" || doc.SpecVersion != "1.4" || doc.SerialNumber != "urn:uuid:"+digestUUID("abc") {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+
+	wantComponent := cdxComponent{
+		BOMRef:  "pkg:golang/example.com/sum@v1.0.0",
+		Type:    "library",
+		Name:    "example.com/sum",
+		Version: "v1.0.0",
+		PURL:    "pkg:golang/example.com/sum@v1.0.0",
+		Hashes:  []cdxHash{{Alg: "SHA-256", Content: moduleHashHex(testModuleHash)}},
+	}
+	if diff := cmp.Diff(wantComponent, doc.Components[2]); diff != "" {
+		t.Errorf("unexpected component (-want +got):\n%s", diff)
+	}
+
+	if len(doc.Dependencies) != 1 || len(doc.Dependencies[0].DependsOn) != len(doc.Components) {
+		t.Errorf("unexpected dependencies: %+v", doc.Dependencies)
+	}
+}
+
+func Test_digestUUID(t *testing.T) {
+	t.Parallel()
+
+	u := digestUUID("abc")
+	if len(u) != 36 || u[14] != '8' {
+		t.Errorf("unexpected UUID: %q", u)
+	}
+	if u != digestUUID("abc") || u == digestUUID("abd") {
+		t.Errorf("UUID is not derived from the digest: %q", u)
+	}
+}
+
+func TestGenerateSBOMs(t *testing.T) {
+	t.Parallel()
+
+	// The test binary has build info.
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "binary-linux-amd64"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := computeSHA256(filepath.Join(dir, "binary-linux-amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := []Target{{Binary: "binary-linux-amd64", Digest: digest}}
+	materials := []slsacommon.ProvenanceMaterial{{URI: toolchainURIPrefix + "go1.19.5"}}
+	artifacts, err := GenerateSBOMs(targets, dir, materials,
+		[]string{SBOMFormatSPDX, SBOMFormatCycloneDX}, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateSBOMs: %v", err)
+	}
+
+	var names []string
+	for _, a := range artifacts {
+		got, err := computeSHA256(filepath.Join(dir, a.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != a.Digest {
+			t.Errorf("unexpected digest for %q, got: %q, want: %q", a.Name, a.Digest, got)
+		}
+		names = append(names, a.Name)
+	}
+	want := []string{"binary-linux-amd64.spdx.json", "binary-linux-amd64.cdx.json"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("unexpected SBOMs (-want +got):\n%s", diff)
+	}
+
+	// The binary must match the digest of the target.
+	targets[0].Digest = "2e0390eb024a52963db7b95e84a9c2b12c004054a7bad9a97ec0c7c89d4681d2"
+	_, err = GenerateSBOMs(targets, dir, materials, []string{SBOMFormatSPDX}, time.Now())
+	var errSBOM *ErrInvalidSBOM
+	if !errors.As(err, &errSBOM) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
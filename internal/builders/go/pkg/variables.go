@@ -0,0 +1,199 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var unknownTag = "unknown"
+
+// shortCommitLength is the length of {{ .ShortCommit }}, the default length
+// of abbreviated commit hashes in git.
+const shortCommitLength = 7
+
+// reSemver matches semantic versions with an optional `v` prefix.
+var reSemver = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:[-+].*)?$`)
+
+// variable returns the value of the template variable name, e.g. `Os` for
+// `{{ .Os }}`. The variables are compatible with the goreleaser ones. The
+// value is recorded in the variables of the build.
+func (b *GoBuild) variable(name string) (string, error) {
+	var value string
+	var err error
+	switch name {
+	case "Os":
+		if b.cfg.Goos == "" {
+			return "", fmt.Errorf("%w: {{ .Os }}", &errEnvVariableNameEmpty{})
+		}
+		value = b.cfg.Goos
+
+	case "Arch":
+		if b.cfg.Goarch == "" {
+			return "", fmt.Errorf("%w: {{ .Arch }}", &errEnvVariableNameEmpty{})
+		}
+		value = b.cfg.Goarch
+
+	case "Tag":
+		value = getTag()
+
+	case "Version":
+		// The tag without its `v` prefix.
+		value = strings.TrimPrefix(getTag(), "v")
+
+	case "Major", "Minor", "Patch":
+		value, err = getSemverPart(getTag(), name)
+
+	case "Commit", "FullCommit":
+		value, err = b.getCommit()
+
+	case "ShortCommit":
+		value, err = b.getCommit()
+		if len(value) > shortCommitLength {
+			value = value[:shortCommitLength]
+		}
+
+	case "Date":
+		// NOTE: the date of the build is not reproducible, use
+		// {{ .CommitDate }} instead for reproducible builds.
+		value = b.Date().Format(time.RFC3339)
+
+	case "CommitDate":
+		var t time.Time
+		t, err = b.getCommitTime()
+		value = t.UTC().Format(time.RFC3339)
+
+	case "CommitTimestamp":
+		var t time.Time
+		t, err = b.getCommitTime()
+		value = strconv.FormatInt(t.Unix(), 10)
+
+	case "ProjectName":
+		value, err = getProjectName()
+
+	default:
+		return "", fmt.Errorf("%w: {{ .%s }}", &errInvalidEnvArgument{}, name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if b.variables == nil {
+		b.variables = make(map[string]string)
+	}
+	b.variables[name] = value
+	return value, nil
+}
+
+// Date returns the date of the build, used by {{ .Date }}. It is the date
+// set with SetDate, or the current date the first time it is called.
+func (b *GoBuild) Date() time.Time {
+	if b.date.IsZero() {
+		b.date = time.Now().UTC().Truncate(time.Second)
+	}
+	return b.date
+}
+
+// SetDate sets the date of the build, so that the build resolves
+// {{ .Date }} to the date of its dry run.
+func (b *GoBuild) SetDate(t time.Time) {
+	b.date = t.UTC()
+}
+
+func getTag() string {
+	tag := os.Getenv("GITHUB_REF_NAME")
+	if tag == "" {
+		return unknownTag
+	}
+	return tag
+}
+
+// getSemverPart returns the major, minor or patch version of the semantic
+// version in tag.
+func getSemverPart(tag, part string) (string, error) {
+	m := reSemver.FindStringSubmatch(tag)
+	if m == nil {
+		return "", fmt.Errorf("%w: %q is not a semantic version", &errInvalidTag{}, tag)
+	}
+	switch part {
+	case "Major":
+		return m[1], nil
+	case "Minor":
+		return m[2], nil
+	default:
+		return m[3], nil
+	}
+}
+
+// getCommit returns the commit being built, from the GitHub workflow
+// environment or from the repository if not set.
+func (b *GoBuild) getCommit() (string, error) {
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha, nil
+	}
+	return b.git("rev-parse", "HEAD")
+}
+
+// getCommitTime returns the committer time of the commit being built.
+func (b *GoBuild) getCommitTime() (time.Time, error) {
+	commit, err := b.getCommit()
+	if err != nil {
+		return time.Time{}, err
+	}
+	out, err := b.git("log", "-1", "--format=%ct", commit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing commit time %q: %w", out, err)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// git runs a git command in the directory of the build and returns its
+// trimmed output.
+func (b *GoBuild) git(args ...string) (string, error) {
+	dir, err := b.getDir()
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// getProjectName returns the name of the repository being built.
+func getProjectName() (string, error) {
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	if repo == "" {
+		return "", fmt.Errorf("%w: {{ .ProjectName }}", &errEnvVariableNameEmpty{})
+	}
+	_, name, found := strings.Cut(repo, "/")
+	if !found {
+		return repo, nil
+	}
+	return name, nil
+}
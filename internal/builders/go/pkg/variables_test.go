@@ -0,0 +1,172 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func errInvalidTagFunc(t *testing.T, got error) {
+	want := &errInvalidTag{}
+	if !errors.As(got, &want) {
+		t.Fatalf("unexpected error: %v", got)
+	}
+}
+
+func Test_resolveSpecialVariables(t *testing.T) {
+	// NOTE: t.Setenv does not support parallel tests.
+
+	tests := []struct {
+		name      string
+		value     string
+		githubEnv map[string]string
+		expected  string
+		variables map[string]string
+		err       func(*testing.T, error)
+	}{
+		{
+			name:  "version",
+			value: "{{ .ProjectName }}-{{ .Version }}-{{ .Major }}.{{ .Minor }}.{{ .Patch }}",
+			githubEnv: map[string]string{
+				"GITHUB_REF_NAME":   "v1.2.3-rc.1",
+				"GITHUB_REPOSITORY": "org/project",
+			},
+			expected: "project-1.2.3-rc.1-1.2.3",
+			variables: map[string]string{
+				"ProjectName": "project",
+				"Version":     "1.2.3-rc.1",
+				"Major":       "1",
+				"Minor":       "2",
+				"Patch":       "3",
+			},
+		},
+		{
+			name:  "commit",
+			value: "-X main.Commit={{ .Commit }} -X main.Short={{ .ShortCommit }} -X main.Full={{ .FullCommit }}",
+			githubEnv: map[string]string{
+				"GITHUB_SHA": "b2a980888f359b8cef22cb61f153746e1a06deb0",
+			},
+			expected: "-X main.Commit=b2a980888f359b8cef22cb61f153746e1a06deb0 -X main.Short=b2a9808 " +
+				"-X main.Full=b2a980888f359b8cef22cb61f153746e1a06deb0",
+			variables: map[string]string{
+				"Commit":      "b2a980888f359b8cef22cb61f153746e1a06deb0",
+				"ShortCommit": "b2a9808",
+				"FullCommit":  "b2a980888f359b8cef22cb61f153746e1a06deb0",
+			},
+		},
+		{
+			name:  "tag not a semantic version",
+			value: "{{ .Major }}",
+			githubEnv: map[string]string{
+				"GITHUB_REF_NAME": "main",
+			},
+			err: errInvalidTagFunc,
+		},
+		{
+			name:  "no repository",
+			value: "{{ .ProjectName }}",
+			githubEnv: map[string]string{
+				"GITHUB_REPOSITORY": "",
+			},
+			err: errEnvVariableNameEmptyFunc,
+		},
+		{
+			name:  "unsupported variable",
+			value: "{{ .Unknown }}",
+			err:   errInvalidEnvArgumentFunc,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.githubEnv {
+				t.Setenv(k, v)
+			}
+
+			b := GoBuildNew("go", &GoReleaserConfig{Goos: "linux", Goarch: "amd64"})
+			s, err := b.resolveSpecialVariables(tt.value)
+			if tt.err != nil {
+				tt.err(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s != tt.expected {
+				t.Errorf(cmp.Diff(tt.expected, s))
+			}
+			if diff := cmp.Diff(tt.variables, b.variables); diff != "" {
+				t.Errorf("unexpected variables (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_resolveSpecialVariables_commitDate(t *testing.T) {
+	// Use the commit checked out in this repository.
+	t.Setenv("GITHUB_SHA", "")
+	out, err := exec.Command("git", "log", "-1", "--format=%ct").Output()
+	if err != nil {
+		t.Skipf("git log: %v", err)
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := GoBuildNew("go", &GoReleaserConfig{})
+	s, err := b.resolveSpecialVariables("{{ .CommitDate }} {{ .CommitTimestamp }}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := time.Unix(sec, 0).UTC().Format(time.RFC3339) + " " + strconv.FormatInt(sec, 10)
+	if s != want {
+		t.Errorf(cmp.Diff(want, s))
+	}
+}
+
+func Test_resolveSpecialVariables_date(t *testing.T) {
+	b := GoBuildNew("go", &GoReleaserConfig{})
+	first, err := b.resolveSpecialVariables("{{ .Date }}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := b.resolveSpecialVariables("{{ .Date }}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("date changed between resolutions: %q, %q", first, second)
+	}
+
+	// The build resolves the date of the dry run.
+	date := time.Date(2022, time.June, 13, 1, 30, 0, 0, time.UTC)
+	b = GoBuildNew("go", &GoReleaserConfig{})
+	b.SetDate(date)
+	s, err := b.resolveSpecialVariables("{{ .Date }}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "2022-06-13T01:30:00Z"; s != want {
+		t.Errorf(cmp.Diff(want, s))
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+// ErrInvalidWorkspace indicates an invalid go.work file or an unknown
+// workspace module.
+type ErrInvalidWorkspace struct {
+	errors.WrappableError
+}
+
+// Workspace is a Go workspace defined by a go.work file. The modules of the
+// workspace and their local replacements are built from the source, while
+// the other dependencies are downloaded from the module proxy and are
+// recorded as materials.
+type Workspace struct {
+	// Dir is the directory of the go.work file.
+	Dir string `json:"dir"`
+
+	// Modules are the modules used by the workspace.
+	Modules []WorkspaceModule `json:"modules"`
+
+	// Replacements are the modules replaced by local directories, in the
+	// go.work file or in the go.mod files of the workspace modules.
+	Replacements []WorkspaceModule `json:"replacements,omitempty"`
+}
+
+// WorkspaceModule is a module in a local directory of a workspace.
+type WorkspaceModule struct {
+	// Path is the module path.
+	Path string `json:"path"`
+
+	// Version is the replaced version of a replacement. It is empty if all
+	// versions are replaced.
+	Version string `json:"version,omitempty"`
+
+	// Dir is the directory of the module, relative to the directory of the
+	// workspace.
+	Dir string `json:"dir"`
+}
+
+// module returns the workspace module with the given path.
+func (w *Workspace) module(path string) (*WorkspaceModule, error) {
+	for i := range w.Modules {
+		if w.Modules[i].Path == path {
+			return &w.Modules[i], nil
+		}
+	}
+	return nil, errors.Errorf(&ErrInvalidWorkspace{}, "module %q is not in the workspace", path)
+}
+
+// findWorkspace returns the workspace of the directory dir, i.e. the go.work
+// file in dir or its closest parent directory, like the go command does. The
+// search stops at the root directory, e.g. the root of the repository. It
+// returns nil if there is no go.work file.
+func findWorkspace(dir, root string) (*Workspace, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.work")); err == nil {
+			return loadWorkspace(dir)
+		}
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// loadWorkspace reads the go.work file in dir and the go.mod files of its
+// modules.
+func loadWorkspace(dir string) (*Workspace, error) {
+	path := filepath.Join(dir, "go.work")
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidWorkspace{}, "reading go.work: %v", err)
+	}
+	wf, err := modfile.ParseWork(path, b, nil)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidWorkspace{}, "%v", err)
+	}
+
+	w := &Workspace{Dir: dir}
+	replacements := make(map[WorkspaceModule]bool)
+	addReplacements := func(base string, replace []*modfile.Replace) error {
+		for _, r := range replace {
+			// Note: replacements by a module version are downloaded
+			// from the proxy.
+			if r.New.Version != "" {
+				continue
+			}
+			rdir, err := workspaceDir(filepath.Join(base, r.New.Path))
+			if err != nil {
+				return err
+			}
+			replacements[WorkspaceModule{Path: r.Old.Path, Version: r.Old.Version, Dir: rdir}] = true
+		}
+		return nil
+	}
+
+	if err := addReplacements(".", wf.Replace); err != nil {
+		return nil, err
+	}
+	for _, u := range wf.Use {
+		mdir, err := workspaceDir(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		mf, err := readModFile(filepath.Join(dir, mdir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		w.Modules = append(w.Modules, WorkspaceModule{Path: mf.Module.Mod.Path, Dir: filepath.ToSlash(mdir)})
+		if err := addReplacements(mdir, mf.Replace); err != nil {
+			return nil, err
+		}
+	}
+	if len(w.Modules) == 0 {
+		return nil, errors.Errorf(&ErrInvalidWorkspace{}, "no modules in go.work")
+	}
+
+	for r := range replacements {
+		w.Replacements = append(w.Replacements, r)
+	}
+	sort.Slice(w.Replacements, func(i, j int) bool {
+		if w.Replacements[i].Path != w.Replacements[j].Path {
+			return w.Replacements[i].Path < w.Replacements[j].Path
+		}
+		return w.Replacements[i].Version < w.Replacements[j].Version
+	})
+	return w, nil
+}
+
+// workspaceDir validates the path of a local module relative to the
+// workspace directory. Local modules are part of the source, so they must be
+// in the workspace directory.
+func workspaceDir(path string) (string, error) {
+	p := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf(&ErrInvalidWorkspace{}, "module directory %q is outside the workspace", path)
+	}
+	return filepath.ToSlash(p), nil
+}
+
+// readModFile reads the go.mod file at path.
+func readModFile(path string) (*modfile.File, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidWorkspace{}, "reading go.mod: %v", err)
+	}
+	mf, err := modfile.Parse(path, b, nil)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidWorkspace{}, "%v", err)
+	}
+	if mf.Module == nil {
+		return nil, errors.Errorf(&ErrInvalidWorkspace{}, "%s: no module path", path)
+	}
+	return mf, nil
+}
+
+// sumFiles returns the paths of the go.sum files of the workspace: the
+// go.work.sum file and the go.sum files of its modules.
+func (w *Workspace) sumFiles() []string {
+	files := []string{filepath.Join(w.Dir, "go.work.sum")}
+	for _, m := range w.Modules {
+		files = append(files, filepath.Join(w.Dir, filepath.FromSlash(m.Dir), "go.sum"))
+	}
+	return files
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+)
+
+// writeFiles writes the files with the given content relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeWorkspace writes a workspace with the modules a and lib, where a
+// depends on lib through a local replacement.
+func writeWorkspace(t *testing.T) string {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.work":     "go 1.22\n\nuse (\n\t./a\n\t./lib\n)\n",
+		"go.work.sum": "golang.org/x/net v0.7.0 h1:rJrUqqhjsgNp7KqAIc25s9pZnjU7TUcSY7HcVZjdn1g=\n",
+		"a/go.mod": "module example.com/a\n\ngo 1.19\n\n" +
+			"require example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n",
+		"a/go.sum":   testGoSum,
+		"lib/go.mod": "module example.com/lib\n\ngo 1.19\n",
+		"vendor/modules.txt": "## workspace\n" +
+			"# example.com/lib v0.0.0 => ./lib\n## explicit; go 1.19\n" +
+			"# golang.org/x/mod v0.8.0\n## explicit; go 1.17\ngolang.org/x/mod/semver\n",
+	})
+	return dir
+}
+
+func Test_findWorkspace(t *testing.T) {
+	t.Parallel()
+
+	dir := writeWorkspace(t)
+
+	w, err := findWorkspace(filepath.Join(dir, "a"), dir)
+	if err != nil {
+		t.Fatalf("findWorkspace: %v", err)
+	}
+	want := &Workspace{
+		Dir: dir,
+		Modules: []WorkspaceModule{
+			{Path: "example.com/a", Dir: "a"},
+			{Path: "example.com/lib", Dir: "lib"},
+		},
+		Replacements: []WorkspaceModule{
+			{Path: "example.com/lib", Dir: "lib"},
+		},
+	}
+	if diff := cmp.Diff(want, w); diff != "" {
+		t.Errorf("unexpected workspace (-want +got):\n%s", diff)
+	}
+
+	m, err := w.module("example.com/lib")
+	if err != nil || m.Dir != "lib" {
+		t.Errorf("unexpected module: %v, %v", m, err)
+	}
+	var errWorkspace *ErrInvalidWorkspace
+	if _, err := w.module("example.com/b"); !errors.As(err, &errWorkspace) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// The search stops at the root directory.
+	w, err = findWorkspace(filepath.Join(dir, "a"), filepath.Join(dir, "a"))
+	if err != nil || w != nil {
+		t.Errorf("unexpected workspace: %v, %v", w, err)
+	}
+}
+
+func Test_loadWorkspace_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{
+			name:  "invalid go.work",
+			files: map[string]string{"go.work": "go 1.22\n\nfoo ./a\n"},
+		},
+		{
+			name:  "no modules",
+			files: map[string]string{"go.work": "go 1.22\n"},
+		},
+		{
+			name:  "missing module",
+			files: map[string]string{"go.work": "go 1.22\n\nuse ./a\n"},
+		},
+		{
+			name: "module outside the workspace",
+			files: map[string]string{
+				"go.work":     "go 1.22\n\nuse ../a\n",
+				"../a/go.mod": "module example.com/a\n",
+			},
+		},
+		{
+			name: "replacement outside the workspace",
+			files: map[string]string{
+				"go.work":  "go 1.22\n\nuse ./a\n",
+				"a/go.mod": "module example.com/a\n\nreplace example.com/lib => ../../lib\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := filepath.Join(t.TempDir(), "ws")
+			writeFiles(t, dir, tt.files)
+
+			_, err := loadWorkspace(dir)
+			var errWorkspace *ErrInvalidWorkspace
+			if !errors.As(err, &errWorkspace) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func Test_workspaceMaterials(t *testing.T) {
+	t.Parallel()
+
+	w, err := loadWorkspace(writeWorkspace(t))
+	if err != nil {
+		t.Fatalf("loadWorkspace: %v", err)
+	}
+	materials, err := workspaceMaterials(w)
+	if err != nil {
+		t.Fatalf("workspaceMaterials: %v", err)
+	}
+
+	// The local module is not a material.
+	want := []slsacommon.ProvenanceMaterial{
+		{
+			URI:    "pkg:golang/golang.org/x/mod@v0.8.0",
+			Digest: slsacommon.DigestSet{dirHashAlgorithm: "h1:LUYupSeNrTNCGzR/hVBk2NHZO4hXcVaW1k4Qx7rjPx8="},
+		},
+	}
+	if diff := cmp.Diff(want, materials); diff != "" {
+		t.Errorf("unexpected materials (-want +got):\n%s", diff)
+	}
+}
+
+func TestGoBuild_getDir_workspace(t *testing.T) {
+	t.Parallel()
+
+	dir := writeWorkspace(t)
+
+	tests := []struct {
+		name     string
+		cfg      *GoReleaserConfig
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "no module",
+			cfg:      &GoReleaserConfig{Dir: &dir},
+			expected: dir,
+		},
+		{
+			name:     "workspace module",
+			cfg:      &GoReleaserConfig{Dir: &dir, Module: "example.com/lib"},
+			expected: filepath.Join(dir, "lib"),
+		},
+		{
+			name:    "unknown module",
+			cfg:     &GoReleaserConfig{Dir: &dir, Module: "example.com/b"},
+			wantErr: true,
+		},
+		{
+			name: "workspace disabled",
+			cfg: &GoReleaserConfig{
+				Dir: &dir, Module: "example.com/lib",
+				Env: map[string]string{"GOWORK": "off"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := GoBuildNew("go", tt.cfg).getDir()
+			if tt.wantErr {
+				var errWorkspace *ErrInvalidWorkspace
+				if !errors.As(err, &errWorkspace) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getDir: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("unexpected dir, got: %q, want: %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -50,9 +50,13 @@ func (s TestSigner) Sign(context.Context, *intoto.Statement) (signing.Attestatio
 
 // TestLogEntry is a basic LogEntry implementation.
 type TestLogEntry struct {
-	IDVal       string
-	UUIDVal     string
-	LogIndexVal int64
+	IDVal                   string
+	UUIDVal                 string
+	LogIndexVal             int64
+	IntegratedTimeVal       int64
+	BodyVal                 []byte
+	SignedEntryTimestampVal []byte
+	InclusionProofVal       *signing.InclusionProof
 }
 
 // ID implements LogEntry.ID.
@@ -70,6 +74,26 @@ func (e *TestLogEntry) UUID() string {
 	return e.UUIDVal
 }
 
+// IntegratedTime implements LogEntry.IntegratedTime.
+func (e *TestLogEntry) IntegratedTime() int64 {
+	return e.IntegratedTimeVal
+}
+
+// Body implements LogEntry.Body.
+func (e *TestLogEntry) Body() []byte {
+	return e.BodyVal
+}
+
+// SignedEntryTimestamp implements LogEntry.SignedEntryTimestamp.
+func (e *TestLogEntry) SignedEntryTimestamp() []byte {
+	return e.SignedEntryTimestampVal
+}
+
+// InclusionProof implements LogEntry.InclusionProof.
+func (e *TestLogEntry) InclusionProof() *signing.InclusionProof {
+	return e.InclusionProofVal
+}
+
 // TestTransparencyLog is an implementation of TransparencyLog that returns an ErrTransparencyLog.
 type TestTransparencyLog struct {
 	Entry *TestLogEntry
@@ -40,6 +40,19 @@ func UnmarshalList(arg string) ([]string, error) {
 	return res, nil
 }
 
+// UnmarshalBase64 unmarshals a base64-encoded JSON string into v.
+func UnmarshalBase64(arg string, v interface{}) error {
+	b, err := base64.StdEncoding.DecodeString(arg)
+	if err != nil {
+		return fmt.Errorf("base64.StdEncoding.DecodeString: %w", err)
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return nil
+}
+
 // MarshalToString marshals to a string.
 func MarshalToString(args interface{}) (string, error) {
 	jsonData, err := json.Marshal(args)
@@ -106,3 +106,24 @@ func Test_UnmarshalList(t *testing.T) {
 		})
 	}
 }
+
+func Test_UnmarshalBase64(t *testing.T) {
+	t.Parallel()
+
+	value, err := MarshalToString(map[string]string{"binary": "foo"})
+	if err != nil {
+		t.Fatalf("MarshalToString: %v", err)
+	}
+
+	var m map[string]string
+	if err := UnmarshalBase64(value, &m); err != nil {
+		t.Fatalf("UnmarshalBase64: %v", err)
+	}
+	if want := map[string]string{"binary": "foo"}; !cmp.Equal(m, want) {
+		t.Errorf(cmp.Diff(m, want))
+	}
+
+	if err := UnmarshalBase64("blabla", &m); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -81,6 +81,19 @@ func VerifyAttestationPath(path string) error {
 	return nil
 }
 
+// VerifyBundlePath verifies that the path of a Sigstore bundle is valid. It
+// checks that the path is under the current working directory and that the
+// extension of the file is `sigstore`.
+func VerifyBundlePath(path string) error {
+	if !strings.HasSuffix(path, ".sigstore") {
+		return errors.Errorf(&ErrInvalidPath{}, "invalid suffix: %q. Must be .sigstore", path)
+	}
+	if err := PathIsUnderCurrentDirectory(path); err != nil {
+		return err
+	}
+	return nil
+}
+
 // CreateNewFileUnderCurrentDirectory create a new file under the current directory
 // and fails if the file already exists. The file is always created with the pemisisons
 // `0o600`.
@@ -139,6 +139,53 @@ func Test_VerifyAttestationPath(t *testing.T) {
 	}
 }
 
+func Test_VerifyBundlePath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expected error
+		name     string
+		path     string
+	}{
+		{
+			name:     "valid file",
+			path:     "./path/to/valid.sigstore",
+			expected: nil,
+		},
+		{
+			name:     "invalid path",
+			path:     "../some/invalid/valid.sigstore",
+			expected: &ErrInvalidPath{},
+		},
+		{
+			name:     "invalid extension",
+			path:     "some/file.intoto.jsonl",
+			expected: &ErrInvalidPath{},
+		},
+		{
+			name:     "invalid folder extension",
+			path:     "file.sigstore/file",
+			expected: &ErrInvalidPath{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := VerifyBundlePath(tt.path)
+			if (err == nil && tt.expected != nil) ||
+				(err != nil && tt.expected == nil) {
+				t.Fatalf("unexpected error: %v", cmp.Diff(err, tt.expected, cmpopts.EquateErrors()))
+			}
+
+			if err != nil && !errors.As(err, &tt.expected) {
+				t.Fatalf("unexpected error: %v", cmp.Diff(err, tt.expected, cmpopts.EquateErrors()))
+			}
+		})
+	}
+}
+
 func tempWD() (func() error, error) {
 	// Set up a temporary working directory for the test.
 	cwd, err := os.Getwd()
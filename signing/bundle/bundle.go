@@ -0,0 +1,240 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle implements the Sigstore bundle format. A bundle contains a
+// DSSE envelope together with the material needed to verify it offline: the
+// signing certificate chain, the transparency log entries and the RFC 3161
+// timestamps of the signatures.
+//
+// See https://github.com/sigstore/protobuf-specs for the format. The JSON
+// encoding follows the protobuf JSON mapping, i.e. 64-bit integers are
+// encoded as strings and bytes as standard base64.
+package bundle
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+)
+
+// MediaType is the media type of bundles created by this package.
+const MediaType = "application/vnd.dev.sigstore.bundle+json;version=0.1"
+
+// Bundle is a Sigstore bundle.
+type Bundle struct {
+	MediaType            string                `json:"mediaType"`
+	VerificationMaterial *VerificationMaterial `json:"verificationMaterial"`
+	DSSEEnvelope         *dsse.Envelope        `json:"dsseEnvelope"`
+}
+
+// VerificationMaterial is the material needed to verify the envelope.
+type VerificationMaterial struct {
+	X509CertificateChain      *X509CertificateChain      `json:"x509CertificateChain,omitempty"`
+	TlogEntries               []*TransparencyLogEntry    `json:"tlogEntries,omitempty"`
+	TimestampVerificationData *TimestampVerificationData `json:"timestampVerificationData,omitempty"`
+}
+
+// TimestampVerificationData contains the RFC 3161 timestamps of the
+// signatures.
+type TimestampVerificationData struct {
+	RFC3161Timestamps []*RFC3161SignedTimestamp `json:"rfc3161Timestamps"`
+}
+
+// RFC3161SignedTimestamp is a DER-encoded RFC 3161 timestamp token.
+type RFC3161SignedTimestamp struct {
+	SignedTimestamp []byte `json:"signedTimestamp"`
+}
+
+// X509CertificateChain is a certificate chain. The first certificate is the
+// signing certificate.
+type X509CertificateChain struct {
+	Certificates []*X509Certificate `json:"certificates"`
+}
+
+// X509Certificate is a DER-encoded certificate.
+type X509Certificate struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// TransparencyLogEntry is a transparency log entry.
+type TransparencyLogEntry struct {
+	LogIndex          int64             `json:"logIndex,string"`
+	LogID             *LogID            `json:"logId"`
+	KindVersion       *KindVersion      `json:"kindVersion"`
+	IntegratedTime    int64             `json:"integratedTime,string"`
+	InclusionPromise  *InclusionPromise `json:"inclusionPromise,omitempty"`
+	InclusionProof    *InclusionProof   `json:"inclusionProof,omitempty"`
+	CanonicalizedBody []byte            `json:"canonicalizedBody,omitempty"`
+}
+
+// LogID identifies a transparency log by the digest of its public key.
+type LogID struct {
+	KeyID []byte `json:"keyId"`
+}
+
+// KindVersion is the type and version of a log entry.
+type KindVersion struct {
+	Kind    string `json:"kind"`
+	Version string `json:"version"`
+}
+
+// InclusionPromise is the signed entry timestamp (SET) of a log entry.
+type InclusionPromise struct {
+	SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+}
+
+// InclusionProof is a Merkle tree inclusion proof of a log entry.
+type InclusionProof struct {
+	LogIndex   int64       `json:"logIndex,string"`
+	RootHash   []byte      `json:"rootHash"`
+	TreeSize   int64       `json:"treeSize,string"`
+	Hashes     [][]byte    `json:"hashes"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// Checkpoint is a signed tree head.
+type Checkpoint struct {
+	Envelope string `json:"envelope"`
+}
+
+// New creates a bundle for the signed attestation and its transparency log
+// entries. Certificates and timestamps attached to the envelope signatures
+// are moved to the verification material.
+func New(att signing.Attestation, entries ...signing.LogEntry) (*Bundle, error) {
+	env := &dsse.Envelope{}
+	if err := json.Unmarshal(att.Bytes(), env); err != nil {
+		return nil, fmt.Errorf("decoding envelope: %w", err)
+	}
+	// NOTE: Unmarshalling into a dsse.Envelope drops the non-standard cert
+	// and timestamp fields of the signatures.
+
+	vm := &VerificationMaterial{}
+	timestamps, err := timestamps(att.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(timestamps) > 0 {
+		vm.TimestampVerificationData = &TimestampVerificationData{
+			RFC3161Timestamps: timestamps,
+		}
+	}
+
+	if len(att.Cert()) > 0 {
+		certs, err := cryptoutils.UnmarshalCertificatesFromPEM(att.Cert())
+		if err != nil {
+			return nil, fmt.Errorf("decoding certificate: %w", err)
+		}
+		chain := &X509CertificateChain{}
+		for _, c := range certs {
+			chain.Certificates = append(chain.Certificates, &X509Certificate{RawBytes: c.Raw})
+		}
+		vm.X509CertificateChain = chain
+	}
+
+	for _, e := range entries {
+		tle, err := NewTransparencyLogEntry(e)
+		if err != nil {
+			return nil, fmt.Errorf("converting log entry %q: %w", e.UUID(), err)
+		}
+		vm.TlogEntries = append(vm.TlogEntries, tle)
+	}
+
+	return &Bundle{
+		MediaType:            MediaType,
+		VerificationMaterial: vm,
+		DSSEEnvelope:         env,
+	}, nil
+}
+
+// timestamps returns the timestamps attached to the envelope signatures.
+func timestamps(signedAtt []byte) ([]*RFC3161SignedTimestamp, error) {
+	env := &envelope.Envelope{}
+	if err := json.Unmarshal(signedAtt, env); err != nil {
+		return nil, fmt.Errorf("decoding envelope: %w", err)
+	}
+
+	var ts []*RFC3161SignedTimestamp
+	for _, sig := range env.Signatures {
+		if sig.Timestamp == "" {
+			continue
+		}
+		token, err := base64.StdEncoding.DecodeString(sig.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("decoding timestamp: %w", err)
+		}
+		ts = append(ts, &RFC3161SignedTimestamp{SignedTimestamp: token})
+	}
+	return ts, nil
+}
+
+// NewTransparencyLogEntry converts the transparency log entry to the bundle
+// format.
+func NewTransparencyLogEntry(e signing.LogEntry) (*TransparencyLogEntry, error) {
+	logID, err := hex.DecodeString(e.ID())
+	if err != nil {
+		return nil, fmt.Errorf("decoding log ID: %w", err)
+	}
+
+	// The kind and version of the entry are part of the canonicalized body.
+	var kv struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal(e.Body(), &kv); err != nil {
+		return nil, fmt.Errorf("decoding log entry body: %w", err)
+	}
+
+	tle := &TransparencyLogEntry{
+		LogIndex: e.LogIndex(),
+		LogID:    &LogID{KeyID: logID},
+		KindVersion: &KindVersion{
+			Kind:    kv.Kind,
+			Version: kv.APIVersion,
+		},
+		IntegratedTime:    e.IntegratedTime(),
+		CanonicalizedBody: e.Body(),
+	}
+
+	if set := e.SignedEntryTimestamp(); len(set) > 0 {
+		tle.InclusionPromise = &InclusionPromise{
+			SignedEntryTimestamp: set,
+		}
+	}
+
+	if p := e.InclusionProof(); p != nil {
+		tle.InclusionProof = &InclusionProof{
+			LogIndex: p.LogIndex,
+			RootHash: p.RootHash,
+			TreeSize: p.TreeSize,
+			Hashes:   p.Hashes,
+		}
+		if p.Checkpoint != "" {
+			tle.InclusionProof.Checkpoint = &Checkpoint{Envelope: p.Checkpoint}
+		}
+	}
+
+	return tle, nil
+}
+
+// Bytes returns the bundle encoded as JSON.
+func (b *Bundle) Bytes() ([]byte, error) {
+	return json.Marshal(b)
+}
@@ -0,0 +1,197 @@
+package bundle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/testutil"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+)
+
+func testCert(t *testing.T) ([]byte, []byte) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestNew(t *testing.T) {
+	der, certPEM := testCert(t)
+
+	env, err := json.Marshal(&envelope.Envelope{
+		PayloadType: "application/vnd.in-toto+json",
+		Payload:     "cGF5bG9hZA==",
+		Signatures: []envelope.Signature{
+			{
+				KeyID: "keyid",
+				Sig:   "c2ln",
+				Cert:  string(certPEM),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"apiVersion":"0.0.1","kind":"intoto","spec":{}}`)
+	tle := &TransparencyLogEntry{
+		LogIndex:       1234,
+		LogID:          &LogID{KeyID: []byte{0x0a, 0x0b}},
+		KindVersion:    &KindVersion{Kind: "intoto", Version: "0.0.1"},
+		IntegratedTime: 1672531200,
+		InclusionPromise: &InclusionPromise{
+			SignedEntryTimestamp: []byte("set"),
+		},
+		InclusionProof: &InclusionProof{
+			LogIndex:   1234,
+			RootHash:   []byte("root"),
+			TreeSize:   5678,
+			Hashes:     [][]byte{[]byte("hash")},
+			Checkpoint: &Checkpoint{Envelope: "checkpoint"},
+		},
+		CanonicalizedBody: body,
+	}
+
+	att := &testutil.TestAttestation{
+		CertVal:  certPEM,
+		BytesVal: env,
+	}
+	entry := &testutil.TestLogEntry{
+		IDVal:                   "0a0b",
+		UUIDVal:                 "uuid",
+		LogIndexVal:             1234,
+		IntegratedTimeVal:       1672531200,
+		BodyVal:                 body,
+		SignedEntryTimestampVal: []byte("set"),
+		InclusionProofVal: &signing.InclusionProof{
+			LogIndex:   1234,
+			TreeSize:   5678,
+			RootHash:   []byte("root"),
+			Hashes:     [][]byte{[]byte("hash")},
+			Checkpoint: "checkpoint",
+		},
+	}
+
+	b, err := New(att, entry)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	want := &Bundle{
+		MediaType: MediaType,
+		VerificationMaterial: &VerificationMaterial{
+			X509CertificateChain: &X509CertificateChain{
+				Certificates: []*X509Certificate{{RawBytes: der}},
+			},
+			TlogEntries: []*TransparencyLogEntry{tle},
+		},
+		DSSEEnvelope: &dsse.Envelope{
+			PayloadType: "application/vnd.in-toto+json",
+			Payload:     "cGF5bG9hZA==",
+			Signatures: []dsse.Signature{
+				{
+					KeyID: "keyid",
+					Sig:   "c2ln",
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, b); diff != "" {
+		t.Errorf("unexpected bundle (-want +got):\n%s", diff)
+	}
+
+	// Check the protobuf JSON encoding of 64-bit integers.
+	bb, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		VerificationMaterial struct {
+			TlogEntries []struct {
+				LogIndex       string `json:"logIndex"`
+				IntegratedTime string `json:"integratedTime"`
+			} `json:"tlogEntries"`
+		} `json:"verificationMaterial"`
+	}
+	if err := json.Unmarshal(bb, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.VerificationMaterial.TlogEntries) != 1 {
+		t.Fatalf("expected one tlog entry, got %d", len(got.VerificationMaterial.TlogEntries))
+	}
+	if e := got.VerificationMaterial.TlogEntries[0]; e.LogIndex != "1234" || e.IntegratedTime != "1672531200" {
+		t.Errorf("unexpected tlog entry encoding: %+v", e)
+	}
+
+	var roundTrip Bundle
+	if err := json.Unmarshal(bb, &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, &roundTrip); diff != "" {
+		t.Errorf("unexpected bundle after round trip (-want +got):\n%s", diff)
+	}
+}
+
+func TestNew_timestamps(t *testing.T) {
+	env, err := json.Marshal(&envelope.Envelope{
+		PayloadType: "application/vnd.in-toto+json",
+		Payload:     "cGF5bG9hZA==",
+		Signatures: []envelope.Signature{
+			{
+				Sig:       "c2ln",
+				Timestamp: "dG9rZW4=",
+			},
+			{
+				Sig: "c2lnMg==",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := New(&testutil.TestAttestation{BytesVal: env})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	want := &TimestampVerificationData{
+		RFC3161Timestamps: []*RFC3161SignedTimestamp{
+			{SignedTimestamp: []byte("token")},
+		},
+	}
+	if diff := cmp.Diff(want, b.VerificationMaterial.TimestampVerificationData); diff != "" {
+		t.Errorf("unexpected timestamps (-want +got):\n%s", diff)
+	}
+}
+
+func TestNew_invalidEntry(t *testing.T) {
+	att := &testutil.TestAttestation{
+		BytesVal: []byte(`{"payloadType":"application/vnd.in-toto+json","payload":"","signatures":[]}`),
+	}
+	entry := &testutil.TestLogEntry{
+		IDVal:   "not hex",
+		BodyVal: []byte(`{"apiVersion":"0.0.1","kind":"intoto","spec":{}}`),
+	}
+	if _, err := New(att, entry); err == nil {
+		t.Errorf("expected error for invalid log ID")
+	}
+}
@@ -27,11 +27,14 @@ out of band.
 The signature is a base64 encoding of the raw bytes from the signature
 algorithm.
 The cert is a PEM encoded string of the signing certificate.
+The timestamp is a base64 encoding of an RFC 3161 timestamp token over the
+raw bytes of the signature.
 */
 type Signature struct {
-	KeyID string `json:"keyid"`
-	Sig   string `json:"sig"`
-	Cert  string `json:"cert"`
+	KeyID     string `json:"keyid"`
+	Sig       string `json:"sig"`
+	Cert      string `json:"cert"`
+	Timestamp string `json:"timestamp,omitempty"`
 }
 
 // AddCertToEnvelope takes a signed DSSE Envelope and a PEM-encoded certificate, and
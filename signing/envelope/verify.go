@@ -0,0 +1,296 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+// ErrInvalidEnvelope indicates that the envelope could not be decoded.
+type ErrInvalidEnvelope struct {
+	errors.WrappableError
+}
+
+// ErrInvalidCertificate indicates that a signing certificate is invalid or
+// does not chain up to the trusted roots.
+type ErrInvalidCertificate struct {
+	errors.WrappableError
+}
+
+// ErrInvalidSignature indicates that a signature could not be verified.
+type ErrInvalidSignature struct {
+	errors.WrappableError
+}
+
+// ErrNoValidSignature indicates that none of the signatures in the envelope
+// could be verified.
+type ErrNoValidSignature struct {
+	errors.WrappableError
+}
+
+// ErrInvalidTimestamp indicates that the timestamp of a signature could not
+// be verified.
+type ErrInvalidTimestamp struct {
+	errors.WrappableError
+}
+
+// TimestampVerifier verifies RFC 3161 timestamp tokens.
+type TimestampVerifier interface {
+	// VerifyTimestamp verifies that the DER-encoded timestamp token is over
+	// data and returns the time of the timestamp.
+	VerifyTimestamp(token, data []byte) (time.Time, error)
+}
+
+// VerifyOptions are the options used to verify an envelope.
+type VerifyOptions struct {
+	// PublicKeys are used to verify signatures that do not have a
+	// certificate attached.
+	PublicKeys []crypto.PublicKey
+
+	// Roots are the trusted root and intermediate certificates. If set,
+	// attached certificates must chain up to one of the roots. Attached
+	// certificates are ignored if empty, and the signatures are verified
+	// against PublicKeys instead.
+	Roots []*x509.Certificate
+
+	// Timestamps is used to verify the timestamps of the signatures. If
+	// set, a timestamp is accepted as proof of the signing time and the
+	// attached certificate must be valid at that time. Timestamps are
+	// ignored if nil.
+	Timestamps TimestampVerifier
+}
+
+// SignatureVerification is the verification result of a single signature.
+type SignatureVerification struct {
+	// KeyID is the key ID of the signature.
+	KeyID string
+
+	// Cert is the attached signing certificate, if any.
+	Cert *x509.Certificate
+
+	// PublicKey is the public key that the signature was verified with.
+	PublicKey crypto.PublicKey
+
+	// SigningTime is the signing time proven by a verified timestamp. It is
+	// zero if the signature has no verified timestamp.
+	SigningTime time.Time
+
+	// Err is the verification error. It is nil if the signature is valid.
+	Err error
+}
+
+// Verified returns whether the signature is valid.
+func (s *SignatureVerification) Verified() bool {
+	return s.Err == nil
+}
+
+// Verification is the verification result of an envelope.
+type Verification struct {
+	// PayloadType is the payload type of the envelope.
+	PayloadType string
+
+	// Payload is the decoded payload.
+	Payload []byte
+
+	// Statement is the decoded in-toto statement.
+	Statement *intoto.Statement
+
+	// Signatures are the verification results of each signature in the
+	// order they appear in the envelope.
+	Signatures []SignatureVerification
+}
+
+// Verify parses the signed Envelope and verifies each of its signatures
+// against the attached certificate if opts has trusted roots or, otherwise,
+// against the public keys in opts. All the signatures are verified, and the
+// per-signature results are returned. It returns an ErrNoValidSignature error
+// along with the results if none of the signatures are valid.
+func Verify(signedAtt []byte, opts *VerifyOptions) (*Verification, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+
+	env := &Envelope{}
+	if err := json.Unmarshal(signedAtt, env); err != nil {
+		return nil, errors.Errorf(&ErrInvalidEnvelope{}, "decoding envelope: %w", err)
+	}
+	if env.PayloadType != intoto.PayloadType {
+		return nil, errors.Errorf(&ErrInvalidEnvelope{}, "unexpected payload type %q", env.PayloadType)
+	}
+	if len(env.Signatures) == 0 {
+		return nil, errors.Errorf(&ErrInvalidEnvelope{}, "no signatures found in the envelope")
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidEnvelope{}, "decoding payload: %w", err)
+	}
+
+	stmt := &intoto.Statement{}
+	if err := json.Unmarshal(payload, stmt); err != nil {
+		return nil, errors.Errorf(&ErrInvalidEnvelope{}, "decoding statement: %w", err)
+	}
+
+	v := &Verification{
+		PayloadType: env.PayloadType,
+		Payload:     payload,
+		Statement:   stmt,
+	}
+
+	pae := dsse.PAE(env.PayloadType, payload)
+	var firstErr error
+	var msgs []string
+	verified := false
+	for i, sig := range env.Signatures {
+		res := verifySignature(sig, pae, opts)
+		v.Signatures = append(v.Signatures, res)
+		if res.Err == nil {
+			verified = true
+			continue
+		}
+		if firstErr == nil {
+			firstErr = res.Err
+		}
+		msgs = append(msgs, fmt.Sprintf("signature %d: %v", i, res.Err))
+	}
+	if verified {
+		return v, nil
+	}
+
+	// NOTE: Only the first error is wrapped so that it can be type checked.
+	// The remaining errors are included in the message.
+	return v, errors.Errorf(&ErrNoValidSignature{}, "no valid signature found: %w (%s)",
+		firstErr, strings.Join(msgs, "; "))
+}
+
+// verifySignature verifies a single signature over the DSSE PAE encoding of
+// the payload.
+func verifySignature(sig Signature, pae []byte, opts *VerifyOptions) SignatureVerification {
+	res := SignatureVerification{KeyID: sig.KeyID}
+
+	rawSig, err := base64.StdEncoding.DecodeString(sig.Sig)
+	if err != nil {
+		res.Err = errors.Errorf(&ErrInvalidSignature{}, "decoding signature: %w", err)
+		return res
+	}
+
+	if sig.Timestamp != "" && opts.Timestamps != nil {
+		token, err := base64.StdEncoding.DecodeString(sig.Timestamp)
+		if err != nil {
+			res.Err = errors.Errorf(&ErrInvalidTimestamp{}, "decoding timestamp: %w", err)
+			return res
+		}
+		res.SigningTime, err = opts.Timestamps.VerifyTimestamp(token, rawSig)
+		if err != nil {
+			res.Err = errors.Errorf(&ErrInvalidTimestamp{}, "verifying timestamp: %w", err)
+			return res
+		}
+	}
+
+	// NOTE: An attached certificate is only trusted if it chains up to the
+	// roots. Anyone can attach a self-signed certificate, so it is ignored
+	// without roots.
+	if sig.Cert != "" && len(opts.Roots) > 0 {
+		cert, err := verifyCertificate([]byte(sig.Cert), opts.Roots, res.SigningTime)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Cert = cert
+		res.PublicKey = cert.PublicKey
+		res.Err = verifyWithKey(cert.PublicKey, rawSig, pae)
+		return res
+	}
+
+	if len(opts.PublicKeys) == 0 {
+		res.Err = errors.Errorf(&ErrInvalidSignature{}, "no trusted certificate attached and no public key given")
+		return res
+	}
+	for _, pub := range opts.PublicKeys {
+		if err := verifyWithKey(pub, rawSig, pae); err != nil {
+			res.Err = err
+			continue
+		}
+		res.PublicKey = pub
+		res.Err = nil
+		return res
+	}
+	return res
+}
+
+func verifyWithKey(pub crypto.PublicKey, rawSig, pae []byte) error {
+	verifier, err := signature.LoadVerifier(pub, crypto.SHA256)
+	if err != nil {
+		return errors.Errorf(&ErrInvalidSignature{}, "loading verifier: %w", err)
+	}
+	if err := verifier.VerifySignature(bytes.NewReader(rawSig), bytes.NewReader(pae)); err != nil {
+		return errors.Errorf(&ErrInvalidSignature{}, "verifying signature: %w", err)
+	}
+	return nil
+}
+
+// verifyCertificate parses the PEM-encoded certificate chain and verifies
+// that it chains up to the roots. The first certificate is the signing
+// certificate and any following certificates are intermediates.
+//
+// NOTE: Signing certificates are short-lived so the chain is verified at the
+// signing time if it is known, and at the time the signing certificate was
+// issued otherwise.
+func verifyCertificate(certPEM []byte, roots []*x509.Certificate, signingTime time.Time) (*x509.Certificate, error) {
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(certPEM)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidCertificate{}, "decoding certificate: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, errors.Errorf(&ErrInvalidCertificate{}, "no certificate found in the signature")
+	}
+
+	cert := certs[0]
+	if signingTime.IsZero() {
+		signingTime = cert.NotBefore
+	} else if signingTime.Before(cert.NotBefore) || signingTime.After(cert.NotAfter) {
+		return nil, errors.Errorf(&ErrInvalidCertificate{}, "certificate is not valid at signing time %s",
+			signingTime.UTC().Format(time.RFC3339))
+	}
+	if len(roots) == 0 {
+		return nil, errors.Errorf(&ErrInvalidCertificate{}, "no trusted roots to verify the certificate")
+	}
+
+	rootPool := x509.NewCertPool()
+	intermediatePool := x509.NewCertPool()
+	for _, c := range roots {
+		// Self-signed certificates are roots, any other certificate is an
+		// intermediate.
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			rootPool.AddCert(c)
+		} else {
+			intermediatePool.AddCert(c)
+		}
+	}
+	for _, c := range certs[1:] {
+		intermediatePool.AddCert(c)
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediatePool,
+		CurrentTime:   signingTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, errors.Errorf(&ErrInvalidCertificate{}, "verifying certificate chain: %w", err)
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,341 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// testCA is a certificate authority used to issue signing certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key := newTestKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a PEM-encoded code signing certificate for key.
+func (ca *testCA) issue(t *testing.T, key *ecdsa.PrivateKey) string {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-1 * time.Minute),
+		NotAfter:     time.Now().Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// sign returns a signature over the DSSE PAE encoding of the payload.
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte) string {
+	s, err := signature.LoadECDSASigner(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := s.SignMessage(bytes.NewReader(dsse.PAE(intoto.PayloadType, payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func marshalSigned(t *testing.T, payload []byte, sigs ...Signature) []byte {
+	b, err := json.Marshal(&Envelope{
+		PayloadType: intoto.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  sigs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// fakeTimestamps accepts the timestamp token "token" at a fixed time.
+type fakeTimestamps time.Time
+
+func (f fakeTimestamps) VerifyTimestamp(token, _ []byte) (time.Time, error) {
+	if string(token) != "token" {
+		return time.Time{}, errors.New("invalid token")
+	}
+	return time.Time(f), nil
+}
+
+func TestVerify(t *testing.T) {
+	stmt := intoto.Statement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: "https://example.com/predicate",
+		},
+	}
+	payload, err := json.Marshal(&stmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+
+	testCases := []struct {
+		name string
+		att  []byte
+		opts *VerifyOptions
+
+		// verified is the expected verification result of each signature.
+		verified []bool
+		err      func(error) bool
+	}{
+		{
+			name: "cert",
+			att: marshalSigned(t, payload, Signature{
+				Sig:  sign(t, key, payload),
+				Cert: ca.issue(t, key),
+			}),
+			opts:     &VerifyOptions{Roots: []*x509.Certificate{ca.cert}},
+			verified: []bool{true},
+		},
+		{
+			name: "cert without roots",
+			att: marshalSigned(t, payload, Signature{
+				Sig:  sign(t, key, payload),
+				Cert: ca.issue(t, key),
+			}),
+			verified: []bool{false},
+			err:      errorAs[*ErrNoValidSignature],
+		},
+		{
+			name: "cert without roots is ignored",
+			att: marshalSigned(t, payload, Signature{
+				Sig:  sign(t, key, payload),
+				Cert: ca.issue(t, otherKey),
+			}),
+			opts:     &VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}},
+			verified: []bool{true},
+		},
+		{
+			name: "cert without roots for other key",
+			att: marshalSigned(t, payload, Signature{
+				Sig:  sign(t, otherKey, payload),
+				Cert: ca.issue(t, otherKey),
+			}),
+			opts:     &VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}},
+			verified: []bool{false},
+			err:      errorAs[*ErrInvalidSignature],
+		},
+		{
+			name: "public key",
+			att: marshalSigned(t, payload, Signature{
+				KeyID: "key",
+				Sig:   sign(t, key, payload),
+			}),
+			opts:     &VerifyOptions{PublicKeys: []crypto.PublicKey{otherKey.Public(), key.Public()}},
+			verified: []bool{true},
+		},
+		{
+			name: "second signature valid",
+			att: marshalSigned(t, payload,
+				Signature{Sig: sign(t, otherKey, payload)},
+				Signature{Sig: sign(t, key, payload)},
+			),
+			opts:     &VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}},
+			verified: []bool{false, true},
+		},
+		{
+			name: "all signatures verified",
+			att: marshalSigned(t, payload,
+				Signature{Sig: sign(t, key, payload)},
+				Signature{Sig: sign(t, otherKey, payload)},
+				Signature{Sig: sign(t, key, payload)},
+			),
+			opts:     &VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}},
+			verified: []bool{true, false, true},
+		},
+		{
+			name: "no valid signature",
+			att: marshalSigned(t, payload,
+				Signature{Sig: sign(t, otherKey, payload)},
+				Signature{Sig: sign(t, otherKey, payload)},
+			),
+			opts:     &VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}},
+			verified: []bool{false, false},
+			err:      errorAs[*ErrInvalidSignature],
+		},
+		{
+			name: "no public key",
+			att: marshalSigned(t, payload, Signature{
+				Sig: sign(t, key, payload),
+			}),
+			verified: []bool{false},
+			err:      errorAs[*ErrNoValidSignature],
+		},
+		{
+			name: "untrusted cert",
+			att: marshalSigned(t, payload, Signature{
+				Sig:  sign(t, key, payload),
+				Cert: ca.issue(t, key),
+			}),
+			opts:     &VerifyOptions{Roots: []*x509.Certificate{otherCA.cert}},
+			verified: []bool{false},
+			err:      errorAs[*ErrInvalidCertificate],
+		},
+		{
+			name: "cert for other key",
+			att: marshalSigned(t, payload, Signature{
+				Sig:  sign(t, key, payload),
+				Cert: ca.issue(t, otherKey),
+			}),
+			opts:     &VerifyOptions{Roots: []*x509.Certificate{ca.cert}},
+			verified: []bool{false},
+			err:      errorAs[*ErrInvalidSignature],
+		},
+		{
+			name: "tampered payload",
+			att: marshalSigned(t, []byte(`{"_type":"tampered"}`), Signature{
+				Sig: sign(t, key, payload),
+			}),
+			opts:     &VerifyOptions{PublicKeys: []crypto.PublicKey{key.Public()}},
+			verified: []bool{false},
+			err:      errorAs[*ErrInvalidSignature],
+		},
+		{
+			name: "timestamp",
+			att: marshalSigned(t, payload, Signature{
+				Sig:       sign(t, key, payload),
+				Cert:      ca.issue(t, key),
+				Timestamp: base64.StdEncoding.EncodeToString([]byte("token")),
+			}),
+			opts: &VerifyOptions{
+				Roots:      []*x509.Certificate{ca.cert},
+				Timestamps: fakeTimestamps(time.Now()),
+			},
+			verified: []bool{true},
+		},
+		{
+			name: "invalid timestamp",
+			att: marshalSigned(t, payload, Signature{
+				Sig:       sign(t, key, payload),
+				Cert:      ca.issue(t, key),
+				Timestamp: base64.StdEncoding.EncodeToString([]byte("other")),
+			}),
+			opts: &VerifyOptions{
+				Roots:      []*x509.Certificate{ca.cert},
+				Timestamps: fakeTimestamps(time.Now()),
+			},
+			verified: []bool{false},
+			err:      errorAs[*ErrInvalidTimestamp],
+		},
+		{
+			name: "timestamp after cert expiry",
+			att: marshalSigned(t, payload, Signature{
+				Sig:       sign(t, key, payload),
+				Cert:      ca.issue(t, key),
+				Timestamp: base64.StdEncoding.EncodeToString([]byte("token")),
+			}),
+			opts: &VerifyOptions{
+				Roots:      []*x509.Certificate{ca.cert},
+				Timestamps: fakeTimestamps(time.Now().Add(time.Hour)),
+			},
+			verified: []bool{false},
+			err:      errorAs[*ErrInvalidCertificate],
+		},
+		{
+			name: "not json",
+			att:  []byte("not json"),
+			err:  errorAs[*ErrInvalidEnvelope],
+		},
+		{
+			name: "no signatures",
+			att:  marshalSigned(t, payload),
+			err:  errorAs[*ErrInvalidEnvelope],
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := Verify(tc.att, tc.opts)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !tc.err(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v == nil {
+				if len(tc.verified) != 0 {
+					t.Fatalf("expected verification results")
+				}
+				return
+			}
+
+			var verified []bool
+			for i := range v.Signatures {
+				verified = append(verified, v.Signatures[i].Verified())
+			}
+			if diff := cmp.Diff(tc.verified, verified); diff != "" {
+				t.Errorf("unexpected verification results (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(stmt, *v.Statement); err == nil && diff != "" {
+				t.Errorf("unexpected statement (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// errorAs reports whether err wraps an error of type T.
+func errorAs[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
@@ -0,0 +1,404 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jsoncanonicalizer "github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	"github.com/sigstore/rekor/pkg/util"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/options"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/tlog"
+)
+
+const (
+	// fileLogEntries is the name of the file that stores the log entries.
+	fileLogEntries = "entries.jsonl"
+
+	// fileLogOrigin is the origin of the checkpoints of file logs.
+	fileLogOrigin = "slsa-github-generator/local"
+)
+
+// FileLog is a TransparencyLog that stores attestations in an append-only
+// Merkle tree log on disk. Entries are signed with a local key in the same
+// way as Rekor entries so they can be verified with tlog.Verifier.
+//
+// NOTE: Only a single FileLog instance may write to a directory at a time.
+type FileLog struct {
+	dir    string
+	signer signature.Signer
+	pub    crypto.PublicKey
+	logID  string
+	now    func() time.Time
+
+	mu sync.Mutex
+}
+
+// fileLogRecord is a log entry as stored on disk.
+type fileLogRecord struct {
+	Body                 []byte `json:"body"`
+	IntegratedTime       int64  `json:"integratedTime"`
+	SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+}
+
+// fileLogEntry is an entry of a FileLog.
+type fileLogEntry struct {
+	logID  string
+	index  int64
+	record fileLogRecord
+	proof  *signing.InclusionProof
+}
+
+// ID implements LogEntry.ID.
+func (e *fileLogEntry) ID() string {
+	return e.logID
+}
+
+// LogIndex implements LogEntry.LogIndex.
+func (e *fileLogEntry) LogIndex() int64 {
+	return e.index
+}
+
+// UUID implements LogEntry.UUID.
+func (e *fileLogEntry) UUID() string {
+	return hex.EncodeToString(rfc6962.DefaultHasher.HashLeaf(e.record.Body))
+}
+
+// IntegratedTime implements LogEntry.IntegratedTime.
+func (e *fileLogEntry) IntegratedTime() int64 {
+	return e.record.IntegratedTime
+}
+
+// Body implements LogEntry.Body.
+func (e *fileLogEntry) Body() []byte {
+	return e.record.Body
+}
+
+// SignedEntryTimestamp implements LogEntry.SignedEntryTimestamp.
+func (e *fileLogEntry) SignedEntryTimestamp() []byte {
+	return e.record.SignedEntryTimestamp
+}
+
+// InclusionProof implements LogEntry.InclusionProof.
+func (e *fileLogEntry) InclusionProof() *signing.InclusionProof {
+	return e.proof
+}
+
+// NewFileLog returns a new FileLog that stores its entries in dir and signs
+// them using priv. The directory is created if it does not exist.
+func NewFileLog(dir string, priv crypto.PrivateKey) (*FileLog, error) {
+	s, err := signature.LoadSigner(priv, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("loading signer: %w", err)
+	}
+	pub, err := s.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %w", err)
+	}
+	logID, err := tlog.LogID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+
+	return &FileLog{
+		dir:    dir,
+		signer: s,
+		pub:    pub,
+		logID:  logID,
+		now:    time.Now,
+	}, nil
+}
+
+// PublicKey returns the public key of the log.
+func (l *FileLog) PublicKey() crypto.PublicKey {
+	return l.pub
+}
+
+// Upload implements TransparencyLog.Upload. It appends the signed attestation
+// to the log and returns the entry with an inclusion proof.
+func (l *FileLog) Upload(_ context.Context, att signing.Attestation) (signing.LogEntry, error) {
+	body, err := intotoBody(att)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := l.readRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	index := int64(len(records))
+	integratedTime := l.now().Unix()
+	payload, err := tlog.SignedEntryTimestampPayload(body, integratedTime, index, l.logID)
+	if err != nil {
+		return nil, err
+	}
+	set, err := l.signer.SignMessage(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("signing entry timestamp: %w", err)
+	}
+
+	record := fileLogRecord{
+		Body:                 body,
+		IntegratedTime:       integratedTime,
+		SignedEntryTimestamp: set,
+	}
+	if err := l.appendRecord(record); err != nil {
+		return nil, err
+	}
+
+	return l.entry(append(records, record), index)
+}
+
+// Get returns the entry at index with an inclusion proof for the current
+// tree.
+func (l *FileLog) Get(index int64) (signing.LogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := l.readRecords()
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= int64(len(records)) {
+		return nil, fmt.Errorf("log entry %d not found", index)
+	}
+	return l.entry(records, index)
+}
+
+// GetByUUID returns the entry with the given UUID with an inclusion proof
+// for the current tree.
+func (l *FileLog) GetByUUID(uuid string) (signing.LogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := l.readRecords()
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range records {
+		if hex.EncodeToString(rfc6962.DefaultHasher.HashLeaf(r.Body)) == uuid {
+			return l.entry(records, int64(i))
+		}
+	}
+	return nil, fmt.Errorf("log entry %q not found", uuid)
+}
+
+// Checkpoint returns a signed checkpoint for the current tree.
+func (l *FileLog) Checkpoint() ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := l.readRecords()
+	if err != nil {
+		return nil, err
+	}
+	return l.checkpoint(leafHashes(records))
+}
+
+// Verify verifies that the entry is included in the log. The signed entry
+// timestamp is verified and the entry is checked against the current tree
+// of the log.
+func (l *FileLog) Verify(e signing.LogEntry) error {
+	v, err := tlog.NewVerifier(l.pub)
+	if err != nil {
+		return err
+	}
+	if err := v.VerifySET(e); err != nil {
+		return err
+	}
+
+	current, err := l.Get(e.LogIndex())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current.Body(), e.Body()) {
+		return fmt.Errorf("log entry %d does not match the log", e.LogIndex())
+	}
+	return v.VerifyInclusion(current, nil)
+}
+
+// entry returns the entry at index with an inclusion proof for the tree of
+// the given records.
+func (l *FileLog) entry(records []fileLogRecord, index int64) (*fileLogEntry, error) {
+	hashes := leafHashes(records)
+	checkpoint, err := l.checkpoint(hashes)
+	if err != nil {
+		return nil, err
+	}
+	return &fileLogEntry{
+		logID:  l.logID,
+		index:  index,
+		record: records[index],
+		proof: &signing.InclusionProof{
+			LogIndex:   index,
+			TreeSize:   int64(len(hashes)),
+			RootHash:   merkleRoot(hashes),
+			Hashes:     merklePath(int(index), hashes),
+			Checkpoint: string(checkpoint),
+		},
+	}, nil
+}
+
+// checkpoint returns a signed checkpoint for the tree with the given leaf
+// hashes.
+func (l *FileLog) checkpoint(hashes [][]byte) ([]byte, error) {
+	sc, err := util.CreateSignedCheckpoint(util.Checkpoint{
+		Origin: fileLogOrigin,
+		Size:   uint64(len(hashes)),
+		Hash:   merkleRoot(hashes),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating checkpoint: %w", err)
+	}
+	if _, err := sc.Sign("local", l.signer, options.WithContext(context.Background())); err != nil {
+		return nil, fmt.Errorf("signing checkpoint: %w", err)
+	}
+	return sc.SignedNote.MarshalText()
+}
+
+func (l *FileLog) readRecords() ([]fileLogRecord, error) {
+	f, err := os.Open(filepath.Join(l.dir, fileLogEntries))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening log: %w", err)
+	}
+	defer f.Close()
+
+	var records []fileLogRecord
+	dec := json.NewDecoder(f)
+	for {
+		var r fileLogRecord
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading log entry %d: %w", len(records), err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func (l *FileLog) appendRecord(r fileLogRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshalling log entry: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(l.dir, fileLogEntries), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening log: %w", err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing log entry: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing log entry: %w", err)
+	}
+	return f.Close()
+}
+
+// intotoBody returns the canonicalized log entry body for the attestation. It
+// follows the format of the Rekor intoto v0.0.1 type.
+func intotoBody(att signing.Attestation) ([]byte, error) {
+	digest := sha256.Sum256(att.Bytes())
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "intoto",
+		"spec": map[string]interface{}{
+			"content": map[string]interface{}{
+				"envelope": string(att.Bytes()),
+				"hash": map[string]string{
+					"algorithm": "sha256",
+					"value":     hex.EncodeToString(digest[:]),
+				},
+			},
+			"publicKey": att.Cert(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling log entry body: %w", err)
+	}
+	return jsoncanonicalizer.Transform(body)
+}
+
+func leafHashes(records []fileLogRecord) [][]byte {
+	hashes := make([][]byte, 0, len(records))
+	for _, r := range records {
+		hashes = append(hashes, rfc6962.DefaultHasher.HashLeaf(r.Body))
+	}
+	return hashes
+}
+
+// merkleRoot returns the Merkle tree hash for the leaf hashes as defined in
+// RFC 6962 section 2.1.
+func merkleRoot(hashes [][]byte) []byte {
+	switch len(hashes) {
+	case 0:
+		return rfc6962.DefaultHasher.EmptyRoot()
+	case 1:
+		return hashes[0]
+	}
+	k := splitPoint(len(hashes))
+	return rfc6962.DefaultHasher.HashChildren(merkleRoot(hashes[:k]), merkleRoot(hashes[k:]))
+}
+
+// merklePath returns the Merkle audit path for the leaf at index m as defined
+// in RFC 6962 section 2.1.1, ordered from the leaf to the root.
+func merklePath(m int, hashes [][]byte) [][]byte {
+	if len(hashes) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(hashes))
+	if m < k {
+		return append(merklePath(m, hashes[:k]), merkleRoot(hashes[k:]))
+	}
+	return append(merklePath(m-k, hashes[k:]), merkleRoot(hashes[:k]))
+}
+
+// splitPoint returns the largest power of two smaller than n.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
@@ -0,0 +1,182 @@
+package local
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/bundle"
+	"github.com/slsa-framework/slsa-github-generator/signing/tlog"
+)
+
+func newTestFileLog(t *testing.T, dir string, priv crypto.PrivateKey) *FileLog {
+	l, err := NewFileLog(dir, priv)
+	if err != nil {
+		t.Fatalf("NewFileLog: %v", err)
+	}
+	l.now = func() time.Time { return time.Unix(1672531200, 0) }
+	return l
+}
+
+func testAttestations(t *testing.T, n int) []signing.Attestation {
+	s, err := NewKeySigner(mustGenerateKey(t, "ecdsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var atts []signing.Attestation
+	for i := 0; i < n; i++ {
+		att, err := s.Sign(context.Background(), &intoto.Statement{
+			StatementHeader: intoto.StatementHeader{
+				Type:          intoto.StatementInTotoV01,
+				PredicateType: "https://example.com/predicate",
+				Subject: []intoto.Subject{
+					{Name: strings.Repeat("a", i+1)},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		atts = append(atts, att)
+	}
+	return atts
+}
+
+func TestFileLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestFileLog(t, dir, priv)
+
+	v, err := tlog.NewVerifier(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atts := testAttestations(t, 6)
+	var entries []signing.LogEntry
+	for i, att := range atts {
+		e, err := l.Upload(ctx, att)
+		if err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		if got, want := e.LogIndex(), int64(i); got != want {
+			t.Errorf("unexpected log index, got: %d, want: %d", got, want)
+		}
+		if got, want := e.IntegratedTime(), int64(1672531200); got != want {
+			t.Errorf("unexpected integrated time, got: %d, want: %d", got, want)
+		}
+
+		// The entry returned by Upload is verifiable offline.
+		if err := v.Verify(e, nil); err != nil {
+			t.Errorf("verifying entry %d: %v", i, err)
+		}
+		entries = append(entries, e)
+	}
+
+	// Reopen the log and check older entries against the current tree.
+	l = newTestFileLog(t, dir, priv)
+	checkpoint, err := l.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if err := l.Verify(e); err != nil {
+			t.Errorf("Verify(%d): %v", i, err)
+		}
+
+		got, err := l.GetByUUID(e.UUID())
+		if err != nil {
+			t.Fatalf("GetByUUID: %v", err)
+		}
+		if got.LogIndex() != e.LogIndex() {
+			t.Errorf("unexpected log index, got: %d, want: %d", got.LogIndex(), e.LogIndex())
+		}
+		if err := v.Verify(got, checkpoint); err != nil {
+			t.Errorf("verifying entry %d against checkpoint: %v", i, err)
+		}
+	}
+
+	// Entries can be included in a bundle.
+	if _, err := bundle.New(atts[0], entries[0]); err != nil {
+		t.Errorf("creating bundle: %v", err)
+	}
+
+	if _, err := l.Get(int64(len(entries))); err == nil {
+		t.Errorf("expected error for missing entry")
+	}
+}
+
+func TestFileLog_tampered(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestFileLog(t, dir, priv)
+
+	v, err := tlog.NewVerifier(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atts := testAttestations(t, 4)
+	var entries []signing.LogEntry
+	for _, att := range atts[:3] {
+		e, err := l.Upload(ctx, att)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	checkpoint, err := l.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the body of the second entry on disk.
+	records, err := l.readRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records[1].Body, err = intotoBody(atts[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, fileLogEntries)); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := l.appendRecord(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Verify(entries[1]); err == nil {
+		t.Errorf("expected error for rewritten entry")
+	}
+
+	// The rewritten tree does not match the checkpoint from before.
+	e, err := l.Get(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(e, checkpoint); err == nil {
+		t.Errorf("expected error for rewritten tree")
+	}
+}
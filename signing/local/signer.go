@@ -0,0 +1,204 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package local implements signing of provenance statements using locally
+// stored keys and a transparency log stored on disk. It can be used where
+// keyless signing via Fulcio and the public Rekor instance are not
+// available, e.g. on self-hosted CI, developer machines and in tests.
+package local
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+)
+
+// KeySigner is used to sign provenance statements using a local private key.
+type KeySigner struct {
+	signer signature.Signer
+	pub    crypto.PublicKey
+	keyID  string
+	cert   []byte
+}
+
+// attestation is a signed attestation.
+type attestation struct {
+	cert []byte
+	att  []byte
+}
+
+// Bytes returns the signed attestation as an encoded DSSE JSON envelope.
+func (a *attestation) Bytes() []byte {
+	return a.att
+}
+
+// Cert returns the certificate used to sign the attestation.
+func (a *attestation) Cert() []byte {
+	return a.cert
+}
+
+// NewKeySigner creates a new KeySigner using the given private key. ECDSA
+// P-256, RSA and Ed25519 keys are supported.
+func NewKeySigner(priv crypto.PrivateKey) (*KeySigner, error) {
+	var pub crypto.PublicKey
+	switch k := priv.(type) {
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %q, expected P-256", k.Curve.Params().Name)
+		}
+		pub = k.Public()
+	case *rsa.PrivateKey:
+		pub = k.Public()
+	case ed25519.PrivateKey:
+		pub = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+
+	s, err := signature.LoadSigner(priv, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("loading signer: %w", err)
+	}
+
+	keyID, err := KeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySigner{
+		signer: s,
+		pub:    pub,
+		keyID:  keyID,
+	}, nil
+}
+
+// NewKeySignerFromFile creates a new KeySigner using the PEM-encoded private
+// key at path. If the key is encrypted, password is used to decrypt it.
+func NewKeySignerFromFile(path string, password []byte) (*KeySigner, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("reading private key: %w", err)
+	}
+	return NewKeySignerFromPEM(b, password)
+}
+
+// NewKeySignerFromPEM creates a new KeySigner using the PEM-encoded private
+// key. If the key is encrypted, password is used to decrypt it.
+func NewKeySignerFromPEM(keyPEM, password []byte) (*KeySigner, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("decoding private key: no PEM block found")
+	}
+	switch cryptoutils.PEMType(block.Type) {
+	case cryptoutils.EncryptedSigstorePrivateKeyPEMType, "ENCRYPTED COSIGN PRIVATE KEY":
+		if len(password) == 0 {
+			return nil, fmt.Errorf("private key is encrypted but no password was given")
+		}
+	}
+
+	priv, err := cryptoutils.UnmarshalPEMToPrivateKey(keyPEM, cryptoutils.StaticPasswordFunc(password))
+	if err != nil {
+		return nil, fmt.Errorf("decoding private key: %w", err)
+	}
+	return NewKeySigner(priv)
+}
+
+// WithCert sets the PEM-encoded certificate for the signing key that is
+// included in the signed attestations.
+func (s *KeySigner) WithCert(cert []byte) (*KeySigner, error) {
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(cert)
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("invalid certificate, expected PEM encoded certificate")
+	}
+	if err := cryptoutils.EqualKeys(certs[0].PublicKey, s.pub); err != nil {
+		return nil, fmt.Errorf("certificate does not match the signing key: %w", err)
+	}
+	s.cert = cert
+	return s, nil
+}
+
+// KeyID returns the ID of the signing key.
+func (s *KeySigner) KeyID() string {
+	return s.keyID
+}
+
+// PublicKey returns the public key of the signing key.
+func (s *KeySigner) PublicKey() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs the given provenance statement and returns the signed
+// attestation.
+func (s *KeySigner) Sign(_ context.Context, p *intoto.Statement) (signing.Attestation, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling json: %w", err)
+	}
+
+	sig, err := s.signer.SignMessage(bytes.NewReader(dsse.PAE(intoto.PayloadType, payload)))
+	if err != nil {
+		return nil, fmt.Errorf("signing message: %w", err)
+	}
+
+	att, err := json.Marshal(&envelope.Envelope{
+		PayloadType: intoto.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []envelope.Signature{
+			{
+				KeyID: s.keyID,
+				Sig:   base64.StdEncoding.EncodeToString(sig),
+				Cert:  string(s.cert),
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling envelope: %w", err)
+	}
+
+	return &attestation{
+		att:  att,
+		cert: s.cert,
+	}, nil
+}
+
+// KeyID returns the key ID for the public key, which is the hex-encoded
+// SHA256 digest of its DER-encoded PKIX form.
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := cryptoutils.MarshalPublicKeyToDER(pub)
+	if err != nil {
+		return "", fmt.Errorf("marshalling public key: %w", err)
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
@@ -0,0 +1,234 @@
+package local
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+)
+
+func mustGenerateKey(t *testing.T, keyType string) crypto.Signer {
+	var k crypto.Signer
+	var err error
+	switch keyType {
+	case "ecdsa":
+		k, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ecdsa-p384":
+		k, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "rsa":
+		k, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ed25519":
+		_, k, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unknown key type %q", keyType)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func mustCert(t *testing.T, k crypto.Signer) []byte {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-1 * time.Minute),
+		NotAfter:     time.Now().Add(10 * time.Minute),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, k.Public(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestKeySigner_Sign(t *testing.T) {
+	testCases := []struct {
+		name     string
+		keyType  string
+		withCert bool
+	}{
+		{
+			name:    "ecdsa",
+			keyType: "ecdsa",
+		},
+		{
+			name:    "rsa",
+			keyType: "rsa",
+		},
+		{
+			name:    "ed25519",
+			keyType: "ed25519",
+		},
+		{
+			name:     "ecdsa with cert",
+			keyType:  "ecdsa",
+			withCert: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			k := mustGenerateKey(t, tc.keyType)
+			s, err := NewKeySigner(k)
+			if err != nil {
+				t.Fatalf("NewKeySigner: %v", err)
+			}
+
+			var cert []byte
+			if tc.withCert {
+				cert = mustCert(t, k)
+				if _, err := s.WithCert(cert); err != nil {
+					t.Fatalf("WithCert: %v", err)
+				}
+			}
+
+			stmt := &intoto.Statement{
+				StatementHeader: intoto.StatementHeader{
+					Type:          intoto.StatementInTotoV01,
+					PredicateType: "https://example.com/predicate",
+				},
+			}
+			att, err := s.Sign(context.Background(), stmt)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if diff := cmp.Diff(cert, att.Cert()); diff != "" {
+				t.Errorf("unexpected cert (-want +got):\n%s", diff)
+			}
+
+			v, err := envelope.Verify(att.Bytes(), &envelope.VerifyOptions{
+				PublicKeys: []crypto.PublicKey{k.Public()},
+			})
+			if err != nil {
+				t.Fatalf("verifying envelope: %v", err)
+			}
+			if len(v.Signatures) != 1 {
+				t.Fatalf("expected one signature, got %d", len(v.Signatures))
+			}
+
+			wantKeyID, err := KeyID(k.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := v.Signatures[0].KeyID; got != wantKeyID {
+				t.Errorf("unexpected key ID, got: %q, want: %q", got, wantKeyID)
+			}
+			if tc.withCert {
+				got, err := envelope.GetCertFromEnvelope(att.Bytes())
+				if err != nil {
+					t.Fatalf("GetCertFromEnvelope: %v", err)
+				}
+				if diff := cmp.Diff(cert, got); diff != "" {
+					t.Errorf("unexpected cert in the envelope (-want +got):\n%s", diff)
+				}
+			}
+
+			if diff := cmp.Diff(*stmt, *v.Statement); diff != "" {
+				t.Errorf("unexpected statement (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewKeySigner_unsupportedCurve(t *testing.T) {
+	if _, err := NewKeySigner(mustGenerateKey(t, "ecdsa-p384")); err == nil {
+		t.Errorf("expected error for P-384 key")
+	}
+}
+
+func TestKeySigner_WithCert_mismatch(t *testing.T) {
+	s, err := NewKeySigner(mustGenerateKey(t, "ecdsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WithCert(mustCert(t, mustGenerateKey(t, "ecdsa"))); err == nil {
+		t.Errorf("expected error for certificate of a different key")
+	}
+}
+
+func TestNewKeySignerFromFile(t *testing.T) {
+	password := []byte("hunter2")
+
+	encPEM, _, err := cryptoutils.GeneratePEMEncodedECDSAKeyPair(elliptic.P256(), cryptoutils.StaticPasswordFunc(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainPEM, err := cryptoutils.MarshalPrivateKeyToPEM(mustGenerateKey(t, "ed25519"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		key      []byte
+		password []byte
+		wantErr  bool
+	}{
+		{
+			name: "unencrypted",
+			key:  plainPEM,
+		},
+		{
+			name:     "encrypted",
+			key:      encPEM,
+			password: password,
+		},
+		{
+			name:    "encrypted without password",
+			key:     encPEM,
+			wantErr: true,
+		},
+		{
+			name:     "encrypted with wrong password",
+			key:      encPEM,
+			password: []byte("wrong"),
+			wantErr:  true,
+		},
+		{
+			name:    "not PEM",
+			key:     []byte("not a key"),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(path, tc.key, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewKeySignerFromFile(path, tc.password)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error, got: %v, wantErr: %v", err, tc.wantErr)
+			}
+			if err == nil && s.KeyID() == "" {
+				t.Errorf("expected a key ID")
+			}
+		})
+	}
+}
@@ -32,6 +32,40 @@ type LogEntry interface {
 
 	// UUID return the uuid of the transparency log entry.
 	UUID() string
+
+	// IntegratedTime returns the time the entry was added to the
+	// transparency log as a Unix timestamp in seconds.
+	IntegratedTime() int64
+
+	// Body returns the canonicalized body of the transparency log entry.
+	Body() []byte
+
+	// SignedEntryTimestamp returns the signed entry timestamp (SET), the
+	// transparency log's promise to include the entry.
+	SignedEntryTimestamp() []byte
+
+	// InclusionProof returns the Merkle tree inclusion proof of the
+	// transparency log entry or nil if there is none.
+	InclusionProof() *InclusionProof
+}
+
+// InclusionProof is a Merkle tree inclusion proof of a transparency log
+// entry.
+type InclusionProof struct {
+	// LogIndex is the index of the entry in the tree.
+	LogIndex int64
+
+	// TreeSize is the size of the tree the proof is for.
+	TreeSize int64
+
+	// RootHash is the root hash of the tree the proof is for.
+	RootHash []byte
+
+	// Hashes are the hashes of the proof ordered from the leaf to the root.
+	Hashes [][]byte
+
+	// Checkpoint is the signed checkpoint of the tree, if any.
+	Checkpoint string
 }
 
 // TransparencyLog allows interaction with a transparency log.
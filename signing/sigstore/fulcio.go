@@ -17,15 +17,25 @@ package sigstore
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/ctutil"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
 	"github.com/sigstore/cosign/cmd/cosign/cli/fulcio"
 	"github.com/sigstore/cosign/cmd/cosign/cli/options"
 	"github.com/sigstore/cosign/pkg/providers"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
 	"github.com/sigstore/sigstore/pkg/signature/dsse"
 	"github.com/slsa-framework/slsa-github-generator/signing"
 	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 )
@@ -38,9 +48,12 @@ const (
 
 // Fulcio is used to sign provenance statements using Fulcio.
 type Fulcio struct {
-	fulcioAddr   string
-	oidcIssuer   string
-	oidcClientID string
+	fulcioAddr    string
+	oidcIssuer    string
+	oidcClientID  string
+	roots         []*x509.Certificate
+	intermediates []*x509.Certificate
+	ctLogKey      crypto.PublicKey
 }
 
 // attestation is a signed attestation.
@@ -74,6 +87,29 @@ func NewFulcio(fulcioAddr, oidcIssuer, oidcClientID string) *Fulcio {
 	}
 }
 
+// WithTrustRoot configures the Fulcio instance to use the given trust root.
+// Addresses set in the trust root replace the current ones. If the trust root
+// has Fulcio certificates or a CT log key, the issued certificates are
+// verified against them. A nil trust root is ignored.
+func (s *Fulcio) WithTrustRoot(tr *trustroot.TrustRoot) *Fulcio {
+	if tr == nil {
+		return s
+	}
+	if tr.FulcioURL != "" {
+		s.fulcioAddr = tr.FulcioURL
+	}
+	if tr.OIDCIssuer != "" {
+		s.oidcIssuer = tr.OIDCIssuer
+	}
+	if tr.OIDCClientID != "" {
+		s.oidcClientID = tr.OIDCClientID
+	}
+	s.roots = tr.FulcioRoots
+	s.intermediates = tr.FulcioIntermediates
+	s.ctLogKey = tr.CTLogPublicKey
+	return s
+}
+
 // Sign signs the given provenance statement and returns the signed
 // attestation.
 func (s *Fulcio) Sign(ctx context.Context, p *intoto.Statement) (signing.Attestation, error) {
@@ -95,6 +131,9 @@ func (s *Fulcio) Sign(ctx context.Context, p *intoto.Statement) (signing.Attesta
 	if err != nil {
 		return nil, fmt.Errorf("creating fulcio signer: %w", err)
 	}
+	if err := s.verifyCertificate(k.Cert, k.Chain, k.SCT); err != nil {
+		return nil, fmt.Errorf("verifying fulcio certificate: %w", err)
+	}
 	wrappedSigner := dsse.WrapSigner(k, intoto.PayloadType)
 
 	signedAtt, err := wrappedSigner.SignMessage(bytes.NewReader(attBytes))
@@ -114,3 +153,104 @@ func (s *Fulcio) Sign(ctx context.Context, p *intoto.Statement) (signing.Attesta
 		cert: k.Cert,
 	}, nil
 }
+
+// verifyCertificate verifies the certificate issued by Fulcio against the
+// configured trust root. The certificate chain is verified if roots are
+// configured and the SCT is verified if a CT log key is configured.
+func (s *Fulcio) verifyCertificate(certPEM, chainPEM, rawSCT []byte) error {
+	if len(s.roots) == 0 && s.ctLogKey == nil {
+		return nil
+	}
+
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(certPEM)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("invalid certificate, expected PEM encoded certificate")
+	}
+	cert := certs[0]
+	chain, err := cryptoutils.UnmarshalCertificatesFromPEM(chainPEM)
+	if err != nil {
+		return fmt.Errorf("decoding certificate chain: %w", err)
+	}
+
+	if len(s.roots) > 0 {
+		rootPool := x509.NewCertPool()
+		for _, c := range s.roots {
+			rootPool.AddCert(c)
+		}
+		intermediatePool := x509.NewCertPool()
+		for _, c := range s.intermediates {
+			intermediatePool.AddCert(c)
+		}
+		for _, c := range chain {
+			// Only Fulcio's own roots are trusted.
+			if !bytes.Equal(c.RawIssuer, c.RawSubject) {
+				intermediatePool.AddCert(c)
+			}
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:         rootPool,
+			Intermediates: intermediatePool,
+			CurrentTime:   cert.NotBefore,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}); err != nil {
+			return fmt.Errorf("verifying certificate chain: %w", err)
+		}
+	}
+
+	if s.ctLogKey != nil {
+		if err := verifySCT(s.ctLogKey, certPEM, chainPEM, rawSCT); err != nil {
+			return fmt.Errorf("verifying SCT: %w", err)
+		}
+	}
+	return nil
+}
+
+// verifySCT verifies the SCT of the certificate using the public key of the
+// CT log. The SCT is either embedded in the certificate or detached.
+func verifySCT(pub crypto.PublicKey, certPEM, chainPEM, rawSCT []byte) error {
+	der, err := cryptoutils.MarshalPublicKeyToDER(pub)
+	if err != nil {
+		return fmt.Errorf("marshalling public key: %w", err)
+	}
+	logID := sha256.Sum256(der)
+
+	// NOTE: The certificates are parsed with the CT fork of crypto/x509.
+	cert, err := x509util.CertificateFromPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("decoding certificate: %w", err)
+	}
+	embedded, err := x509util.ParseSCTsFromCertificate(certPEM)
+	if err != nil {
+		return fmt.Errorf("decoding embedded SCTs: %w", err)
+	}
+
+	if len(embedded) > 0 {
+		chain, err := x509util.CertificatesFromPEM(chainPEM)
+		if err != nil || len(chain) == 0 {
+			return errors.New("no certificate chain found")
+		}
+		for _, sct := range embedded {
+			if sct.LogID.KeyID != logID {
+				continue
+			}
+			return ctutil.VerifySCT(pub, []*ctx509.Certificate{cert, chain[0]}, sct, true)
+		}
+		return errors.New("no embedded SCT found for the CT log")
+	}
+
+	if len(rawSCT) == 0 {
+		return errors.New("no SCT found")
+	}
+	var resp ct.AddChainResponse
+	if err := json.Unmarshal(rawSCT, &resp); err != nil {
+		return fmt.Errorf("decoding SCT: %w", err)
+	}
+	sct, err := resp.ToSignedCertificateTimestamp()
+	if err != nil {
+		return fmt.Errorf("decoding SCT: %w", err)
+	}
+	if sct.LogID.KeyID != logID {
+		return errors.New("SCT was not issued by the CT log")
+	}
+	return ctutil.VerifySCT(pub, []*ctx509.Certificate{cert}, sct, false)
+}
@@ -0,0 +1,225 @@
+package sigstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/tls"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+)
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestCert creates a certificate for key signed by parent. The
+// certificate is self-signed if parent is nil.
+func newTestCert(t *testing.T, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) *x509.Certificate {
+	serial := time.Now().UnixNano()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: fmt.Sprintf("test %d", serial)},
+		NotBefore:    time.Now().Add(-1 * time.Minute),
+		NotAfter:     time.Now().Add(10 * time.Minute),
+	}
+	if isCA {
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		tmpl.BasicConstraintsValid = true
+		tmpl.IsCA = true
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func certsPEM(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return b
+}
+
+// newTestSCT returns a detached SCT for cert signed by the CT log key.
+func newTestSCT(t *testing.T, key *ecdsa.PrivateKey, cert *x509.Certificate) []byte {
+	der, err := cryptoutils.MarshalPublicKeyToDER(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctCert, err := ctx509.ParseCertificate(cert.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		LogID:      ct.LogID{KeyID: sha256.Sum256(der)},
+		Timestamp:  uint64(time.Now().UnixMilli()),
+	}
+	leaf, err := ct.MerkleTreeLeafFromChain([]*ctx509.Certificate{ctCert}, ct.X509LogEntryType, sct.Timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{Leaf: *leaf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(input)
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := tls.Marshal(tls.DigitallySigned{
+		Algorithm: tls.SignatureAndHashAlgorithm{
+			Hash:      tls.SHA256,
+			Signature: tls.ECDSA,
+		},
+		Signature: sig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(ct.AddChainResponse{
+		SCTVersion: sct.SCTVersion,
+		ID:         sct.LogID.KeyID[:],
+		Timestamp:  sct.Timestamp,
+		Signature:  ds,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFulcio_verifyCertificate(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCert(t, rootKey, nil, nil, true)
+	intermediateKey := newTestKey(t)
+	intermediate := newTestCert(t, intermediateKey, root, rootKey, true)
+	leaf := newTestCert(t, newTestKey(t), intermediate, intermediateKey, false)
+
+	otherKey := newTestKey(t)
+	otherRoot := newTestCert(t, otherKey, nil, nil, true)
+
+	ctKey := newTestKey(t)
+	otherCTKey := newTestKey(t)
+
+	testCases := []struct {
+		name      string
+		trustRoot *trustroot.TrustRoot
+		chain     []byte
+		sct       []byte
+		err       bool
+	}{
+		{
+			name: "no trust root",
+		},
+		{
+			name:      "chain",
+			trustRoot: &trustroot.TrustRoot{FulcioRoots: []*x509.Certificate{root}},
+			chain:     certsPEM(intermediate, root),
+		},
+		{
+			name: "intermediate from trust root",
+			trustRoot: &trustroot.TrustRoot{
+				FulcioRoots:         []*x509.Certificate{root},
+				FulcioIntermediates: []*x509.Certificate{intermediate},
+			},
+		},
+		{
+			name:      "untrusted root",
+			trustRoot: &trustroot.TrustRoot{FulcioRoots: []*x509.Certificate{otherRoot}},
+			chain:     certsPEM(intermediate, root),
+			err:       true,
+		},
+		{
+			name:      "root from chain is not trusted",
+			trustRoot: &trustroot.TrustRoot{FulcioRoots: []*x509.Certificate{otherRoot}},
+			chain:     certsPEM(intermediate, otherRoot, root),
+			err:       true,
+		},
+		{
+			name:      "SCT",
+			trustRoot: &trustroot.TrustRoot{CTLogPublicKey: ctKey.Public()},
+			chain:     certsPEM(intermediate, root),
+			sct:       newTestSCT(t, ctKey, leaf),
+		},
+		{
+			name:      "SCT from other log",
+			trustRoot: &trustroot.TrustRoot{CTLogPublicKey: ctKey.Public()},
+			chain:     certsPEM(intermediate, root),
+			sct:       newTestSCT(t, otherCTKey, leaf),
+			err:       true,
+		},
+		{
+			name:      "SCT for other certificate",
+			trustRoot: &trustroot.TrustRoot{CTLogPublicKey: ctKey.Public()},
+			chain:     certsPEM(intermediate, root),
+			sct:       newTestSCT(t, ctKey, intermediate),
+			err:       true,
+		},
+		{
+			name:      "no SCT",
+			trustRoot: &trustroot.TrustRoot{CTLogPublicKey: ctKey.Public()},
+			chain:     certsPEM(intermediate, root),
+			err:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := NewDefaultFulcio().WithTrustRoot(tc.trustRoot)
+			err := f.verifyCertificate(certsPEM(leaf), tc.chain, tc.sct)
+			if tc.err != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFulcio_WithTrustRoot(t *testing.T) {
+	f := NewDefaultFulcio().WithTrustRoot(&trustroot.TrustRoot{
+		FulcioURL: "https://fulcio.example.com",
+	})
+	if got, want := f.fulcioAddr, "https://fulcio.example.com"; got != want {
+		t.Errorf("unexpected fulcio address, got: %q, want: %q", got, want)
+	}
+	if got, want := f.oidcIssuer, defaultOIDCIssuer; got != want {
+		t.Errorf("unexpected OIDC issuer, got: %q, want: %q", got, want)
+	}
+}
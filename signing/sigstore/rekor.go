@@ -2,23 +2,51 @@ package sigstore
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/sigstore/cosign/pkg/cosign"
 	"github.com/sigstore/rekor/pkg/client"
+	genclient "github.com/sigstore/rekor/pkg/generated/client"
 	"github.com/sigstore/rekor/pkg/generated/client/entries"
 	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/rekor/pkg/types"
+	"github.com/sigstore/rekor/pkg/types/intoto"
+	intotov001 "github.com/sigstore/rekor/pkg/types/intoto/v0.0.1"
 	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/tlog"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
 )
 
 const (
 	// DefaultRekorAddr is the default rekor base URL.
 	DefaultRekorAddr = "https://rekor.sigstore.dev"
+
+	// DefaultRekorAttempts is the default number of attempts made for each
+	// request to Rekor.
+	DefaultRekorAttempts = 5
+
+	// DefaultRekorBackoff is the default delay before the first retry of a
+	// failed request to Rekor. The delay is doubled after each attempt.
+	DefaultRekorBackoff = time.Second
+
+	// DefaultRekorTimeout is the default deadline for uploading an
+	// attestation to Rekor, including all retries.
+	DefaultRekorTimeout = 2 * time.Minute
 )
 
 // Rekor implements TransparencyLog.
 type Rekor struct {
 	rekorAddr string
+	attempts  int
+	backoff   time.Duration
+	timeout   time.Duration
+	verifier  *tlog.Verifier
 }
 
 type rekorEntryAnon struct {
@@ -47,6 +75,69 @@ func (e *rekorEntryAnon) UUID() string {
 	return e.uuid
 }
 
+// IntegratedTime implements LogEntry.IntegratedTime.
+func (e *rekorEntryAnon) IntegratedTime() int64 {
+	if e.entry.IntegratedTime == nil {
+		return 0
+	}
+	return *e.entry.IntegratedTime
+}
+
+// Body implements LogEntry.Body.
+func (e *rekorEntryAnon) Body() []byte {
+	// NOTE: The body is returned by Rekor as a base64 encoded string.
+	bodyStr, ok := e.entry.Body.(string)
+	if !ok {
+		return nil
+	}
+	body, err := base64.StdEncoding.DecodeString(bodyStr)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// SignedEntryTimestamp implements LogEntry.SignedEntryTimestamp.
+func (e *rekorEntryAnon) SignedEntryTimestamp() []byte {
+	if e.entry.Verification == nil {
+		return nil
+	}
+	return e.entry.Verification.SignedEntryTimestamp
+}
+
+// InclusionProof implements LogEntry.InclusionProof.
+func (e *rekorEntryAnon) InclusionProof() *signing.InclusionProof {
+	if e.entry.Verification == nil {
+		return nil
+	}
+	p := e.entry.Verification.InclusionProof
+	if p == nil || p.LogIndex == nil || p.RootHash == nil || p.TreeSize == nil {
+		return nil
+	}
+
+	// NOTE: Rekor returns hex encoded hashes.
+	rootHash, err := hex.DecodeString(*p.RootHash)
+	if err != nil {
+		return nil
+	}
+	proof := &signing.InclusionProof{
+		LogIndex: *p.LogIndex,
+		TreeSize: *p.TreeSize,
+		RootHash: rootHash,
+	}
+	for _, h := range p.Hashes {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil
+		}
+		proof.Hashes = append(proof.Hashes, b)
+	}
+	if p.Checkpoint != nil {
+		proof.Checkpoint = *p.Checkpoint
+	}
+	return proof
+}
+
 // NewDefaultRekor returns a new Rekor instance for the Rekor public instance.
 func NewDefaultRekor() *Rekor {
 	return NewRekor(DefaultRekorAddr)
@@ -56,40 +147,208 @@ func NewDefaultRekor() *Rekor {
 func NewRekor(rekorAddr string) *Rekor {
 	return &Rekor{
 		rekorAddr: rekorAddr,
+		attempts:  DefaultRekorAttempts,
+		backoff:   DefaultRekorBackoff,
+		timeout:   DefaultRekorTimeout,
+	}
+}
+
+// WithRetry sets the number of attempts made for each request to Rekor and
+// the delay before the first retry. The delay is doubled after each failed
+// attempt.
+func (r *Rekor) WithRetry(attempts int, backoff time.Duration) *Rekor {
+	if attempts < 1 {
+		attempts = 1
+	}
+	r.attempts = attempts
+	r.backoff = backoff
+	return r
+}
+
+// WithTimeout sets the deadline for uploading an attestation, including all
+// retries. A zero timeout means no deadline.
+func (r *Rekor) WithTimeout(timeout time.Duration) *Rekor {
+	r.timeout = timeout
+	return r
+}
+
+// WithTrustRoot configures the Rekor instance to use the given trust root.
+// If the trust root has a Rekor address it replaces the current one. If it
+// has a Rekor public key, log entries are verified using that key instead of
+// the keys of the public instance. A nil trust root is ignored.
+func (r *Rekor) WithTrustRoot(tr *trustroot.TrustRoot) (*Rekor, error) {
+	if tr == nil {
+		return r, nil
+	}
+	if tr.RekorURL != "" {
+		r.rekorAddr = tr.RekorURL
+	}
+	if tr.RekorPublicKey != nil {
+		v, err := tlog.NewVerifier(tr.RekorPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading rekor public key: %w", err)
+		}
+		r.verifier = v
 	}
+	return r, nil
 }
 
-// Upload uploads the signed attestation to the rekor transparency log.
+// Upload uploads the signed attestation to the rekor transparency log. If the
+// attestation was already uploaded, the existing entry is returned.
 func (r *Rekor) Upload(ctx context.Context, att signing.Attestation) (signing.LogEntry, error) {
-	rekorClient, err := client.GetRekorClient(r.rekorAddr)
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	// NOTE: Retries are handled here rather than by the Rekor client so that
+	// they are bounded by the context deadline.
+	rekorClient, err := client.GetRekorClient(r.rekorAddr, client.WithRetryCount(0))
 	if err != nil {
 		return nil, fmt.Errorf("creating rekor client: %w", err)
 	}
+
 	// TODO: Is it a bug that we need []byte(string(k.Cert)) or else we hit invalid PEM?
-	logEntry, err := cosign.TLogUploadInTotoAttestation(ctx, rekorClient, att.Bytes(), []byte(string(att.Cert())))
+	proposedEntry, err := types.NewProposedEntry(ctx, intoto.KIND, intotov001.APIVERSION, types.ArtifactProperties{
+		ArtifactBytes:  att.Bytes(),
+		PublicKeyBytes: [][]byte{[]byte(string(att.Cert()))},
+	})
 	if err != nil {
+		return nil, fmt.Errorf("creating rekor entry: %w", err)
+	}
+
+	var uuid string
+	var logEntry *models.LogEntryAnon
+	err = r.retry(ctx, func() error {
+		var err error
+		uuid, logEntry, err = createLogEntry(ctx, rekorClient, proposedEntry)
+		return err
+	})
+
+	var existsErr *entries.CreateLogEntryConflict
+	switch {
+	case errors.As(err, &existsErr):
+		// The entry was uploaded already, e.g. by a previous run of a
+		// release job that failed later on.
+		uuid = entryUUID(existsErr.Location.String())
+		if uuid == "" {
+			return nil, fmt.Errorf("uploading attestation: entry already exists but no location was returned: %w", err)
+		}
+		fmt.Printf("Signed attestation already exists in rekor with UUID %s.\n", uuid)
+		err = r.retry(ctx, func() error {
+			var err error
+			logEntry, err = cosign.GetTlogEntry(ctx, rekorClient, uuid)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("retrieving log entry by uuid: %w", err)
+		}
+	case err != nil:
 		return nil, fmt.Errorf("uploading attestation: %w", err)
+	default:
+		// Retrieve the entry by index to get the inclusion proof.
+		err = r.retry(ctx, func() error {
+			var err error
+			uuid, logEntry, err = getLogEntryByIndex(ctx, rekorClient, *logEntry.LogIndex)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("retrieving log uuid by index: %w", err)
+		}
+	}
+
+	e := &rekorEntryAnon{
+		entry: logEntry,
+		uuid:  uuid,
+	}
+	if r.verifier != nil {
+		err = r.verifier.Verify(e, nil)
+	} else {
+		err = cosign.VerifyTLogEntry(ctx, rekorClient, logEntry)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validating log entry: %w", err)
+	}
+
+	fmt.Printf("Uploaded signed attestation to rekor with UUID %s.\n", uuid)
+	return e, nil
+}
+
+// retry calls f until it succeeds, it returns an error that should not be
+// retried, the number of attempts is exhausted or the context is done.
+func (r *Rekor) retry(ctx context.Context, f func() error) error {
+	backoff := r.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || !retryable(err) || attempt >= r.attempts {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// retryable returns whether a request that failed with err should be
+// retried. Network errors, rate limiting and server errors are retried.
+// Other client errors, such as conflicts or bad requests, are not.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var coder interface{ Code() int }
+	if errors.As(err, &coder) && coder.Code() == http.StatusTooManyRequests {
+		return true
+	}
+	var resp interface{ IsClientError() bool }
+	if errors.As(err, &resp) {
+		return !resp.IsClientError()
+	}
+	return true
+}
+
+// createLogEntry creates a new entry in the log and returns its UUID.
+func createLogEntry(ctx context.Context, rekorClient *genclient.Rekor, pe models.ProposedEntry) (string, *models.LogEntryAnon, error) {
+	params := entries.NewCreateLogEntryParamsWithContext(ctx)
+	params.SetProposedEntry(pe)
+	resp, err := rekorClient.Entries.CreateLogEntry(params)
+	if err != nil {
+		return "", nil, err
+	}
+	for uuid, entry := range resp.Payload {
+		entry := entry
+		return uuid, &entry, nil
 	}
+	return "", nil, fmt.Errorf("empty response")
+}
 
+// getLogEntryByIndex returns the entry at the given index of the log and its
+// UUID.
+func getLogEntryByIndex(ctx context.Context, rekorClient *genclient.Rekor, index int64) (string, *models.LogEntryAnon, error) {
 	params := entries.NewGetLogEntryByIndexParamsWithContext(ctx)
-	params.SetLogIndex(*logEntry.LogIndex)
+	params.SetLogIndex(index)
 	resp, err := rekorClient.Entries.GetLogEntryByIndex(params)
 	if err != nil {
-		return nil, fmt.Errorf("retrieving log uuid by index: %w", err)
+		return "", nil, err
 	}
-	var uuid string
-	for ix, entry := range resp.Payload {
+	for uuid, entry := range resp.Payload {
 		entry := entry
-		if err := cosign.VerifyTLogEntry(ctx, rekorClient, &entry); err != nil {
-			return nil, fmt.Errorf("validating log entry: %w", err)
-		}
-		uuid = ix
-		logEntry = &entry
+		return uuid, &entry, nil
 	}
+	return "", nil, fmt.Errorf("empty response")
+}
 
-	fmt.Printf("Uploaded signed attestation to rekor with UUID %s.\n", uuid)
-	return &rekorEntryAnon{
-		entry: logEntry,
-		uuid:  uuid,
-	}, nil
+// entryUUID returns the entry UUID from the location of an entry, which has
+// the form of <rekor addr>/api/v1/log/entries/<uuid>.
+func entryUUID(location string) string {
+	return location[strings.LastIndex(location, "/")+1:]
 }
@@ -0,0 +1,314 @@
+package sigstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sigstore/rekor/pkg/generated/models"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/testutil"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/local"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRekorEntryAnon(t *testing.T) {
+	body := []byte(`{"apiVersion":"0.0.1","kind":"intoto","spec":{}}`)
+
+	e := &rekorEntryAnon{
+		uuid: "uuid",
+		entry: &models.LogEntryAnon{
+			Body:           base64.StdEncoding.EncodeToString(body),
+			IntegratedTime: ptr(int64(1672531200)),
+			LogID:          ptr("c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d"),
+			LogIndex:       ptr(int64(1234)),
+			Verification: &models.LogEntryAnonVerification{
+				SignedEntryTimestamp: []byte("set"),
+				InclusionProof: &models.InclusionProof{
+					Checkpoint: ptr("checkpoint"),
+					Hashes:     []string{"0102"},
+					LogIndex:   ptr(int64(1234)),
+					RootHash:   ptr("0a0b"),
+					TreeSize:   ptr(int64(5678)),
+				},
+			},
+		},
+	}
+
+	if got, want := e.IntegratedTime(), int64(1672531200); got != want {
+		t.Errorf("unexpected integrated time, got: %d, want: %d", got, want)
+	}
+	if diff := cmp.Diff(body, e.Body()); diff != "" {
+		t.Errorf("unexpected body (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]byte("set"), e.SignedEntryTimestamp()); diff != "" {
+		t.Errorf("unexpected SET (-want +got):\n%s", diff)
+	}
+
+	want := &signing.InclusionProof{
+		LogIndex:   1234,
+		TreeSize:   5678,
+		RootHash:   []byte{0x0a, 0x0b},
+		Hashes:     [][]byte{{0x01, 0x02}},
+		Checkpoint: "checkpoint",
+	}
+	if diff := cmp.Diff(want, e.InclusionProof()); diff != "" {
+		t.Errorf("unexpected inclusion proof (-want +got):\n%s", diff)
+	}
+}
+
+// fakeRekor is a Rekor stand-in backed by a local file log.
+type fakeRekor struct {
+	t   *testing.T
+	log *local.FileLog
+	pub crypto.PublicKey
+
+	mu sync.Mutex
+	// failures is the number of requests that fail before the server
+	// starts responding.
+	failures int
+	requests int
+	uploaded map[string]string
+}
+
+func newFakeRekor(t *testing.T, failures int) (*fakeRekor, *httptest.Server) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := local.NewFileLog(t.TempDir(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &fakeRekor{
+		t:        t,
+		log:      l,
+		pub:      priv.Public(),
+		failures: failures,
+		uploaded: map[string]string{},
+	}
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+	return r, s
+}
+
+func (r *fakeRekor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests++
+	if r.failures > 0 {
+		r.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	const entriesPath = "/api/v1/log/entries"
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == entriesPath:
+		var pe struct {
+			Spec struct {
+				Content struct {
+					Envelope string `json:"envelope"`
+				} `json:"content"`
+				PublicKey []byte `json:"publicKey"`
+			} `json:"spec"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&pe); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if uuid, ok := r.uploaded[pe.Spec.Content.Envelope]; ok {
+			w.Header().Set("Location", "http://"+req.Host+entriesPath+"/"+uuid)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"code":409,"message":"an equivalent entry already exists in the transparency log"}`)
+			return
+		}
+		e, err := r.log.Upload(req.Context(), &testutil.TestAttestation{
+			BytesVal: []byte(pe.Spec.Content.Envelope),
+			CertVal:  pe.Spec.PublicKey,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		r.uploaded[pe.Spec.Content.Envelope] = e.UUID()
+		r.writeEntry(w, http.StatusCreated, e)
+	case req.Method == http.MethodGet && req.URL.Path == entriesPath:
+		index, err := strconv.ParseInt(req.URL.Query().Get("logIndex"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e, err := r.log.Get(index)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		r.writeEntry(w, http.StatusOK, e)
+	case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, entriesPath+"/"):
+		e, err := r.log.GetByUUID(strings.TrimPrefix(req.URL.Path, entriesPath+"/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		r.writeEntry(w, http.StatusOK, e)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *fakeRekor) writeEntry(w http.ResponseWriter, status int, e signing.LogEntry) {
+	p := e.InclusionProof()
+	proof := &models.InclusionProof{
+		Checkpoint: ptr(p.Checkpoint),
+		Hashes:     []string{},
+		LogIndex:   ptr(p.LogIndex),
+		RootHash:   ptr(hex.EncodeToString(p.RootHash)),
+		TreeSize:   ptr(p.TreeSize),
+	}
+	for _, h := range p.Hashes {
+		proof.Hashes = append(proof.Hashes, hex.EncodeToString(h))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(models.LogEntry{
+		e.UUID(): models.LogEntryAnon{
+			Body:           base64.StdEncoding.EncodeToString(e.Body()),
+			IntegratedTime: ptr(e.IntegratedTime()),
+			LogID:          ptr(e.ID()),
+			LogIndex:       ptr(e.LogIndex()),
+			Verification: &models.LogEntryAnonVerification{
+				SignedEntryTimestamp: e.SignedEntryTimestamp(),
+				InclusionProof:       proof,
+			},
+		},
+	}); err != nil {
+		r.t.Errorf("writing response: %v", err)
+	}
+}
+
+func TestRekor_Upload(t *testing.T) {
+	att := &testutil.TestAttestation{
+		BytesVal: []byte(`{"payloadType":"application/vnd.in-toto+json","payload":"","signatures":[]}`),
+		CertVal:  []byte("cert"),
+	}
+
+	testCases := []struct {
+		name     string
+		failures int
+		attempts int
+		timeout  time.Duration
+		uploads  int
+		requests int
+		err      bool
+	}{
+		{
+			name:     "upload",
+			attempts: 1,
+			uploads:  1,
+			requests: 2,
+		},
+		{
+			name:     "retry",
+			failures: 3,
+			attempts: 4,
+			uploads:  1,
+			requests: 5,
+		},
+		{
+			name:     "retries exhausted",
+			failures: 3,
+			attempts: 3,
+			uploads:  1,
+			requests: 3,
+			err:      true,
+		},
+		{
+			name:     "deadline exceeded",
+			failures: 100,
+			attempts: 100,
+			timeout:  50 * time.Millisecond,
+			uploads:  1,
+			err:      true,
+		},
+		{
+			name:     "existing entry",
+			attempts: 1,
+			uploads:  2,
+			requests: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, s := newFakeRekor(t, tc.failures)
+			r, err := NewRekor("https://rekor.example.com").
+				WithRetry(tc.attempts, time.Millisecond).
+				WithTimeout(tc.timeout).
+				WithTrustRoot(&trustroot.TrustRoot{
+					RekorURL:       s.URL,
+					RekorPublicKey: fake.pub,
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var entries []signing.LogEntry
+			for i := 0; i < tc.uploads; i++ {
+				var e signing.LogEntry
+				e, err = r.Upload(context.Background(), att)
+				if err != nil {
+					break
+				}
+				entries = append(entries, e)
+			}
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.requests != fake.requests {
+				t.Errorf("unexpected number of requests, got: %d, want: %d", fake.requests, tc.requests)
+			}
+			for _, e := range entries {
+				if err := fake.log.Verify(e); err != nil {
+					t.Errorf("verifying entry: %v", err)
+				}
+				if got, want := e.UUID(), entries[0].UUID(); got != want {
+					t.Errorf("unexpected UUID, got: %q, want: %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tlog implements offline verification of transparency log entries.
+// Entries are verified using the public key of the log only, without any
+// calls to the log itself.
+package tlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	jsoncanonicalizer "github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	"github.com/sigstore/rekor/pkg/util"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+)
+
+// ErrLogIDMismatch indicates that the entry was not issued by the log.
+type ErrLogIDMismatch struct {
+	errors.WrappableError
+}
+
+// ErrInvalidSET indicates an invalid signed entry timestamp.
+type ErrInvalidSET struct {
+	errors.WrappableError
+}
+
+// ErrInvalidInclusionProof indicates an invalid inclusion proof.
+type ErrInvalidInclusionProof struct {
+	errors.WrappableError
+}
+
+// ErrInvalidCheckpoint indicates an invalid checkpoint.
+type ErrInvalidCheckpoint struct {
+	errors.WrappableError
+}
+
+// Verifier verifies transparency log entries using the public key of the
+// log.
+type Verifier struct {
+	verifier signature.Verifier
+	logID    string
+}
+
+// NewVerifier returns a new Verifier for the log with the given public key.
+func NewVerifier(pub crypto.PublicKey) (*Verifier, error) {
+	v, err := signature.LoadVerifier(pub, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("loading verifier: %w", err)
+	}
+	logID, err := LogID(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{
+		verifier: v,
+		logID:    logID,
+	}, nil
+}
+
+// NewVerifierFromPEM returns a new Verifier for the log with the given
+// PEM-encoded public key.
+func NewVerifierFromPEM(pubPEM []byte) (*Verifier, error) {
+	pub, err := cryptoutils.UnmarshalPEMToPublicKey(pubPEM)
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	return NewVerifier(pub)
+}
+
+// LogID returns the ID of the log, which is the hex-encoded SHA256 digest of
+// its DER-encoded PKIX public key.
+func LogID(pub crypto.PublicKey) (string, error) {
+	der, err := cryptoutils.MarshalPublicKeyToDER(pub)
+	if err != nil {
+		return "", fmt.Errorf("marshalling public key: %w", err)
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// SignedEntryTimestampPayload returns the canonicalized payload that is
+// signed by the log to form the signed entry timestamp of an entry.
+func SignedEntryTimestampPayload(body []byte, integratedTime, logIndex int64, logID string) ([]byte, error) {
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogIndex       int64  `json:"logIndex"`
+		LogID          string `json:"logID"`
+	}{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: integratedTime,
+		LogIndex:       logIndex,
+		LogID:          logID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling payload: %w", err)
+	}
+	return jsoncanonicalizer.Transform(payload)
+}
+
+// LogID returns the ID of the log.
+func (v *Verifier) LogID() string {
+	return v.logID
+}
+
+// Verify verifies the signed entry timestamp and the inclusion proof of the
+// entry. If checkpoint is not empty, the inclusion proof must be for the
+// tree of the given signed checkpoint. Otherwise, the checkpoint included in
+// the proof is used.
+func (v *Verifier) Verify(e signing.LogEntry, checkpoint []byte) error {
+	if err := v.VerifySET(e); err != nil {
+		return err
+	}
+	return v.VerifyInclusion(e, checkpoint)
+}
+
+// VerifySET verifies the signed entry timestamp of the entry.
+func (v *Verifier) VerifySET(e signing.LogEntry) error {
+	if e.ID() != v.logID {
+		return errors.Errorf(&ErrLogIDMismatch{}, "expected log ID %q, got %q", v.logID, e.ID())
+	}
+
+	set := e.SignedEntryTimestamp()
+	if len(set) == 0 {
+		return errors.Errorf(&ErrInvalidSET{}, "no signed entry timestamp")
+	}
+
+	payload, err := SignedEntryTimestampPayload(e.Body(), e.IntegratedTime(), e.LogIndex(), e.ID())
+	if err != nil {
+		return errors.Errorf(&ErrInvalidSET{}, "computing payload: %w", err)
+	}
+
+	if err := v.verifier.VerifySignature(bytes.NewReader(set), bytes.NewReader(payload)); err != nil {
+		return errors.Errorf(&ErrInvalidSET{}, "verifying signature: %w", err)
+	}
+	return nil
+}
+
+// VerifyInclusion verifies the Merkle tree inclusion proof of the entry. If
+// checkpoint is not empty, the inclusion proof must be for the tree of the
+// given signed checkpoint. Otherwise, the checkpoint included in the proof is
+// used.
+func (v *Verifier) VerifyInclusion(e signing.LogEntry, checkpoint []byte) error {
+	p := e.InclusionProof()
+	if p == nil {
+		return errors.Errorf(&ErrInvalidInclusionProof{}, "no inclusion proof")
+	}
+	if p.LogIndex < 0 || p.TreeSize <= 0 {
+		return errors.Errorf(&ErrInvalidInclusionProof{}, "invalid index %d for tree size %d", p.LogIndex, p.TreeSize)
+	}
+
+	if len(checkpoint) == 0 {
+		checkpoint = []byte(p.Checkpoint)
+	}
+	c, err := v.VerifyCheckpoint(checkpoint)
+	if err != nil {
+		return err
+	}
+	if c.Size != uint64(p.TreeSize) || !bytes.Equal(c.Hash, p.RootHash) {
+		return errors.Errorf(&ErrInvalidInclusionProof{},
+			"inclusion proof for tree size %d does not match checkpoint for tree size %d", p.TreeSize, c.Size)
+	}
+
+	hasher := rfc6962.DefaultHasher
+	leafHash := hasher.HashLeaf(e.Body())
+	if err := proof.VerifyInclusion(hasher, uint64(p.LogIndex), uint64(p.TreeSize), leafHash, p.Hashes, p.RootHash); err != nil {
+		return errors.Errorf(&ErrInvalidInclusionProof{}, "verifying inclusion proof: %w", err)
+	}
+	return nil
+}
+
+// VerifyCheckpoint verifies the signature of the signed checkpoint and
+// returns the checkpoint.
+func (v *Verifier) VerifyCheckpoint(checkpoint []byte) (*util.Checkpoint, error) {
+	if len(checkpoint) == 0 {
+		return nil, errors.Errorf(&ErrInvalidCheckpoint{}, "no checkpoint")
+	}
+
+	sc := &util.SignedCheckpoint{}
+	if err := sc.UnmarshalText(checkpoint); err != nil {
+		return nil, errors.Errorf(&ErrInvalidCheckpoint{}, "decoding checkpoint: %w", err)
+	}
+	if !sc.Verify(v.verifier) {
+		return nil, errors.Errorf(&ErrInvalidCheckpoint{}, "invalid checkpoint signature")
+	}
+	return &sc.Checkpoint, nil
+}
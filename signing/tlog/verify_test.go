@@ -0,0 +1,256 @@
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sigstore/rekor/pkg/util"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/options"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/testutil"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+)
+
+// mth returns the Merkle tree hash of the leaves as defined in RFC 6962.
+func mth(leaves [][]byte) []byte {
+	h := rfc6962.DefaultHasher
+	switch len(leaves) {
+	case 0:
+		return h.EmptyRoot()
+	case 1:
+		return h.HashLeaf(leaves[0])
+	}
+	k := split(len(leaves))
+	return h.HashChildren(mth(leaves[:k]), mth(leaves[k:]))
+}
+
+// path returns the Merkle audit path of leaf m as defined in RFC 6962.
+func path(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if m < k {
+		return append(path(m, leaves[:k]), mth(leaves[k:]))
+	}
+	return append(path(m-k, leaves[k:]), mth(leaves[:k]))
+}
+
+// split returns the largest power of two smaller than n.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+type testLog struct {
+	signer signature.Signer
+	pub    crypto.PublicKey
+	logID  string
+	leaves [][]byte
+}
+
+func newTestLog(t *testing.T, size int) *testLog {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := signature.LoadECDSASigner(priv, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID, err := LogID(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &testLog{signer: s, pub: priv.Public(), logID: logID}
+	for i := 0; i < size; i++ {
+		l.leaves = append(l.leaves, []byte(fmt.Sprintf(`{"apiVersion":"0.0.1","kind":"intoto","spec":{"i":%d}}`, i)))
+	}
+	return l
+}
+
+func (l *testLog) checkpoint(t *testing.T, size int) string {
+	sc, err := util.CreateSignedCheckpoint(util.Checkpoint{
+		Origin: "test log",
+		Size:   uint64(size),
+		Hash:   mth(l.leaves[:size]),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.Sign("log.example.com", l.signer, options.WithContext(context.Background())); err != nil {
+		t.Fatal(err)
+	}
+	b, err := sc.SignedNote.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// entry returns the log entry at index i with an inclusion proof for the
+// whole log.
+func (l *testLog) entry(t *testing.T, i int) *testutil.TestLogEntry {
+	integratedTime := int64(1672531200 + i)
+	payload, err := SignedEntryTimestampPayload(l.leaves[i], integratedTime, int64(i), l.logID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := l.signer.SignMessage(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testutil.TestLogEntry{
+		IDVal:                   l.logID,
+		UUIDVal:                 fmt.Sprintf("uuid-%d", i),
+		LogIndexVal:             int64(i),
+		IntegratedTimeVal:       integratedTime,
+		BodyVal:                 l.leaves[i],
+		SignedEntryTimestampVal: set,
+		InclusionProofVal: &signing.InclusionProof{
+			LogIndex:   int64(i),
+			TreeSize:   int64(len(l.leaves)),
+			RootHash:   mth(l.leaves),
+			Hashes:     path(i, l.leaves),
+			Checkpoint: l.checkpoint(t, len(l.leaves)),
+		},
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	l := newTestLog(t, 7)
+	other := newTestLog(t, 7)
+
+	testCases := []struct {
+		name       string
+		entry      func() *testutil.TestLogEntry
+		checkpoint string
+		err        func(error) bool
+	}{
+		{
+			name:  "first entry",
+			entry: func() *testutil.TestLogEntry { return l.entry(t, 0) },
+		},
+		{
+			name:  "last entry",
+			entry: func() *testutil.TestLogEntry { return l.entry(t, 6) },
+		},
+		{
+			name:       "trusted checkpoint",
+			entry:      func() *testutil.TestLogEntry { return l.entry(t, 3) },
+			checkpoint: l.checkpoint(t, 7),
+		},
+		{
+			name:       "trusted checkpoint for other tree size",
+			entry:      func() *testutil.TestLogEntry { return l.entry(t, 3) },
+			checkpoint: l.checkpoint(t, 5),
+			err:        errorAs[*ErrInvalidInclusionProof],
+		},
+		{
+			name:       "checkpoint signed by other log",
+			entry:      func() *testutil.TestLogEntry { return l.entry(t, 3) },
+			checkpoint: other.checkpoint(t, 7),
+			err:        errorAs[*ErrInvalidCheckpoint],
+		},
+		{
+			name:  "entry from other log",
+			entry: func() *testutil.TestLogEntry { return other.entry(t, 3) },
+			err:   errorAs[*ErrLogIDMismatch],
+		},
+		{
+			name: "modified integrated time",
+			entry: func() *testutil.TestLogEntry {
+				e := l.entry(t, 3)
+				e.IntegratedTimeVal++
+				return e
+			},
+			err: errorAs[*ErrInvalidSET],
+		},
+		{
+			name: "no SET",
+			entry: func() *testutil.TestLogEntry {
+				e := l.entry(t, 3)
+				e.SignedEntryTimestampVal = nil
+				return e
+			},
+			err: errorAs[*ErrInvalidSET],
+		},
+		{
+			name: "no inclusion proof",
+			entry: func() *testutil.TestLogEntry {
+				e := l.entry(t, 3)
+				e.InclusionProofVal = nil
+				return e
+			},
+			err: errorAs[*ErrInvalidInclusionProof],
+		},
+		{
+			name: "wrong proof index",
+			entry: func() *testutil.TestLogEntry {
+				e := l.entry(t, 3)
+				e.InclusionProofVal.LogIndex = 4
+				return e
+			},
+			err: errorAs[*ErrInvalidInclusionProof],
+		},
+		{
+			name: "tampered proof",
+			entry: func() *testutil.TestLogEntry {
+				e := l.entry(t, 3)
+				e.InclusionProofVal.Hashes[0] = mth(nil)
+				return e
+			},
+			err: errorAs[*ErrInvalidInclusionProof],
+		},
+		{
+			name: "no checkpoint",
+			entry: func() *testutil.TestLogEntry {
+				e := l.entry(t, 3)
+				e.InclusionProofVal.Checkpoint = ""
+				return e
+			},
+			err: errorAs[*ErrInvalidCheckpoint],
+		},
+	}
+
+	v, err := NewVerifier(l.pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Verify(tc.entry(), []byte(tc.checkpoint))
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !tc.err(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// errorAs reports whether err wraps an error of type T.
+func errorAs[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
@@ -0,0 +1,243 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trustroot implements loading the trust root of a Sigstore
+// deployment, i.e. the service addresses, the Fulcio certificate chain, the
+// public keys of the CT log and Rekor and the certificate chain of the
+// timestamp authority. It is used to sign and verify
+// provenance with a private Sigstore deployment instead of the public
+// instance.
+package trustroot
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+)
+
+// EnvVar is the environment variable holding the path to the trust root
+// file.
+const EnvVar = "SLSA_TRUST_ROOT"
+
+// ErrInvalidTrustRoot indicates an invalid trust root file.
+type ErrInvalidTrustRoot struct {
+	errors.WrappableError
+}
+
+// TrustRoot is the trust root of a Sigstore deployment. Empty fields mean the
+// defaults of the public Sigstore instance are used.
+type TrustRoot struct {
+	// FulcioURL is the base URL of Fulcio.
+	FulcioURL string
+
+	// OIDCIssuer is the OIDC issuer used to get a certificate from Fulcio.
+	OIDCIssuer string
+
+	// OIDCClientID is the OIDC client ID used to get a certificate from
+	// Fulcio.
+	OIDCClientID string
+
+	// FulcioRoots are the root certificates of Fulcio.
+	FulcioRoots []*x509.Certificate
+
+	// FulcioIntermediates are the intermediate certificates of Fulcio.
+	FulcioIntermediates []*x509.Certificate
+
+	// CTLogPublicKey is the public key of the certificate transparency log
+	// used by Fulcio.
+	CTLogPublicKey crypto.PublicKey
+
+	// RekorURL is the base URL of Rekor.
+	RekorURL string
+
+	// RekorPublicKey is the public key of Rekor.
+	RekorPublicKey crypto.PublicKey
+
+	// TSAURL is the URL of the RFC 3161 timestamp authority. Signatures are
+	// not timestamped if empty.
+	TSAURL string
+
+	// TSACertificates are the root and intermediate certificates of the
+	// timestamp authority.
+	TSACertificates []*x509.Certificate
+}
+
+// Certificates returns the root and intermediate certificates of Fulcio.
+func (tr *TrustRoot) Certificates() []*x509.Certificate {
+	certs := make([]*x509.Certificate, 0, len(tr.FulcioRoots)+len(tr.FulcioIntermediates))
+	certs = append(certs, tr.FulcioRoots...)
+	return append(certs, tr.FulcioIntermediates...)
+}
+
+// file is the JSON format of the trust root file. PEM values are either
+// given inline or as a path relative to the trust root file.
+type file struct {
+	Fulcio struct {
+		URL           string `json:"url"`
+		OIDCIssuer    string `json:"oidcIssuer"`
+		OIDCClientID  string `json:"oidcClientID"`
+		Roots         string `json:"roots"`
+		Intermediates string `json:"intermediates"`
+	} `json:"fulcio"`
+	CTLog struct {
+		PublicKey string `json:"publicKey"`
+	} `json:"ctlog"`
+	Rekor struct {
+		URL       string `json:"url"`
+		PublicKey string `json:"publicKey"`
+	} `json:"rekor"`
+	TSA struct {
+		URL          string `json:"url"`
+		Certificates string `json:"certificates"`
+	} `json:"tsa"`
+}
+
+// FromEnv loads the trust root from the file given by the SLSA_TRUST_ROOT
+// environment variable. It returns nil if the variable is not set.
+func FromEnv() (*TrustRoot, error) {
+	path := os.Getenv(EnvVar)
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// Load loads the trust root from the file at path. The file is either a JSON
+// trust root file or a PEM file with the certificates of Fulcio, which are
+// all trusted as roots.
+func Load(path string) (*TrustRoot, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidTrustRoot{}, "reading trust root: %w", err)
+	}
+	return Parse(b, filepath.Dir(path))
+}
+
+// Parse parses a trust root file. Paths in the file are resolved relative to
+// dir.
+func Parse(b []byte, dir string) (*TrustRoot, error) {
+	if isPEM(string(b)) {
+		roots, err := parseCertificates(string(b), dir)
+		if err != nil {
+			return nil, err
+		}
+		return &TrustRoot{FulcioRoots: roots}, nil
+	}
+
+	var f file
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, errors.Errorf(&ErrInvalidTrustRoot{}, "decoding trust root: %w", err)
+	}
+
+	tr := &TrustRoot{
+		FulcioURL:    f.Fulcio.URL,
+		OIDCIssuer:   f.Fulcio.OIDCIssuer,
+		OIDCClientID: f.Fulcio.OIDCClientID,
+		RekorURL:     f.Rekor.URL,
+		TSAURL:       f.TSA.URL,
+	}
+
+	var err error
+	if f.Fulcio.Roots != "" {
+		if tr.FulcioRoots, err = parseCertificates(f.Fulcio.Roots, dir); err != nil {
+			return nil, err
+		}
+	}
+	if f.Fulcio.Intermediates != "" {
+		if f.Fulcio.Roots == "" {
+			return nil, errors.Errorf(&ErrInvalidTrustRoot{}, "fulcio intermediates given without roots")
+		}
+		if tr.FulcioIntermediates, err = parseCertificates(f.Fulcio.Intermediates, dir); err != nil {
+			return nil, err
+		}
+	}
+	if f.TSA.Certificates != "" {
+		if tr.TSACertificates, err = parseCertificates(f.TSA.Certificates, dir); err != nil {
+			return nil, err
+		}
+	}
+	if tr.CTLogPublicKey, err = parsePublicKey(f.CTLog.PublicKey, dir); err != nil {
+		return nil, err
+	}
+	if tr.RekorPublicKey, err = parsePublicKey(f.Rekor.PublicKey, dir); err != nil {
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+// isPEM returns whether s is inline PEM data rather than a path.
+func isPEM(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "-----BEGIN")
+}
+
+// readPEM returns the inline PEM data in s or reads it from the path in s
+// relative to dir.
+func readPEM(s, dir string) ([]byte, error) {
+	if isPEM(s) {
+		return []byte(s), nil
+	}
+	path := s
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidTrustRoot{}, "reading %q: %w", s, err)
+	}
+	return b, nil
+}
+
+// parseCertificates parses the PEM encoded certificates in s.
+func parseCertificates(s, dir string) ([]*x509.Certificate, error) {
+	b, err := readPEM(s, dir)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(b)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidTrustRoot{}, "decoding certificates: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, errors.Errorf(&ErrInvalidTrustRoot{}, "no certificate found")
+	}
+	return certs, nil
+}
+
+// parsePublicKey parses the PEM encoded public key in s. It returns nil if s
+// is empty.
+func parsePublicKey(s, dir string) (crypto.PublicKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := readPEM(s, dir)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := cryptoutils.UnmarshalPEMToPublicKey(b)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidTrustRoot{}, "decoding public key: %w", err)
+	}
+	return pub, nil
+}
@@ -0,0 +1,229 @@
+package trustroot
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+func newTestCertPEM(t *testing.T, name string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newTestKeyPEM(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cryptoutils.MarshalPublicKeyToPEM(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func writeFile(t *testing.T, dir, name string, b []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	rootPEM := newTestCertPEM(t, "root")
+	intermediatePEM := newTestCertPEM(t, "intermediate")
+	writeFile(t, dir, "fulcio.pem", rootPEM)
+	writeFile(t, dir, "rekor.pub", newTestKeyPEM(t))
+
+	trustRootJSON := func(v map[string]interface{}) []byte {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	testCases := []struct {
+		name  string
+		file  []byte
+		check func(*testing.T, *TrustRoot)
+		err   bool
+	}{
+		{
+			name: "PEM bundle",
+			file: append(append([]byte{}, rootPEM...), intermediatePEM...),
+			check: func(t *testing.T, tr *TrustRoot) {
+				if got, want := len(tr.FulcioRoots), 2; got != want {
+					t.Errorf("unexpected number of roots, got: %d, want: %d", got, want)
+				}
+				if tr.FulcioURL != "" || tr.RekorPublicKey != nil {
+					t.Errorf("unexpected trust root: %+v", tr)
+				}
+			},
+		},
+		{
+			name: "full trust root",
+			file: trustRootJSON(map[string]interface{}{
+				"fulcio": map[string]string{
+					"url":           "https://fulcio.example.com",
+					"oidcIssuer":    "https://oauth2.example.com",
+					"oidcClientID":  "sigstore",
+					"roots":         "fulcio.pem",
+					"intermediates": string(intermediatePEM),
+				},
+				"ctlog": map[string]string{
+					"publicKey": string(newTestKeyPEM(t)),
+				},
+				"rekor": map[string]string{
+					"url":       "https://rekor.example.com",
+					"publicKey": "rekor.pub",
+				},
+				"tsa": map[string]string{
+					"url":          "https://tsa.example.com",
+					"certificates": "fulcio.pem",
+				},
+			}),
+			check: func(t *testing.T, tr *TrustRoot) {
+				if got, want := tr.FulcioURL, "https://fulcio.example.com"; got != want {
+					t.Errorf("unexpected fulcio url, got: %q, want: %q", got, want)
+				}
+				if got, want := tr.OIDCIssuer, "https://oauth2.example.com"; got != want {
+					t.Errorf("unexpected OIDC issuer, got: %q, want: %q", got, want)
+				}
+				if got, want := tr.RekorURL, "https://rekor.example.com"; got != want {
+					t.Errorf("unexpected rekor url, got: %q, want: %q", got, want)
+				}
+				if len(tr.FulcioRoots) != 1 || len(tr.FulcioIntermediates) != 1 {
+					t.Errorf("unexpected certificates: %d roots, %d intermediates",
+						len(tr.FulcioRoots), len(tr.FulcioIntermediates))
+				}
+				if got, want := len(tr.Certificates()), 2; got != want {
+					t.Errorf("unexpected number of certificates, got: %d, want: %d", got, want)
+				}
+				if tr.CTLogPublicKey == nil || tr.RekorPublicKey == nil {
+					t.Errorf("missing public keys")
+				}
+				if got, want := tr.TSAURL, "https://tsa.example.com"; got != want {
+					t.Errorf("unexpected TSA url, got: %q, want: %q", got, want)
+				}
+				if got, want := len(tr.TSACertificates), 1; got != want {
+					t.Errorf("unexpected number of TSA certificates, got: %d, want: %d", got, want)
+				}
+			},
+		},
+		{
+			name: "rekor only",
+			file: trustRootJSON(map[string]interface{}{
+				"rekor": map[string]string{"url": "https://rekor.example.com"},
+			}),
+			check: func(t *testing.T, tr *TrustRoot) {
+				if len(tr.FulcioRoots) != 0 || tr.RekorPublicKey != nil {
+					t.Errorf("unexpected trust root: %+v", tr)
+				}
+			},
+		},
+		{
+			name: "unknown field",
+			file: trustRootJSON(map[string]interface{}{
+				"fulcio": map[string]string{"root": "fulcio.pem"},
+			}),
+			err: true,
+		},
+		{
+			name: "intermediates without roots",
+			file: trustRootJSON(map[string]interface{}{
+				"fulcio": map[string]string{"intermediates": "fulcio.pem"},
+			}),
+			err: true,
+		},
+		{
+			name: "missing file",
+			file: trustRootJSON(map[string]interface{}{
+				"rekor": map[string]string{"publicKey": "missing.pub"},
+			}),
+			err: true,
+		},
+		{
+			name: "invalid public key",
+			file: trustRootJSON(map[string]interface{}{
+				"rekor": map[string]string{"publicKey": "fulcio.pem"},
+			}),
+			err: true,
+		},
+		{
+			name: "invalid PEM bundle",
+			file: []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"),
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := writeFile(t, dir, tc.name+".json", tc.file)
+			tr, err := Load(path)
+			if tc.err {
+				var errTrustRoot *ErrInvalidTrustRoot
+				if !errors.As(err, &errTrustRoot) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tc.check(t, tr)
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvVar, "")
+	tr, err := FromEnv()
+	if err != nil || tr != nil {
+		t.Fatalf("unexpected result: %v, %v", tr, err)
+	}
+
+	path := writeFile(t, t.TempDir(), "root.pem", newTestCertPEM(t, "root"))
+	t.Setenv(EnvVar, path)
+	tr, err = FromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := len(tr.FulcioRoots), 1; got != want {
+		t.Errorf("unexpected number of roots, got: %d, want: %d", got, want)
+	}
+}
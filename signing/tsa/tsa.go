@@ -0,0 +1,214 @@
+// Copyright 2023 SLSA Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tsa implements RFC 3161 timestamps for signed attestations. A
+// timestamp authority (TSA) countersigns the signatures of an envelope, which
+// proves that the signatures were created while the short-lived signing
+// certificates were valid.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sassoftware/relic/lib/pkcs7"
+	"github.com/sassoftware/relic/lib/pkcs9"
+
+	"github.com/slsa-framework/slsa-github-generator/internal/errors"
+	"github.com/slsa-framework/slsa-github-generator/signing"
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+)
+
+// maxResponseSize is the maximum size of a TSA response.
+const maxResponseSize = 1 << 20
+
+// ErrInvalidTimestamp indicates an invalid timestamp token.
+type ErrInvalidTimestamp struct {
+	errors.WrappableError
+}
+
+// Client requests timestamps from a TSA.
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient returns a new Client for the TSA at the given URL.
+func NewClient(url string) *Client {
+	return &Client{
+		url:    url,
+		client: http.DefaultClient,
+	}
+}
+
+// Timestamp requests a timestamp over data from the TSA and returns the
+// DER-encoded timestamp token.
+func (c *Client) Timestamp(ctx context.Context, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	msg, req, err := pkcs9.NewRequest(c.url, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("creating timestamp request: %w", err)
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("requesting timestamp: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting timestamp: unexpected status %q", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading timestamp response: %w", err)
+	}
+	token, err := msg.ParseResponse(body)
+	if err != nil {
+		return nil, errors.Errorf(&ErrInvalidTimestamp{}, "parsing timestamp response: %w", err)
+	}
+	return token.Marshal()
+}
+
+// Verifier verifies timestamp tokens issued by a TSA. It implements
+// envelope.TimestampVerifier.
+type Verifier struct {
+	roots         *x509.CertPool
+	intermediates []*x509.Certificate
+}
+
+// NewVerifier returns a new Verifier for the TSA with the given root and
+// intermediate certificates.
+func NewVerifier(certs []*x509.Certificate) (*Verifier, error) {
+	v := &Verifier{roots: x509.NewCertPool()}
+	var hasRoot bool
+	for _, c := range certs {
+		// Self-signed certificates are roots, any other certificate is an
+		// intermediate.
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			v.roots.AddCert(c)
+			hasRoot = true
+		} else {
+			v.intermediates = append(v.intermediates, c)
+		}
+	}
+	if !hasRoot {
+		return nil, fmt.Errorf("no root certificate for the timestamp authority")
+	}
+	return v, nil
+}
+
+// VerifyTimestamp verifies that the DER-encoded timestamp token is over data
+// and was issued by the TSA. It returns the time of the timestamp.
+func (v *Verifier) VerifyTimestamp(token, data []byte) (time.Time, error) {
+	psd, err := pkcs7.Unmarshal(token)
+	if err != nil {
+		return time.Time{}, errors.Errorf(&ErrInvalidTimestamp{}, "decoding timestamp: %w", err)
+	}
+	cs, err := pkcs9.Verify(psd, data, v.intermediates)
+	if err != nil {
+		return time.Time{}, errors.Errorf(&ErrInvalidTimestamp{}, "verifying timestamp: %w", err)
+	}
+	if err := cs.VerifyChain(v.roots, v.intermediates); err != nil {
+		return time.Time{}, errors.Errorf(&ErrInvalidTimestamp{}, "verifying timestamp certificate chain: %w", err)
+	}
+	return cs.SigningTime, nil
+}
+
+// Signer wraps a signing.Signer and adds a timestamp over each signature of
+// the signed attestations.
+type Signer struct {
+	signer signing.Signer
+	client *Client
+}
+
+// NewSigner returns a new Signer that timestamps the attestations signed by
+// s using the given TSA client.
+func NewSigner(s signing.Signer, c *Client) *Signer {
+	return &Signer{
+		signer: s,
+		client: c,
+	}
+}
+
+// WrapSigner returns a signer that timestamps the attestations signed by s
+// with the TSA of the trust root tr. It returns s if tr is nil or has no TSA.
+func WrapSigner(s signing.Signer, tr *trustroot.TrustRoot) signing.Signer {
+	if tr == nil || tr.TSAURL == "" {
+		return s
+	}
+	return NewSigner(s, NewClient(tr.TSAURL))
+}
+
+// attestation is a signed attestation.
+type attestation struct {
+	cert []byte
+	att  []byte
+}
+
+// Bytes returns the signed attestation as an encoded DSSE JSON envelope.
+func (a *attestation) Bytes() []byte {
+	return a.att
+}
+
+// Cert returns the certificate used to sign the attestation.
+func (a *attestation) Cert() []byte {
+	return a.cert
+}
+
+// Sign signs the given provenance statement and adds a timestamp over each
+// signature.
+func (s *Signer) Sign(ctx context.Context, p *intoto.Statement) (signing.Attestation, error) {
+	att, err := s.signer.Sign(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &envelope.Envelope{}
+	if err := json.Unmarshal(att.Bytes(), env); err != nil {
+		return nil, fmt.Errorf("decoding envelope: %w", err)
+	}
+	for i, sig := range env.Signatures {
+		// NOTE: The timestamp is over the raw signature bytes.
+		rawSig, err := base64.StdEncoding.DecodeString(sig.Sig)
+		if err != nil {
+			return nil, fmt.Errorf("decoding signature: %w", err)
+		}
+		token, err := s.client.Timestamp(ctx, rawSig)
+		if err != nil {
+			return nil, err
+		}
+		env.Signatures[i].Timestamp = base64.StdEncoding.EncodeToString(token)
+	}
+
+	b, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling envelope: %w", err)
+	}
+	return &attestation{
+		att:  b,
+		cert: att.Cert(),
+	}, nil
+}
@@ -0,0 +1,348 @@
+package tsa
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sassoftware/relic/lib/pkcs7"
+	"github.com/sassoftware/relic/lib/pkcs9"
+
+	"github.com/slsa-framework/slsa-github-generator/signing/envelope"
+	"github.com/slsa-framework/slsa-github-generator/signing/local"
+	"github.com/slsa-framework/slsa-github-generator/signing/trustroot"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key := newTestKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue issues a certificate for key that is valid between notBefore and
+// notAfter.
+func (ca *testCA) issue(t *testing.T, key *ecdsa.PrivateKey, notBefore, notAfter time.Time, usage x509.ExtKeyUsage) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testTSA is an RFC 3161 timestamp authority.
+type testTSA struct {
+	t    *testing.T
+	ca   *testCA
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	now  time.Time
+}
+
+func newTestTSA(t *testing.T) (*testTSA, *httptest.Server) {
+	ca := newTestCA(t, "tsa root")
+	key := newTestKey(t)
+	tsa := &testTSA{
+		t:    t,
+		ca:   ca,
+		cert: ca.issue(t, key, time.Now().Add(-2*time.Hour), time.Now().Add(time.Hour), x509.ExtKeyUsageTimeStamping),
+		key:  key,
+		now:  time.Now(),
+	}
+	s := httptest.NewServer(tsa)
+	t.Cleanup(s.Close)
+	return tsa, s
+}
+
+func (tsa *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req pkcs9.TimeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	genTime, err := asn1.MarshalWithParams(tsa.now.UTC(), "generalized")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	info := pkcs9.TSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(1),
+		GenTime:        asn1.RawValue{FullBytes: genTime},
+		Nonce:          req.Nonce,
+	}
+	// The content is the DER-encoded TSTInfo wrapped in an OCTET STRING.
+	infoDER, err := asn1.Marshal(info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b := pkcs7.NewBuilder(tsa.key, []*x509.Certificate{tsa.cert}, crypto.SHA256)
+	if err := b.SetContent(pkcs9.OidTSTInfo, infoDER); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token, err := b.Sign()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := asn1.Marshal(pkcs9.TimeStampResp{
+		Status:         pkcs9.PKIStatusInfo{Status: pkcs9.StatusGranted},
+		TimeStampToken: *token,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	if _, err := w.Write(resp); err != nil {
+		tsa.t.Errorf("writing response: %v", err)
+	}
+}
+
+func TestClient_Timestamp(t *testing.T) {
+	tsa, s := newTestTSA(t)
+	data := []byte("signature")
+
+	token, err := NewClient(s.URL).Timestamp(context.Background(), data)
+	if err != nil {
+		t.Fatalf("Timestamp: %v", err)
+	}
+
+	v, err := NewVerifier([]*x509.Certificate{tsa.ca.cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := v.VerifyTimestamp(token, data)
+	if err != nil {
+		t.Fatalf("VerifyTimestamp: %v", err)
+	}
+	if got, want := ts.Unix(), tsa.now.Unix(); got != want {
+		t.Errorf("unexpected timestamp, got: %d, want: %d", got, want)
+	}
+
+	var errTimestamp *ErrInvalidTimestamp
+	if _, err := v.VerifyTimestamp(token, []byte("other")); !errors.As(err, &errTimestamp) {
+		t.Errorf("unexpected error for other data: %v", err)
+	}
+	if _, err := v.VerifyTimestamp([]byte("garbage"), data); !errors.As(err, &errTimestamp) {
+		t.Errorf("unexpected error for invalid token: %v", err)
+	}
+
+	other, err := NewVerifier([]*x509.Certificate{newTestCA(t, "other root").cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.VerifyTimestamp(token, data); !errors.As(err, &errTimestamp) {
+		t.Errorf("unexpected error for untrusted TSA: %v", err)
+	}
+}
+
+func TestClient_Timestamp_error(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	if _, err := NewClient(s.URL).Timestamp(context.Background(), []byte("signature")); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestNewVerifier_noRoot(t *testing.T) {
+	ca := newTestCA(t, "root")
+	cert := ca.issue(t, newTestKey(t), time.Now(), time.Now().Add(time.Hour), x509.ExtKeyUsageTimeStamping)
+	if _, err := NewVerifier([]*x509.Certificate{cert}); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	ca := newTestCA(t, "fulcio root")
+
+	testCases := []struct {
+		name     string
+		tsaTime  time.Duration
+		verifier bool
+		err      func(error) bool
+	}{
+		{
+			name:     "timestamp within certificate validity",
+			tsaTime:  5 * time.Minute,
+			verifier: true,
+		},
+		{
+			name:     "timestamp after certificate expiry",
+			tsaTime:  time.Hour,
+			verifier: true,
+			err:      errorAs[*envelope.ErrInvalidCertificate],
+		},
+		{
+			name:    "timestamp ignored without verifier",
+			tsaTime: time.Hour,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Re-initializing variable so it is not changed while executing the closure below
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The signing certificate was issued an hour ago and was
+			// valid for ten minutes.
+			issued := time.Now().Add(-time.Hour)
+			key := newTestKey(t)
+			cert := ca.issue(t, key, issued, issued.Add(10*time.Minute), x509.ExtKeyUsageCodeSigning)
+			ks, err := local.NewKeySigner(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ks, err = ks.WithCert(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tsa, s := newTestTSA(t)
+			tsa.now = issued.Add(tc.tsaTime)
+
+			att, err := NewSigner(ks, NewClient(s.URL)).Sign(context.Background(), &intoto.Statement{
+				StatementHeader: intoto.StatementHeader{
+					Type:          intoto.StatementInTotoV01,
+					PredicateType: "https://example.com/predicate",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+
+			env := &envelope.Envelope{}
+			if err := json.Unmarshal(att.Bytes(), env); err != nil {
+				t.Fatal(err)
+			}
+			if len(env.Signatures) != 1 || env.Signatures[0].Timestamp == "" {
+				t.Fatalf("expected a timestamp in the envelope: %s", att.Bytes())
+			}
+			if _, err := base64.StdEncoding.DecodeString(env.Signatures[0].Timestamp); err != nil {
+				t.Fatalf("decoding timestamp: %v", err)
+			}
+
+			opts := &envelope.VerifyOptions{Roots: []*x509.Certificate{ca.cert}}
+			if tc.verifier {
+				if opts.Timestamps, err = NewVerifier([]*x509.Certificate{tsa.ca.cert}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			v, err := envelope.Verify(att.Bytes(), opts)
+			if tc.err != nil {
+				if !tc.err(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := v.Signatures[0].SigningTime
+			if tc.verifier && got.Unix() != tsa.now.Unix() {
+				t.Errorf("unexpected signing time, got: %v, want: %v", got, tsa.now)
+			}
+			if !tc.verifier && !got.IsZero() {
+				t.Errorf("unexpected signing time: %v", got)
+			}
+		})
+	}
+}
+
+func TestWrapSigner(t *testing.T) {
+	ks, err := local.NewKeySigner(newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := WrapSigner(ks, nil); s != ks {
+		t.Errorf("expected the signer without trust root, got: %T", s)
+	}
+	if s := WrapSigner(ks, &trustroot.TrustRoot{}); s != ks {
+		t.Errorf("expected the signer without TSA, got: %T", s)
+	}
+	s, ok := WrapSigner(ks, &trustroot.TrustRoot{TSAURL: "https://tsa.example.com"}).(*Signer)
+	if !ok {
+		t.Fatalf("expected a TSA signer")
+	}
+	if s.signer != ks || s.client.url != "https://tsa.example.com" {
+		t.Errorf("unexpected TSA signer: %+v", s)
+	}
+}
+
+// errorAs reports whether err wraps an error of type T.
+func errorAs[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
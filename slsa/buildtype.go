@@ -25,6 +25,7 @@ import (
 	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	slsa "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
 	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1.0"
 
 	"github.com/slsa-framework/slsa-github-generator/github"
 )
@@ -51,6 +52,31 @@ type BuildType interface {
 	Metadata(context.Context) (*slsa02.ProvenanceMetadata, error)
 }
 
+// BuildTypeV1 implements generation of buildType specific elements of SLSA
+// v1.0 provenance. Each BuildTypeV1 instance represents a specific build.
+type BuildTypeV1 interface {
+	// URI returns the build type's URI.
+	URI() string
+
+	// Subject returns a set of artifacts created by the build.
+	Subject(context.Context) ([]intoto.Subject, error)
+
+	// ExternalParameters returns the parameters that are under external
+	// control, such as those set by the user triggering the build.
+	ExternalParameters(context.Context) (interface{}, error)
+
+	// InternalParameters returns the parameters that are under the control
+	// of the builder.
+	InternalParameters(context.Context) (interface{}, error)
+
+	// ResolvedDependencies returns the artifacts needed at build time.
+	ResolvedDependencies(context.Context) ([]slsa1.ArtifactReference, error)
+
+	// RunDetails returns details specific to this execution of the build.
+	// The builder ID is set by the generator.
+	RunDetails(context.Context) (*slsa1.ProvenanaceRunDetails, error)
+}
+
 // GithubActionsBuild is a basic build type for builders running in GitHub Actions.
 type GithubActionsBuild struct {
 	Context github.WorkflowContext
@@ -140,6 +166,41 @@ func (b *GithubActionsBuild) getEntryPoint(ctx context.Context) (string, error)
 func (b *GithubActionsBuild) Invocation(ctx context.Context) (slsa.ProvenanceInvocation, error) {
 	i := slsa.ProvenanceInvocation{}
 
+	env, err := b.environment(ctx)
+	if err != nil {
+		return i, err
+	}
+
+	// Set the env.
+	i.Environment = env
+
+	// ConfigSource
+	entryPoint, err := b.getEntryPoint(ctx)
+	if err != nil {
+		return i, fmt.Errorf("getting entrypoint: %w", err)
+	}
+
+	i.ConfigSource.EntryPoint = entryPoint
+	i.ConfigSource.URI = b.Context.RepositoryURI()
+	if b.Context.SHA != "" {
+		i.ConfigSource.Digest = slsacommon.DigestSet{
+			"sha1": b.Context.SHA,
+		}
+	}
+
+	if b.Context.Event != nil {
+		// Parameters coming from the trigger event.
+		i.Parameters = WorkflowParameters{
+			EventInputs: b.Context.Event["inputs"],
+		}
+	}
+
+	return i, nil
+}
+
+// environment returns the builder-controlled environment variables needed to
+// reproduce the build.
+func (b *GithubActionsBuild) environment(ctx context.Context) (map[string]interface{}, error) {
 	// Builder-controlled environment vars needed
 	// to reproduce the build.
 	env := map[string]interface{}{}
@@ -186,13 +247,13 @@ func (b *GithubActionsBuild) Invocation(ctx context.Context) (slsa.ProvenanceInv
 
 	oidcClient, err := b.Clients.OIDCClient()
 	if err != nil {
-		return i, fmt.Errorf("oidc client: %w", err)
+		return nil, fmt.Errorf("oidc client: %w", err)
 	}
 
 	if oidcClient != nil {
 		t, err := oidcClient.Token(ctx, []string{b.Context.Repository})
 		if err != nil {
-			return i, err
+			return nil, err
 		}
 
 		// github_repository_id is the unique ID of the repository.
@@ -206,31 +267,7 @@ func (b *GithubActionsBuild) Invocation(ctx context.Context) (slsa.ProvenanceInv
 		addEnvKeyString(env, "github_repository_owner_id", t.RepositoryOwnerID)
 	}
 
-	// Set the env.
-	i.Environment = env
-
-	// ConfigSource
-	entryPoint, err := b.getEntryPoint(ctx)
-	if err != nil {
-		return i, fmt.Errorf("getting entrypoint: %w", err)
-	}
-
-	i.ConfigSource.EntryPoint = entryPoint
-	i.ConfigSource.URI = b.Context.RepositoryURI()
-	if b.Context.SHA != "" {
-		i.ConfigSource.Digest = slsacommon.DigestSet{
-			"sha1": b.Context.SHA,
-		}
-	}
-
-	if b.Context.Event != nil {
-		// Parameters coming from the trigger event.
-		i.Parameters = WorkflowParameters{
-			EventInputs: b.Context.Event["inputs"],
-		}
-	}
-
-	return i, nil
+	return env, nil
 }
 
 // Materials implements BuildType.Materials. It returns a list of materials
@@ -253,11 +290,7 @@ func (b *GithubActionsBuild) Materials(context.Context) ([]slsacommon.Provenance
 func (b *GithubActionsBuild) Metadata(context.Context) (*slsa.ProvenanceMetadata, error) {
 	metadata := slsa.ProvenanceMetadata{}
 
-	metadata.BuildInvocationID = b.Context.RunID
-	if b.Context.RunAttempt != "" {
-		// NOTE: RunID does not get updated on re-runs so we need to include RunAttempt.
-		metadata.BuildInvocationID = fmt.Sprintf("%s-%s", b.Context.RunID, b.Context.RunAttempt)
-	}
+	metadata.BuildInvocationID = b.invocationID()
 
 	if b.Context.Event != nil {
 		// Parameters come from the trigger event.
@@ -268,6 +301,92 @@ func (b *GithubActionsBuild) Metadata(context.Context) (*slsa.ProvenanceMetadata
 	return &metadata, nil
 }
 
+func (b *GithubActionsBuild) invocationID() string {
+	if b.Context.RunAttempt != "" {
+		// NOTE: RunID does not get updated on re-runs so we need to include RunAttempt.
+		return fmt.Sprintf("%s-%s", b.Context.RunID, b.Context.RunAttempt)
+	}
+	return b.Context.RunID
+}
+
+// WorkflowExternalParameters contains the external parameters of a workflow
+// run for SLSA v1.0 provenance.
+type WorkflowExternalParameters struct {
+	// Workflow identifies the top-level workflow that was run.
+	Workflow WorkflowReference `json:"workflow"`
+
+	// Inputs is the inputs for the event that triggered the workflow.
+	Inputs interface{} `json:"inputs,omitempty"`
+}
+
+// WorkflowReference identifies a workflow file at a specific ref in a
+// repository.
+type WorkflowReference struct {
+	Ref        string `json:"ref"`
+	Repository string `json:"repository"`
+	Path       string `json:"path"`
+}
+
+// ExternalParameters implements BuildTypeV1.ExternalParameters. The
+// parameters identify the workflow that was run and the inputs of the event
+// that triggered it.
+func (b *GithubActionsBuild) ExternalParameters(ctx context.Context) (interface{}, error) {
+	entryPoint, err := b.getEntryPoint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting entrypoint: %w", err)
+	}
+
+	var repository string
+	if b.Context.ServerURL != "" && b.Context.Repository != "" {
+		repository = fmt.Sprintf("%s/%s", b.Context.ServerURL, b.Context.Repository)
+	}
+
+	p := WorkflowExternalParameters{
+		Workflow: WorkflowReference{
+			Ref:        b.Context.Ref,
+			Repository: repository,
+			Path:       entryPoint,
+		},
+	}
+	if b.Context.Event != nil {
+		p.Inputs = b.Context.Event["inputs"]
+	}
+
+	return p, nil
+}
+
+// InternalParameters implements BuildTypeV1.InternalParameters. It returns
+// the same builder-controlled environment that is recorded in the
+// invocation of SLSA v0.2 provenance.
+func (b *GithubActionsBuild) InternalParameters(ctx context.Context) (interface{}, error) {
+	return b.environment(ctx)
+}
+
+// ResolvedDependencies implements BuildTypeV1.ResolvedDependencies. It
+// returns the repository that triggered the GitHub Actions workflow.
+func (b *GithubActionsBuild) ResolvedDependencies(context.Context) ([]slsa1.ArtifactReference, error) {
+	var deps []slsa1.ArtifactReference
+	if b.Context.RepositoryURI() != "" {
+		deps = append(deps, slsa1.ArtifactReference{
+			URI: b.Context.RepositoryURI(),
+			Digest: slsacommon.DigestSet{
+				"sha1": b.Context.SHA,
+			},
+		})
+	}
+	return deps, nil
+}
+
+// RunDetails implements BuildTypeV1.RunDetails. It records the workflow run
+// as the invocation ID. There are no byproducts.
+func (b *GithubActionsBuild) RunDetails(context.Context) (*slsa1.ProvenanaceRunDetails, error) {
+	return &slsa1.ProvenanaceRunDetails{
+		BuildMetadata: slsa1.BuildMetadata{
+			InvocationID: b.invocationID(),
+		},
+	}, nil
+}
+
 // WithClients overrides the build type's default client provider. This is
 // useful for tests where APIs are not available.
 func (b *GithubActionsBuild) WithClients(p ClientProvider) *GithubActionsBuild {
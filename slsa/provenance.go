@@ -22,6 +22,7 @@ import (
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1.0"
 )
 
 const (
@@ -51,29 +52,11 @@ func NewHostedActionsGenerator(bt BuildType) *HostedActionsGenerator {
 
 // Generate generates an in-toto provenance statement in SLSA v0.2 format.
 func (g *HostedActionsGenerator) Generate(ctx context.Context) (*intoto.ProvenanceStatement, error) {
-	// NOTE: Use buildType as the audience as that closely matches the intended
-	// recipient of the OIDC token.
-	// NOTE: GitHub doesn't allow github.com in the audience so remove it.
-	audience := githubComReplace.ReplaceAllString(g.buildType.URI(), "")
-
-	oidcClient, err := g.clients.OIDCClient()
+	builderID, err := getBuilderID(ctx, g.clients, g.buildType.URI())
 	if err != nil {
 		return nil, err
 	}
 
-	// We allow nil OIDC client to support e2e tests on pull requests.
-	builderID := GithubHostedActionsBuilderID
-	if oidcClient != nil {
-		t, err := oidcClient.Token(ctx, []string{audience})
-		if err != nil {
-			return nil, err
-		}
-
-		if t.JobWorkflowRef != "" {
-			builderID = fmt.Sprintf("https://github.com/%s", t.JobWorkflowRef)
-		}
-	}
-
 	subject, err := g.buildType.Subject(ctx)
 	if err != nil {
 		return nil, err
@@ -124,3 +107,119 @@ func (g *HostedActionsGenerator) WithClients(c ClientProvider) *HostedActionsGen
 	g.clients = c
 	return g
 }
+
+// getBuilderID returns the ID of the trusted builder. The ID is the reusable
+// workflow identified by the OIDC token obtained for the given build type.
+func getBuilderID(ctx context.Context, clients ClientProvider, buildTypeURI string) (string, error) {
+	// NOTE: Use buildType as the audience as that closely matches the intended
+	// recipient of the OIDC token.
+	// NOTE: GitHub doesn't allow github.com in the audience so remove it.
+	audience := githubComReplace.ReplaceAllString(buildTypeURI, "")
+
+	oidcClient, err := clients.OIDCClient()
+	if err != nil {
+		return "", err
+	}
+
+	// We allow nil OIDC client to support e2e tests on pull requests.
+	builderID := GithubHostedActionsBuilderID
+	if oidcClient != nil {
+		t, err := oidcClient.Token(ctx, []string{audience})
+		if err != nil {
+			return "", err
+		}
+
+		if t.JobWorkflowRef != "" {
+			builderID = fmt.Sprintf("https://github.com/%s", t.JobWorkflowRef)
+		}
+	}
+
+	return builderID, nil
+}
+
+// ProvenanceStatementSLSA1 is an in-toto statement with a SLSA v1.0
+// provenance predicate.
+type ProvenanceStatementSLSA1 struct {
+	intoto.StatementHeader
+	Predicate slsa1.ProvenancePredicate `json:"predicate"`
+}
+
+// HostedActionsGeneratorV1 is a SLSA v1.0 provenance generator for Github
+// Hosted Actions. It is the SLSA v1.0 counterpart of HostedActionsGenerator
+// and generates provenance based on a BuildTypeV1.
+type HostedActionsGeneratorV1 struct {
+	buildType BuildTypeV1
+	clients   ClientProvider
+}
+
+// NewHostedActionsGeneratorV1 returns a SLSA v1.0 provenance generator for
+// the given build type.
+func NewHostedActionsGeneratorV1(bt BuildTypeV1) *HostedActionsGeneratorV1 {
+	return &HostedActionsGeneratorV1{
+		buildType: bt,
+		clients:   &DefaultClientProvider{},
+	}
+}
+
+// Generate generates an in-toto provenance statement in SLSA v1.0 format.
+func (g *HostedActionsGeneratorV1) Generate(ctx context.Context) (*ProvenanceStatementSLSA1, error) {
+	builderID, err := getBuilderID(ctx, g.clients, g.buildType.URI())
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := g.buildType.Subject(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	externalParameters, err := g.buildType.ExternalParameters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	internalParameters, err := g.buildType.InternalParameters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvedDependencies, err := g.buildType.ResolvedDependencies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runDetails, err := g.buildType.RunDetails(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if runDetails == nil {
+		runDetails = &slsa1.ProvenanaceRunDetails{}
+	}
+	runDetails.Builder.ID = builderID
+
+	return &ProvenanceStatementSLSA1{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: slsa1.PredicateSLSAProvenance,
+			Subject:       subject,
+		},
+		Predicate: slsa1.ProvenancePredicate{
+			BuildDefinition: slsa1.ProvenanceBuildDefinition{
+				BuildType:          g.buildType.URI(),
+				ExternalParameters: externalParameters,
+				// NOTE: internalParameters are recorded in the
+				// systemParameters field of the v1.0 draft predicate.
+				SystemParameters:     internalParameters,
+				ResolvedDependencies: resolvedDependencies,
+			},
+			RunDetails: *runDetails,
+		},
+	}, nil
+}
+
+// WithClients overrides the default ClientProvider. Useful for tests where
+// clients are not available.
+func (g *HostedActionsGeneratorV1) WithClients(c ClientProvider) *HostedActionsGeneratorV1 {
+	g.clients = c
+	return g
+}
@@ -9,6 +9,7 @@ import (
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	slsacommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1.0"
 	"github.com/slsa-framework/slsa-github-generator/github"
 )
 
@@ -150,3 +151,149 @@ func TestHostedActionsProvenance(t *testing.T) {
 		})
 	}
 }
+
+func TestHostedActionsProvenanceV1(t *testing.T) {
+	testCases := []struct {
+		b        BuildTypeV1
+		expected *ProvenanceStatementSLSA1
+		name     string
+	}{
+		{
+			name: "empty",
+			b: &TestBuild{
+				GithubActionsBuild: NewGithubActionsBuild(nil, &github.WorkflowContext{}).WithClients(&NilClientProvider{}),
+			},
+			expected: &ProvenanceStatementSLSA1{
+				StatementHeader: intoto.StatementHeader{
+					Type:          intoto.StatementInTotoV01,
+					PredicateType: slsa1.PredicateSLSAProvenance,
+				},
+				Predicate: slsa1.ProvenancePredicate{
+					BuildDefinition: slsa1.ProvenanceBuildDefinition{
+						BuildType:          testBuildType,
+						ExternalParameters: WorkflowExternalParameters{},
+						SystemParameters: map[string]interface{}{
+							"github_run_id":           "",
+							"github_run_attempt":      "",
+							"github_actor":            "",
+							"github_base_ref":         "",
+							"github_event_name":       "",
+							"github_head_ref":         "",
+							"github_ref":              "",
+							"github_ref_type":         "",
+							"github_repository_owner": "",
+							"github_run_number":       "",
+							"github_sha1":             "",
+						},
+					},
+					RunDetails: slsa1.ProvenanaceRunDetails{
+						Builder: slsa1.Builder{
+							ID: GithubHostedActionsBuilderID,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "workflow run",
+			b: &TestBuild{
+				GithubActionsBuild: NewGithubActionsBuild([]intoto.Subject{
+					{
+						Name:   "artifact",
+						Digest: slsacommon.DigestSet{"sha256": "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"},
+					},
+				}, &github.WorkflowContext{
+					Repository: "slsa-framework/example",
+					ServerURL:  "https://github.com",
+					Workflow:   ".github/workflows/release.yml",
+					RunID:      "12345",
+					RunAttempt: "1",
+					EventName:  "workflow_dispatch",
+					Event: map[string]interface{}{
+						"inputs": map[string]interface{}{
+							"release": "v1.2.3",
+						},
+					},
+					SHA:       "abcde",
+					RefType:   "branch",
+					Ref:       "refs/heads/main",
+					RunNumber: "102937",
+					Actor:     "user",
+				}).WithClients(&NilClientProvider{}),
+			},
+			expected: &ProvenanceStatementSLSA1{
+				StatementHeader: intoto.StatementHeader{
+					Type:          intoto.StatementInTotoV01,
+					PredicateType: slsa1.PredicateSLSAProvenance,
+					Subject: []intoto.Subject{
+						{
+							Name:   "artifact",
+							Digest: slsacommon.DigestSet{"sha256": "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"},
+						},
+					},
+				},
+				Predicate: slsa1.ProvenancePredicate{
+					BuildDefinition: slsa1.ProvenanceBuildDefinition{
+						BuildType: testBuildType,
+						ExternalParameters: WorkflowExternalParameters{
+							Workflow: WorkflowReference{
+								Ref:        "refs/heads/main",
+								Repository: "https://github.com/slsa-framework/example",
+								Path:       ".github/workflows/release.yml",
+							},
+							Inputs: map[string]interface{}{
+								"release": "v1.2.3",
+							},
+						},
+						SystemParameters: map[string]interface{}{
+							"github_run_id":      "12345",
+							"github_run_attempt": "1",
+							"github_actor":       "user",
+							"github_base_ref":    "",
+							"github_event_name":  "workflow_dispatch",
+							"github_event_payload": map[string]interface{}{
+								"inputs": map[string]interface{}{
+									"release": "v1.2.3",
+								},
+							},
+							"github_head_ref":         "",
+							"github_ref":              "refs/heads/main",
+							"github_ref_type":         "branch",
+							"github_repository_owner": "",
+							"github_run_number":       "102937",
+							"github_sha1":             "abcde",
+						},
+						ResolvedDependencies: []slsa1.ArtifactReference{
+							{
+								URI:    "git+https://github.com/slsa-framework/example@refs/heads/main",
+								Digest: slsacommon.DigestSet{"sha1": "abcde"},
+							},
+						},
+					},
+					RunDetails: slsa1.ProvenanaceRunDetails{
+						Builder: slsa1.Builder{
+							ID: GithubHostedActionsBuilderID,
+						},
+						BuildMetadata: slsa1.BuildMetadata{
+							InvocationID: "12345-1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewHostedActionsGeneratorV1(tc.b).WithClients(&NilClientProvider{})
+
+			if p, err := g.Generate(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else {
+				if want, got := tc.expected, p; !cmp.Equal(want, got) {
+					t.Errorf("unexpected result\nwant: %#v\ngot:  %#v\ndiff: %v", want, got, cmp.Diff(want, got))
+				}
+			}
+		})
+	}
+}